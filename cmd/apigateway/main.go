@@ -37,6 +37,13 @@ func main() {
 	r.Use(middleware.RequestID, middleware.RealIP, middleware.Logger, middleware.Recoverer)
 	r.Mount("/observability", observability.MetricsRouter())
 	r.Mount("/v1/trips", http.StripPrefix("/v1/trips", http.HandlerFunc(proxy(tripURL+"/v1/trips"))))
+	r.Mount("/v1/users", http.StripPrefix("/v1/users", http.HandlerFunc(proxy(tripURL+"/v1/users"))))
+	r.Mount("/v1/events", http.StripPrefix("/v1/events", http.HandlerFunc(proxy(tripURL+"/v1/events"))))
+	r.Mount("/v1/pools", http.StripPrefix("/v1/pools", http.HandlerFunc(proxy(tripURL+"/v1/pools"))))
+	r.Handle("/v1/state-machine", proxy(tripURL))
+	r.Handle("/v1/products", proxy(tripURL))
+	r.Handle("/v1/quotes", proxy(tripURL))
+	r.Handle("/v1/surge", proxy(tripURL))
 	r.Handle("/v1/eta", proxy(etaURL+"/v1/eta"))
 
 	srv := &http.Server{Addr: ":8088", Handler: r, ReadHeaderTimeout: 5 * time.Second}
@@ -55,7 +62,11 @@ func main() {
 
 func proxy(target string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		req, err := http.NewRequestWithContext(r.Context(), r.Method, target+r.URL.Path, r.Body)
+		url := target + r.URL.Path
+		if r.URL.RawQuery != "" {
+			url += "?" + r.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, url, r.Body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadGateway)
 			return
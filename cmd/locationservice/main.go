@@ -4,11 +4,13 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 
@@ -18,6 +20,9 @@ import (
 	"github.com/example/ridellite/pkg/observability"
 )
 
+// driverLocationsSubject carries relayed driver positions to the trip service.
+const driverLocationsSubject = "driver.locations"
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -32,11 +37,21 @@ func main() {
 		defer shutdown(context.Background())
 	}
 
+	var natsConn *nats.Conn
+	if url := os.Getenv("NATS_URL"); url != "" {
+		if conn, err := nats.Connect(url, nats.Name("locationservice")); err == nil {
+			natsConn = conn
+			defer conn.Drain()
+		} else {
+			logger.Warn("nats connection failed", zap.Error(err))
+		}
+	}
+
 	observer := location.NewStreamObserver()
 	etaSvc := etasvc.New(observer)
 
 	go runREST(logger, etaSvc)
-	go runGRPC(logger, observer)
+	go runGRPC(logger, location.NewRelay(observer, natsConn, driverLocationsSubject))
 
 	<-ctx.Done()
 	logger.Info("shutdown signal received")
@@ -54,7 +69,7 @@ func runREST(logger *zap.Logger, etaSvc *etasvc.Service) {
 	}
 }
 
-func runGRPC(logger *zap.Logger, observer *location.StreamObserver) {
+func runGRPC(logger *zap.Logger, observer location.Updater) {
 	lis, err := net.Listen("tcp", ":9090")
 	if err != nil {
 		logger.Fatal("listen grpc", zap.Error(err))
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,29 +20,77 @@ import (
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
+	etaservice "github.com/example/ridellite/internal/eta/service"
+	"github.com/example/ridellite/internal/location"
 	outboxworker "github.com/example/ridellite/internal/outbox"
+	"github.com/example/ridellite/internal/trip/cancellation"
+	"github.com/example/ridellite/internal/trip/catalog"
 	"github.com/example/ridellite/internal/trip/domain"
 	"github.com/example/ridellite/internal/trip/handler"
 	"github.com/example/ridellite/internal/trip/matching"
+	"github.com/example/ridellite/internal/trip/pricing"
+	"github.com/example/ridellite/internal/trip/quote"
 	"github.com/example/ridellite/internal/trip/repository"
 	tripservice "github.com/example/ridellite/internal/trip/service"
+	"github.com/example/ridellite/internal/trip/surge"
+	"github.com/example/ridellite/pkg/idempotency"
 	"github.com/example/ridellite/pkg/observability"
 	outboxpkg "github.com/example/ridellite/pkg/outbox"
 )
 
+const (
+	tripEventsSubject = "trip.events"
+	// driverLocationsSubject carries driver positions relayed by the
+	// location service; they are the supply side of surge pricing.
+	driverLocationsSubject = "driver.locations"
+	// breadcrumbQueue is the NATS queue group trip service replicas share
+	// driver positions in when recording breadcrumbs.
+	breadcrumbQueue = "tripservice.breadcrumbs"
+)
+
 type appConfig struct {
-	HTTPAddr        string
-	PostgresDSN     string
-	RedisAddr       string
-	NATSURL         string
-	MatchRadiusKM   float64
-	MatchTopK       int
-	ReserveTTL      time.Duration
-	MatchMaxAttempt int
-	MatchBackoff    time.Duration
-	OutboxPoll      time.Duration
-	OutboxBatch     int
-	OutboxRetry     int
+	HTTPAddr         string
+	PostgresDSN      string
+	RedisAddr        string
+	NATSURL          string
+	MatchRadiusKM    float64
+	MatchTopK        int
+	ReserveTTL       time.Duration
+	MatchMaxAttempt  int
+	MatchBackoff     time.Duration
+	OutboxPoll       time.Duration
+	OutboxBatch      int
+	OutboxRetry      int
+	FreeWaiting      time.Duration
+	NoShowFeeCents   int64
+	AcceptTimeout    time.Duration
+	AssignmentSweep  time.Duration
+	MatchTimeout     time.Duration
+	MatchSweep       time.Duration
+	DispatchQueue    int
+	DispatchWorkers  int
+	RateCards        string
+	CancelPolicies   string
+	Products         string
+	QuoteSecret      string
+	JWTSecret        string
+	QuoteTTL         time.Duration
+	SurgeInterval    time.Duration
+	ScheduleLead     time.Duration
+	ScheduleSweep    time.Duration
+	PickupGrace      time.Duration
+	Reminders        []time.Duration
+	MaxStops         int
+	RatingWindow     time.Duration
+	RatingSpan       int
+	TipWindow        time.Duration
+	PoolMaxDetour    time.Duration
+	PoolMaxPickup    time.Duration
+	IdempotencyTTL   time.Duration
+	IdempotencyLease time.Duration
+	IdempotencyWait  time.Duration
+	IdempotencySweep time.Duration
+	Surge            surge.Config
 }
 
 func main() {
@@ -92,17 +142,127 @@ func main() {
 		}
 	}
 
-	matcher := buildMatcher(redisClient, logger, cfg)
+	repo, uow := buildStore(db, natsConn)
+	matcher := buildMatcher(redisClient, repo, logger, cfg)
+	idempotencyStore := buildIdempotencyStore(db, redisClient)
 
-	repo := repository.NewMemoryRepository()
-	idem := repository.NewMemoryIdempotencyRepo()
-	publisher := outboxpkg.NewPublisher(natsConn, "trip.events")
+	rateCards := pricing.DefaultRateCards()
+	if cfg.RateCards != "" {
+		rateCards = nil
+		if err := json.Unmarshal([]byte(cfg.RateCards), &rateCards); err != nil {
+			logger.Fatal("parse RATE_CARDS", zap.Error(err))
+		}
+	}
+	products := catalog.DefaultProducts()
+	if cfg.Products != "" {
+		products = nil
+		if err := json.Unmarshal([]byte(cfg.Products), &products); err != nil {
+			logger.Fatal("parse PRODUCT_CATALOG", zap.Error(err))
+		}
+	}
+	productCatalog, err := catalog.New(products)
+	if err != nil {
+		logger.Fatal("invalid PRODUCT_CATALOG", zap.Error(err))
+	}
+	fares := pricing.NewEngine(rateCards)
+	for _, product := range productCatalog.Products() {
+		if !fares.Supports(product.PricingKey) {
+			logger.Fatal("product without rate card", zap.String("product", product.Code), zap.String("pricing_key", product.PricingKey))
+		}
+	}
+	cancelPolicies := cancellation.DefaultPolicies()
+	if cfg.CancelPolicies != "" {
+		cancelPolicies = nil
+		if err := json.Unmarshal([]byte(cfg.CancelPolicies), &cancelPolicies); err != nil {
+			logger.Fatal("parse CANCELLATION_POLICIES", zap.Error(err))
+		}
+	}
 
-	svc := tripservice.New(repo, publisher, matcher, domain.SystemClock{}, idem)
-	tripHTTP := handler.NewHTTP(svc)
+	supply := location.NewStreamObserver()
+	if natsConn != nil {
+		if _, err := location.Subscribe(natsConn, driverLocationsSubject, supply); err != nil {
+			logger.Warn("driver location relay unavailable", zap.Error(err))
+		}
+	}
+	surgeEngine := surge.NewEngine(supply, repo, domain.SystemClock{}, cfg.Surge)
+
+	dispatcher := tripservice.NewQueueDispatcher(cfg.DispatchQueue)
+	audit := logger.Named("audit")
+	opts := []tripservice.Option{
+		tripservice.WithConfig(tripservice.Config{
+			FreeWaitingWindow: cfg.FreeWaiting,
+			NoShowFeeCents:    &cfg.NoShowFeeCents,
+			AcceptTimeout:     cfg.AcceptTimeout,
+			MatchTimeout:      cfg.MatchTimeout,
+			ScheduleLeadTime:  cfg.ScheduleLead,
+			PickupGracePeriod: cfg.PickupGrace,
+			ReminderOffsets:   cfg.Reminders,
+			MaxStops:          &cfg.MaxStops,
+			RatingWindow:      &cfg.RatingWindow,
+			RatingSpan:        cfg.RatingSpan,
+			TipWindow:         &cfg.TipWindow,
+			PoolMaxDetour:     cfg.PoolMaxDetour,
+			PoolMaxPickupWait: cfg.PoolMaxPickup,
+		}),
+		tripservice.WithDispatcher(dispatcher),
+		tripservice.WithCatalog(productCatalog),
+		tripservice.WithPricing(fares),
+		tripservice.WithCancellation(cancellation.NewEngine(cancelPolicies)),
+		tripservice.WithSurge(surgeEngine),
+		tripservice.WithRatings(repo),
+		tripservice.WithFareAdjustments(repo),
+		tripservice.WithPooling(etaservice.New(nil), repo),
+		tripservice.WithBreadcrumbs(repo),
+		tripservice.WithAuditLog(tripservice.AuditLogFunc(func(_ context.Context, entry tripservice.AuditEntry) {
+			audit.Warn("trip authorization",
+				zap.String("decision", string(entry.Decision)),
+				zap.String("trip_id", entry.TripID.String()),
+				zap.String("command", string(entry.Command)),
+				zap.String("user_id", entry.UserID),
+				zap.String("role", entry.Role),
+				zap.String("reason", entry.Reason),
+			)
+		})),
+	}
+	if cfg.QuoteSecret != "" && cfg.QuoteSecret == cfg.JWTSecret {
+		// A shared secret would let a quote token pass as an access token.
+		logger.Fatal("QUOTE_SECRET must differ from JWT_SECRET")
+	}
+	if cfg.QuoteSecret != "" {
+		signer := quote.NewSigner([]byte(cfg.QuoteSecret), cfg.QuoteTTL, domain.SystemClock{}.Now)
+		// Trip estimates only need the route, not driver snapshots.
+		opts = append(opts, tripservice.WithQuotes(signer, etaservice.New(nil)))
+	} else {
+		logger.Warn("upfront quotes disabled: QUOTE_SECRET not set")
+	}
+	svc := tripservice.New(repo, uow, matcher, domain.SystemClock{}, opts...)
+	httpOpts := []handler.Option{handler.WithIdempotency(idempotencyStore, idempotency.Config{
+		TTL:   cfg.IdempotencyTTL,
+		Lease: cfg.IdempotencyLease,
+		Wait:  cfg.IdempotencyWait,
+	})}
+	if cfg.JWTSecret != "" {
+		httpOpts = append(httpOpts, handler.WithAuthentication(cfg.JWTSecret))
+	} else {
+		logger.Warn("trip commands will be rejected: JWT_SECRET not set")
+	}
+	tripHTTP := handler.NewHTTP(svc, httpOpts...)
+
+	if natsConn != nil {
+		// Every replica observes supply, but each breadcrumb is recorded once.
+		record := func(ctx context.Context, snap domain.LocationSnapshot) {
+			if err := svc.RecordLocation(ctx, snap); err != nil {
+				logger.Warn("record breadcrumb failed", zap.String("driver_id", snap.DriverID.String()), zap.Error(err))
+			}
+		}
+		if _, err := location.QueueSubscribe(natsConn, driverLocationsSubject, breadcrumbQueue, record); err != nil {
+			logger.Warn("trip breadcrumbs unavailable", zap.Error(err))
+		}
+	}
 
 	r := chi.NewRouter()
 	r.Mount("/", tripHTTP.Router())
+	r.Mount("/v1/surge", handler.NewSurge(surgeEngine).Router())
 	r.Mount("/observability", observability.MetricsRouter())
 
 	srv := &http.Server{
@@ -126,6 +286,65 @@ func main() {
 		logger.Warn("outbox worker disabled", zap.Bool("db", db != nil), zap.Bool("nats", natsConn != nil))
 	}
 
+	go func() {
+		_ = dispatcher.Run(ctx, cfg.DispatchWorkers, svc.MatchTrip, func(err error) {
+			logger.Warn("matching failed", zap.Error(err))
+		})
+	}()
+
+	go func() {
+		_ = tripservice.RunPeriodically(ctx, cfg.AssignmentSweep, func(ctx context.Context) error {
+			_, err := svc.ExpireAssignments(ctx)
+			return err
+		}, func(err error) {
+			logger.Error("assignment expiry failed", zap.Error(err))
+		})
+	}()
+
+	go func() {
+		_ = tripservice.RunPeriodically(ctx, cfg.MatchSweep, func(ctx context.Context) error {
+			_, err := svc.ExpireUnmatchedTrips(ctx)
+			return err
+		}, func(err error) {
+			logger.Error("unmatched trip expiry failed", zap.Error(err))
+		})
+	}()
+
+	go func() {
+		_ = tripservice.RunPeriodically(ctx, cfg.MatchSweep, func(ctx context.Context) error {
+			_, err := svc.RedispatchPendingTrips(ctx)
+			return err
+		}, func(err error) {
+			logger.Warn("redispatching pending trips failed", zap.Error(err))
+		})
+	}()
+
+	go func() {
+		_ = tripservice.RunPeriodically(ctx, cfg.ScheduleSweep, func(ctx context.Context) error {
+			_, err := svc.ProcessScheduledTrips(ctx)
+			return err
+		}, func(err error) {
+			logger.Error("scheduled trip processing failed", zap.Error(err))
+		})
+	}()
+
+	if purger, ok := idempotencyStore.(expiringStore); ok {
+		go func() {
+			_ = tripservice.RunPeriodically(ctx, cfg.IdempotencySweep, func(ctx context.Context) error {
+				_, err := purger.DeleteExpired(ctx)
+				return err
+			}, func(err error) {
+				logger.Error("idempotency key cleanup failed", zap.Error(err))
+			})
+		}()
+	}
+
+	go func() {
+		_ = tripservice.RunPeriodically(ctx, cfg.SurgeInterval, surgeEngine.Recompute, func(err error) {
+			logger.Error("surge recomputation failed", zap.Error(err))
+		})
+	}()
+
 	go func() {
 		logger.Info("trip service listening", zap.String("addr", srv.Addr))
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -139,9 +358,31 @@ func main() {
 	_ = srv.Shutdown(shutdownCtx)
 }
 
-func buildMatcher(redisClient *redis.Client, logger *zap.Logger, cfg appConfig) domain.MatchingEngine {
+// tripStore is implemented by both repositories: trips, their ratings, fare
+// adjustments, shared routes and breadcrumbs live in the same database.
+type tripStore interface {
+	domain.Repository
+	domain.RatingRepository
+	domain.FareAdjustmentRepository
+	domain.PoolRepository
+	domain.BreadcrumbRepository
+}
+
+// buildStore prefers Postgres, where events reach NATS only through the
+// outbox worker. Without a database, events are published directly after the
+// in-memory commit.
+func buildStore(db *sql.DB, natsConn *nats.Conn) (tripStore, domain.UnitOfWork) {
+	if db != nil {
+		return repository.NewPostgresRepository(db), repository.NewPostgresUnitOfWork(db, tripEventsSubject)
+	}
+	repo := repository.NewMemoryRepository()
+	return repo, repository.NewMemoryUnitOfWork(repo, outboxpkg.NewPublisher(natsConn, tripEventsSubject))
+}
+
+func buildMatcher(redisClient *redis.Client, trips matching.TripFinder, logger *zap.Logger, cfg appConfig) domain.MatchingEngine {
+	busy := matching.WithActiveTrips(trips)
 	if redisClient == nil {
-		return matching.NewSimpleMatcher(matching.NewMemorySource(), matching.NewMemoryReservationStore(), cfg.MatchTopK)
+		return matching.NewSimpleMatcher(matching.NewMemorySource(), matching.NewMemoryReservationStore(), cfg.MatchTopK, busy)
 	}
 	geo := matching.NewRedisGeoIndex(redisClient, "")
 	store := matching.NewRedisReservationStore(redisClient, "")
@@ -151,23 +392,78 @@ func buildMatcher(redisClient *redis.Client, logger *zap.Logger, cfg appConfig)
 		ReserveTTL:  cfg.ReserveTTL,
 		MaxAttempts: cfg.MatchMaxAttempt,
 		Backoff:     cfg.MatchBackoff,
-	})
+	}, busy)
+}
+
+// expiringStore is an idempotency store whose expired keys must be deleted
+// explicitly; Redis expires them by itself.
+type expiringStore interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// buildIdempotencyStore prefers Redis, then Postgres, so that every instance
+// shares keys. The in-memory store only protects a single instance.
+func buildIdempotencyStore(db *sql.DB, redisClient *redis.Client) idempotency.Store {
+	switch {
+	case redisClient != nil:
+		return idempotency.NewRedisStore(redisClient, "")
+	case db != nil:
+		return idempotency.NewPostgresStore(db)
+	default:
+		return idempotency.NewMemoryStore(nil)
+	}
 }
 
 func loadConfig() appConfig {
 	return appConfig{
-		HTTPAddr:        getenv("HTTP_ADDR", ":8080"),
-		PostgresDSN:     firstNonEmpty(os.Getenv("POSTGRES_DSN"), os.Getenv("DATABASE_URL")),
-		RedisAddr:       os.Getenv("REDIS_ADDR"),
-		NATSURL:         os.Getenv("NATS_URL"),
-		MatchRadiusKM:   parseFloatEnv("MATCH_RADIUS_KM", 5),
-		MatchTopK:       parseIntEnv("MATCH_TOPK", 5),
-		ReserveTTL:      time.Duration(parseIntEnv("RESERVE_TTL_SEC", 10)) * time.Second,
-		MatchMaxAttempt: parseIntEnv("MATCH_MAX_ATTEMPTS", 5),
-		MatchBackoff:    time.Duration(parseIntEnv("MATCH_BACKOFF_MS", 50)) * time.Millisecond,
-		OutboxPoll:      time.Duration(parseIntEnv("OUTBOX_POLL_MS", 200)) * time.Millisecond,
-		OutboxBatch:     parseIntEnv("OUTBOX_BATCH", 100),
-		OutboxRetry:     parseIntEnv("OUTBOX_RETRY_MAX", 3),
+		HTTPAddr:         getenv("HTTP_ADDR", ":8080"),
+		PostgresDSN:      firstNonEmpty(os.Getenv("POSTGRES_DSN"), os.Getenv("DATABASE_URL")),
+		RedisAddr:        os.Getenv("REDIS_ADDR"),
+		NATSURL:          os.Getenv("NATS_URL"),
+		MatchRadiusKM:    parseFloatEnv("MATCH_RADIUS_KM", 5),
+		MatchTopK:        parseIntEnv("MATCH_TOPK", 5),
+		ReserveTTL:       time.Duration(parseIntEnv("RESERVE_TTL_SEC", 10)) * time.Second,
+		MatchMaxAttempt:  parseIntEnv("MATCH_MAX_ATTEMPTS", 5),
+		MatchBackoff:     time.Duration(parseIntEnv("MATCH_BACKOFF_MS", 50)) * time.Millisecond,
+		OutboxPoll:       time.Duration(parseIntEnv("OUTBOX_POLL_MS", 200)) * time.Millisecond,
+		OutboxBatch:      parseIntEnv("OUTBOX_BATCH", 100),
+		OutboxRetry:      parseIntEnv("OUTBOX_RETRY_MAX", 3),
+		FreeWaiting:      time.Duration(parseIntEnv("FREE_WAITING_SEC", 300)) * time.Second,
+		NoShowFeeCents:   int64(parseNonNegativeIntEnv("NO_SHOW_FEE_CENTS", tripservice.DefaultNoShowFeeCents)),
+		AcceptTimeout:    time.Duration(parseIntEnv("ACCEPT_TIMEOUT_SEC", 15)) * time.Second,
+		AssignmentSweep:  time.Duration(parsePositiveIntEnv("ASSIGNMENT_SWEEP_MS", 1000)) * time.Millisecond,
+		MatchTimeout:     time.Duration(parseIntEnv("MATCH_TIMEOUT_SEC", 300)) * time.Second,
+		MatchSweep:       time.Duration(parsePositiveIntEnv("MATCH_SWEEP_MS", 5000)) * time.Millisecond,
+		DispatchQueue:    parseIntEnv("DISPATCH_QUEUE_SIZE", 1024),
+		DispatchWorkers:  parseIntEnv("DISPATCH_WORKERS", 4),
+		RateCards:        os.Getenv("RATE_CARDS"),
+		CancelPolicies:   os.Getenv("CANCELLATION_POLICIES"),
+		Products:         os.Getenv("PRODUCT_CATALOG"),
+		QuoteSecret:      os.Getenv("QUOTE_SECRET"),
+		JWTSecret:        os.Getenv("JWT_SECRET"),
+		QuoteTTL:         time.Duration(parseIntEnv("QUOTE_TTL_SEC", 120)) * time.Second,
+		SurgeInterval:    time.Duration(parsePositiveIntEnv("SURGE_INTERVAL_MS", 5000)) * time.Millisecond,
+		ScheduleLead:     time.Duration(parseIntEnv("SCHEDULE_LEAD_MIN", 15)) * time.Minute,
+		ScheduleSweep:    time.Duration(parsePositiveIntEnv("SCHEDULE_SWEEP_MS", 10000)) * time.Millisecond,
+		PickupGrace:      time.Duration(parseIntEnv("SCHEDULE_PICKUP_GRACE_MIN", 30)) * time.Minute,
+		Reminders:        parseMinutesListEnv("SCHEDULE_REMINDERS_MIN", tripservice.DefaultReminderOffsets),
+		MaxStops:         parseNonNegativeIntEnv("TRIP_MAX_STOPS", tripservice.DefaultMaxStops),
+		RatingWindow:     time.Duration(parseNonNegativeIntEnv("RATING_WINDOW_HOURS", 168)) * time.Hour,
+		RatingSpan:       parseIntEnv("RATING_SPAN", domain.DefaultRatingSpan),
+		TipWindow:        time.Duration(parseNonNegativeIntEnv("TIP_WINDOW_HOURS", 72)) * time.Hour,
+		PoolMaxDetour:    time.Duration(parseIntEnv("POOL_MAX_DETOUR_MIN", 8)) * time.Minute,
+		PoolMaxPickup:    time.Duration(parseIntEnv("POOL_MAX_PICKUP_MIN", 10)) * time.Minute,
+		IdempotencyTTL:   time.Duration(parseIntEnv("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+		IdempotencyLease: time.Duration(parseIntEnv("IDEMPOTENCY_LEASE_SEC", 30)) * time.Second,
+		IdempotencyWait:  time.Duration(parseIntEnv("IDEMPOTENCY_WAIT_MS", 2000)) * time.Millisecond,
+		IdempotencySweep: time.Duration(parsePositiveIntEnv("IDEMPOTENCY_SWEEP_MIN", 60)) * time.Minute,
+		Surge: surge.Config{
+			Precision:     parseIntEnv("SURGE_GEOHASH_PRECISION", 6),
+			Sensitivity:   parseFloatEnv("SURGE_SENSITIVITY", 0.5),
+			Smoothing:     parseFloatEnv("SURGE_SMOOTHING", 0.3),
+			MaxMultiplier: parseFloatEnv("SURGE_MAX_MULTIPLIER", 3),
+			SupplyTTL:     time.Duration(parseIntEnv("SURGE_SUPPLY_TTL_SEC", 120)) * time.Second,
+		},
 	}
 }
 
@@ -196,6 +492,38 @@ func parseIntEnv(key string, fallback int) int {
 	return fallback
 }
 
+// parsePositiveIntEnv is parseIntEnv for values that must be positive, such
+// as sweep intervals; anything else falls back.
+func parsePositiveIntEnv(key string, fallback int) int {
+	if v := parseIntEnv(key, fallback); v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func parseNonNegativeIntEnv(key string, fallback int) int {
+	if v := parseIntEnv(key, fallback); v >= 0 {
+		return v
+	}
+	return fallback
+}
+
+func parseMinutesListEnv(key string, fallback []time.Duration) []time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var durations []time.Duration
+	for _, part := range strings.Split(v, ",") {
+		minutes, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fallback
+		}
+		durations = append(durations, time.Duration(minutes)*time.Minute)
+	}
+	return durations
+}
+
 func parseFloatEnv(key string, fallback float64) float64 {
 	if v := os.Getenv(key); v != "" {
 		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
@@ -3,38 +3,51 @@ module github.com/example/ridellite
 go 1.22
 
 require (
-    github.com/go-chi/chi/v5 v5.0.10
-    github.com/golang-jwt/jwt/v5 v5.2.1
-    github.com/google/uuid v1.5.0
-    github.com/jackc/pgx/v5 v5.5.5
-    github.com/nats-io/nats.go v1.32.0
-    github.com/prometheus/client_golang v1.18.0
-    github.com/redis/go-redis/v9 v9.3.0
-    github.com/stretchr/testify v1.8.4
-    github.com/testcontainers/testcontainers-go v0.28.0
-    go.opentelemetry.io/otel v1.24.0
-    go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.24.0
-    go.opentelemetry.io/otel/sdk v1.24.0
-    go.opentelemetry.io/otel/trace v1.24.0
-    go.uber.org/zap v1.26.0
-    google.golang.org/grpc v1.61.0
+	github.com/go-chi/chi/v5 v5.0.10
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/google/uuid v1.6.0
+	github.com/jackc/pgx/v5 v5.5.5
+	github.com/nats-io/nats.go v1.32.0
+	github.com/prometheus/client_golang v1.18.0
+	github.com/redis/go-redis/v9 v9.3.0
+	github.com/stretchr/testify v1.8.4
+	github.com/testcontainers/testcontainers-go v0.28.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+	go.uber.org/zap v1.26.0
+	google.golang.org/grpc v1.61.0
 )
 
 require (
-    github.com/beorn7/perks v1.0.1 // indirect
-    github.com/cespare/xxhash/v2 v2.2.0 // indirect
-    github.com/davecgh/go-spew v1.1.1 // indirect
-    github.com/gogo/protobuf v1.3.2 // indirect
-    github.com/golang/protobuf v1.5.3 // indirect
-    github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
-    github.com/pmezard/go-difflib v1.0.0 // indirect
-    github.com/prometheus/client_model v0.5.0 // indirect
-    github.com/prometheus/common v0.47.0 // indirect
-    github.com/prometheus/procfs v0.12.0 // indirect
-    go.uber.org/multierr v1.11.0 // indirect
-    golang.org/x/net v0.19.0 // indirect
-    golang.org/x/sys v0.15.0 // indirect
-    golang.org/x/text v0.14.0 // indirect
-    google.golang.org/genproto v0.0.0-20231106174013-bbf56f31fb17 // indirect
-    google.golang.org/protobuf v1.31.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	github.com/klauspost/compress v1.17.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
+	github.com/nats-io/nkeys v0.4.7 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.47.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto v0.0.0-20231106174013-bbf56f31fb17 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
 )
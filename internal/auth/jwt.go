@@ -9,7 +9,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims extends standard registered claims with role information.
+// Roles carried in Claims.Role.
+const (
+	RoleRider  = "rider"
+	RoleDriver = "driver"
+	RoleAdmin  = "admin"
+)
+
+// Claims extends standard registered claims with role information. The
+// subject is the user's identifier.
 type Claims struct {
 	Role string `json:"role"`
 	jwt.RegisteredClaims
@@ -45,12 +53,16 @@ func Middleware(secret string, roles ...string) func(http.Handler) http.Handler
 					return
 				}
 			}
-			ctx := context.WithValue(r.Context(), claimsKey{}, claims)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
 		})
 	}
 }
 
+// ContextWithClaims returns a copy of ctx carrying claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
 // ClaimsFromContext retrieves claims from context.
 func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
 	claims, ok := ctx.Value(claimsKey{}).(*Claims)
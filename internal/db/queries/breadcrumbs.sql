@@ -0,0 +1,9 @@
+-- name: AppendBreadcrumb :exec
+INSERT INTO trip_breadcrumbs (trip_id, location, speed, accuracy, recorded_at)
+VALUES ($1, ST_SetSRID(ST_Point($2, $3), 4326), $4, $5, $6);
+
+-- name: ListBreadcrumbs :many
+SELECT trip_id, ST_Y(location), ST_X(location), speed, accuracy, recorded_at
+FROM trip_breadcrumbs
+WHERE trip_id = $1
+ORDER BY recorded_at, id;
@@ -0,0 +1,9 @@
+-- name: CreateFareAdjustment :exec
+INSERT INTO fare_adjustments (id, trip_id, kind, amount_cents, reason, actor_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: ListFareAdjustments :many
+SELECT id, trip_id, kind, amount_cents, reason, actor_id, created_at
+FROM fare_adjustments
+WHERE trip_id = $1
+ORDER BY created_at, id;
@@ -0,0 +1,33 @@
+-- name: ClaimIdempotencyKey :one
+INSERT INTO idempotency_keys (key, request_hash, response, created_at, expires_at)
+VALUES ($1, $2, NULL, now(), now() + $3::bigint * interval '1 millisecond')
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    response = NULL,
+    created_at = EXCLUDED.created_at,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now()
+RETURNING key;
+
+-- name: GetIdempotencyKey :one
+SELECT request_hash, response
+FROM idempotency_keys
+WHERE key = $1 AND expires_at > now();
+
+-- name: CompleteIdempotencyKey :exec
+INSERT INTO idempotency_keys (key, request_hash, response, created_at, expires_at)
+VALUES ($1, $2, $3, now(), now() + $4::bigint * interval '1 millisecond')
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    response = EXCLUDED.response,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.request_hash = EXCLUDED.request_hash
+   OR idempotency_keys.expires_at <= now();
+
+-- name: ReleaseIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1 AND request_hash = $2 AND response IS NULL;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= now();
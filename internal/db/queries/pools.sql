@@ -0,0 +1,15 @@
+-- name: GetPool :one
+SELECT id, driver_id, vehicle_type, waypoints, version, updated_at
+FROM trip_pools
+WHERE id = $1;
+
+-- name: CreatePool :exec
+INSERT INTO trip_pools (id, driver_id, vehicle_type, waypoints, version, updated_at)
+VALUES ($1, $2, $3, $4, 1, $5);
+
+-- name: UpdatePool :one
+-- Optimistic locking like UpdateTrip: no row returned means a conflict.
+UPDATE trip_pools
+SET driver_id = $3, vehicle_type = $4, waypoints = $5, updated_at = $6, version = version + 1
+WHERE id = $1 AND version = $2
+RETURNING version;
@@ -0,0 +1,27 @@
+-- name: CreateRating :execrows
+INSERT INTO trip_ratings (trip_id, rater_id, ratee_id, ratee_role, stars, tags, comment, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (trip_id, rater_id) DO NOTHING;
+
+-- name: UpsertRatingSummary :exec
+-- $5 is the rolling average span; see domain.RatingSummary.Add.
+INSERT INTO user_ratings (user_id, role, rating_count, stars_total, rolling_average, updated_at)
+VALUES ($1, $2, 1, $3::bigint, $3::double precision, $4)
+ON CONFLICT (user_id, role) DO UPDATE SET
+    rating_count = user_ratings.rating_count + 1,
+    stars_total = user_ratings.stars_total + EXCLUDED.stars_total,
+    rolling_average = user_ratings.rolling_average
+        + (EXCLUDED.stars_total - user_ratings.rolling_average) / LEAST(user_ratings.rating_count + 1, $5::bigint),
+    updated_at = EXCLUDED.updated_at;
+
+-- name: ListTripRatings :many
+SELECT trip_id, rater_id, ratee_id, ratee_role, stars, tags, comment, created_at
+FROM trip_ratings
+WHERE trip_id = $1
+ORDER BY created_at, rater_id;
+
+-- name: GetRatingSummaries :many
+SELECT user_id, role, rating_count, stars_total, rolling_average, updated_at
+FROM user_ratings
+WHERE user_id = $1
+ORDER BY role;
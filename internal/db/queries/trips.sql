@@ -1,31 +1,156 @@
--- name: CreateTrip :one
+-- Placeholders: $1 id and $2 version come first so new columns can be
+-- appended without renumbering existing ones.
+
+-- name: CreateTrip :exec
 INSERT INTO trips (
-    id, rider_id, driver_id, pickup, dropoff, status,
-    requested_at, accepted_at, started_at, finished_at,
-    cancelled_at, price_cents, version
+    id, version, rider_id, driver_id, pickup, dropoff, vehicle_type, status,
+    requested_at, accepted_at, started_at, finished_at, cancelled_at,
+    cancelled_by, price_cents, arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown, quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
 ) VALUES (
-    $1, $2, $3, ST_SetSRID(ST_Point($4, $5), 4326), ST_SetSRID(ST_Point($6, $7), 4326), $8,
-    $9, $10, $11, $12, $13, $14, $15
-)
-RETURNING *;
+    $1, $2, $3, $4, ST_SetSRID(ST_Point($5, $6), 4326), ST_SetSRID(ST_Point($7, $8), 4326), $9, $10,
+    $11, $12, $13, $14, $15,
+    $16, $17, $18, $19, $20,
+    $21, $22, $23, $24, $25, $26, $27, $28,
+    $29, $30, $31, $32, $33, $34
+);
 
 -- name: GetTrip :one
-SELECT * FROM trips WHERE id = $1 LIMIT 1;
+SELECT
+    id, version, rider_id, driver_id,
+    ST_Y(pickup) AS pickup_lat, ST_X(pickup) AS pickup_lng,
+    ST_Y(dropoff) AS dropoff_lat, ST_X(dropoff) AS dropoff_lng,
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+FROM trips
+WHERE id = $1
+LIMIT 1;
+
+-- name: ListTripsByStatus :many
+SELECT
+    id, version, rider_id, driver_id,
+    ST_Y(pickup) AS pickup_lat, ST_X(pickup) AS pickup_lng,
+    ST_Y(dropoff) AS dropoff_lat, ST_X(dropoff) AS dropoff_lng,
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+FROM trips
+WHERE status = $1
+ORDER BY requested_at
+LIMIT $2;
+
+-- name: ListScheduledTrips :many
+SELECT
+    id, version, rider_id, driver_id,
+    ST_Y(pickup) AS pickup_lat, ST_X(pickup) AS pickup_lng,
+    ST_Y(dropoff) AS dropoff_lat, ST_X(dropoff) AS dropoff_lng,
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+FROM trips
+WHERE status = 'SCHEDULED' AND pickup_at > $1 AND pickup_at <= $2
+ORDER BY pickup_at
+LIMIT $3;
+
+-- name: ListUnmatchedTrips :many
+-- Matching starts at request time, or $1 seconds before pickup for
+-- scheduled rides; see domain.Trip.MatchingStartedAt.
+SELECT
+    id, version, rider_id, driver_id,
+    ST_Y(pickup) AS pickup_lat, ST_X(pickup) AS pickup_lng,
+    ST_Y(dropoff) AS dropoff_lat, ST_X(dropoff) AS dropoff_lng,
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+FROM trips
+WHERE status = 'REQUESTED'
+  AND GREATEST(requested_at, pickup_at - make_interval(secs => $1::double precision)) <= $2
+ORDER BY GREATEST(requested_at, pickup_at - make_interval(secs => $1::double precision)), id
+LIMIT $3;
 
 -- name: UpdateTrip :one
+-- Optimistic locking: the row is only updated while its version still equals
+-- the version the caller read ($2). No row returned means a conflict.
 UPDATE trips
 SET
-    rider_id = $2,
-    driver_id = $3,
-    pickup = ST_SetSRID(ST_Point($4, $5), 4326),
-    dropoff = ST_SetSRID(ST_Point($6, $7), 4326),
-    status = $8,
-    requested_at = $9,
-    accepted_at = $10,
-    started_at = $11,
-    finished_at = $12,
-    cancelled_at = $13,
-    price_cents = $14,
+    rider_id = $3,
+    driver_id = $4,
+    pickup = ST_SetSRID(ST_Point($5, $6), 4326),
+    dropoff = ST_SetSRID(ST_Point($7, $8), 4326),
+    vehicle_type = $9,
+    status = $10,
+    requested_at = $11,
+    accepted_at = $12,
+    started_at = $13,
+    finished_at = $14,
+    cancelled_at = $15,
+    cancelled_by = $16,
+    price_cents = $17,
+    arrived_at = $18,
+    cancel_reason = $19,
+    cancellation_fee_cents = $20,
+    accept_deadline = $21,
+    declined_drivers = $22,
+    fare_breakdown = $23,
+    quote_id = $24,
+    upfront_price_cents = $25,
+    pickup_at = $26,
+    reminders_sent = $27,
+    stops = $28,
+    driver_penalty_cents = $29,
+    adjustment_cents = $30,
+    seats = $31,
+    pool_id = $32,
+    driven_meters = $33,
+    rate_card = $34,
     version = version + 1
-WHERE id = $1
-RETURNING *;
+WHERE id = $1 AND version = $2
+RETURNING version;
+
+-- name: SearchTrips :many
+SELECT
+    id, version, rider_id, driver_id,
+    ST_Y(pickup) AS pickup_lat, ST_X(pickup) AS pickup_lng,
+    ST_Y(dropoff) AS dropoff_lat, ST_X(dropoff) AS dropoff_lng,
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+FROM trips
+WHERE ($1::uuid IS NULL OR rider_id = $1)
+  AND ($2::uuid IS NULL OR driver_id = $2)
+  AND (cardinality($3::text[]) = 0 OR status = ANY($3))
+  AND ($4::timestamptz IS NULL OR requested_at >= $4)
+  AND ($5::timestamptz IS NULL OR requested_at < $5)
+  AND ($6::timestamptz IS NULL OR (requested_at, id) < ($6, $7::uuid))
+ORDER BY requested_at DESC, id DESC
+LIMIT $8;
+
+-- name: GetTripVersion :one
+SELECT version FROM trips WHERE id = $1;
+
+-- name: CreateTripEvent :exec
+INSERT INTO trip_events (trip_id, event_type, payload, created_at)
+VALUES ($1, $2, $3, COALESCE($4, now()));
+
+-- name: ListTripEvents :many
+SELECT id, trip_id, event_type, payload, created_at
+FROM trip_events
+WHERE trip_id = $1
+ORDER BY id;
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
@@ -31,8 +33,13 @@ func (h *HTTP) Router() http.Handler {
 func (h *HTTP) estimate(w http.ResponseWriter, r *http.Request) {
 	pickup := domain.GeoPoint{Lat: parseQueryFloat(r, "pickup_lat"), Lng: parseQueryFloat(r, "pickup_lng")}
 	dropoff := domain.GeoPoint{Lat: parseQueryFloat(r, "dropoff_lat"), Lng: parseQueryFloat(r, "dropoff_lng")}
+	stops, err := parseStops(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	driverETA, driverID := h.svc.EstimateDriverETA(r.Context(), pickup)
-	tripETA := h.svc.EstimateTripETA(r.Context(), pickup, dropoff)
+	tripETA := h.svc.EstimateTripETA(r.Context(), pickup, dropoff, stops...)
 
 	resp := map[string]any{
 		"driver_eta_sec": driverETA.Seconds(),
@@ -49,6 +56,26 @@ func parseQueryFloat(r *http.Request, key string) float64 {
 	return v
 }
 
+// parseStops reads repeated stop=lat,lng query parameters in order.
+func parseStops(r *http.Request) ([]domain.GeoPoint, error) {
+	var stops []domain.GeoPoint
+	for _, v := range r.URL.Query()["stop"] {
+		lat, lng, ok := strings.Cut(v, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid stop %q", v)
+		}
+		point := domain.GeoPoint{}
+		var errLat, errLng error
+		point.Lat, errLat = strconv.ParseFloat(lat, 64)
+		point.Lng, errLng = strconv.ParseFloat(lng, 64)
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("invalid stop %q", v)
+		}
+		stops = append(stops, point)
+	}
+	return stops, nil
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,92 @@
+package location
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// Updater consumes driver location updates.
+type Updater interface {
+	Update(ctx context.Context, driverID uuid.UUID, point domain.GeoPoint, speed, accuracy float64)
+}
+
+// UpdaterFunc adapts a function to Updater.
+type UpdaterFunc func(ctx context.Context, driverID uuid.UUID, point domain.GeoPoint, speed, accuracy float64)
+
+// Update calls f.
+func (f UpdaterFunc) Update(ctx context.Context, driverID uuid.UUID, point domain.GeoPoint, speed, accuracy float64) {
+	f(ctx, driverID, point, speed, accuracy)
+}
+
+// Relay forwards every update to next and republishes it on a NATS subject
+// so other services can keep their own view of driver supply.
+type Relay struct {
+	next    Updater
+	conn    *nats.Conn
+	subject string
+}
+
+// NewRelay constructs a relay. A nil conn only forwards to next.
+func NewRelay(next Updater, conn *nats.Conn, subject string) *Relay {
+	return &Relay{next: next, conn: conn, subject: subject}
+}
+
+// Update satisfies Updater. Publishing is best effort; the local update
+// always happens.
+func (r *Relay) Update(ctx context.Context, driverID uuid.UUID, point domain.GeoPoint, speed, accuracy float64) {
+	r.next.Update(ctx, driverID, point, speed, accuracy)
+	if r.conn == nil {
+		return
+	}
+	data, err := json.Marshal(domain.LocationSnapshot{
+		DriverID: driverID,
+		Point:    point,
+		Speed:    speed,
+		Accuracy: accuracy,
+		Updated:  time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+	_ = r.conn.Publish(r.subject, data)
+}
+
+// Subscribe feeds snapshots relayed on subject into observer.
+func Subscribe(conn *nats.Conn, subject string, observer Updater) (*nats.Subscription, error) {
+	sub, err := conn.Subscribe(subject, snapshotHandler(func(ctx context.Context, snap domain.LocationSnapshot) {
+		observer.Update(ctx, snap.DriverID, snap.Point, snap.Speed, snap.Accuracy)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("subscribe %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+// QueueSubscribe hands each snapshot relayed on subject to handle in one
+// member of queue only, so replicas share the updates instead of each
+// processing all of them. Snapshots keep the time they were relayed at.
+func QueueSubscribe(conn *nats.Conn, subject, queue string, handle func(ctx context.Context, snap domain.LocationSnapshot)) (*nats.Subscription, error) {
+	sub, err := conn.QueueSubscribe(subject, queue, snapshotHandler(handle))
+	if err != nil {
+		return nil, fmt.Errorf("queue subscribe %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+// snapshotHandler decodes relayed snapshots, dropping malformed ones.
+func snapshotHandler(handle func(ctx context.Context, snap domain.LocationSnapshot)) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		var snap domain.LocationSnapshot
+		if err := json.Unmarshal(msg.Data, &snap); err != nil {
+			return
+		}
+		handle(context.Background(), snap)
+	}
+}
@@ -10,11 +10,11 @@ import (
 
 // Server implements the LocationServer interface.
 type Server struct {
-	observer *StreamObserver
+	observer Updater
 }
 
 // NewServer constructs a server.
-func NewServer(observer *StreamObserver) *Server {
+func NewServer(observer Updater) *Server {
 	return &Server{observer: observer}
 }
 
@@ -3,6 +3,7 @@ package outbox
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -97,6 +98,7 @@ type record struct {
 	ID        int64
 	Topic     string
 	Payload   []byte
+	Headers   []byte
 	CreatedAt time.Time
 }
 
@@ -137,7 +139,7 @@ func (w *Worker) loadPending(ctx context.Context) ([]record, *sql.Tx, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("begin tx: %w", err)
 	}
-	rows, err := tx.QueryContext(ctx, `SELECT id, topic, payload, created_at FROM outbox WHERE published = false ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, w.cfg.BatchSize)
+	rows, err := tx.QueryContext(ctx, `SELECT id, topic, payload, COALESCE(headers, '{}'::jsonb), created_at FROM outbox WHERE published = false ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, w.cfg.BatchSize)
 	if err != nil {
 		_ = tx.Rollback()
 		return nil, nil, fmt.Errorf("select outbox: %w", err)
@@ -146,7 +148,7 @@ func (w *Worker) loadPending(ctx context.Context) ([]record, *sql.Tx, error) {
 	var records []record
 	for rows.Next() {
 		var rec record
-		if err := rows.Scan(&rec.ID, &rec.Topic, &rec.Payload, &rec.CreatedAt); err != nil {
+		if err := rows.Scan(&rec.ID, &rec.Topic, &rec.Payload, &rec.Headers, &rec.CreatedAt); err != nil {
 			_ = rows.Close()
 			_ = tx.Rollback()
 			return nil, nil, fmt.Errorf("scan outbox: %w", err)
@@ -185,6 +187,15 @@ func (w *Worker) publishWithRetry(ctx context.Context, rec record) error {
 	}
 	msg := nats.NewMsg(rec.Topic)
 	msg.Data = rec.Payload
+	if len(rec.Headers) > 0 {
+		var header nats.Header
+		if err := json.Unmarshal(rec.Headers, &header); err != nil {
+			return fmt.Errorf("decode outbox %d headers: %w", rec.ID, err)
+		}
+		for key, values := range header {
+			msg.Header[key] = values
+		}
+	}
 	if sc := span.SpanContext(); sc.IsValid() {
 		msg.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID()))
 	}
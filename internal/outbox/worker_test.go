@@ -133,6 +133,7 @@ func prepareOutboxTable(t *testing.T, ctx context.Context, db *sql.DB) {
 id SERIAL PRIMARY KEY,
 topic TEXT,
 payload BYTEA,
+headers JSONB,
 published BOOLEAN DEFAULT FALSE,
 created_at TIMESTAMPTZ DEFAULT now()
 )`
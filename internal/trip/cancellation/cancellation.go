@@ -0,0 +1,84 @@
+package cancellation
+
+import (
+	"slices"
+	"time"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// Policy sets what cancelling a trip of one vehicle type costs. Both parties
+// cancel for free until the driver accepts; after that each has a grace
+// period, measured from acceptance, before a charge applies.
+type Policy struct {
+	// RiderGraceSeconds is how long after acceptance the rider cancels for free.
+	RiderGraceSeconds int64 `json:"rider_grace_seconds"`
+	// RiderFeeCents is charged to a rider cancelling after the grace period.
+	RiderFeeCents int64 `json:"rider_fee_cents"`
+	// DriverGraceSeconds is how long after accepting the driver cancels
+	// without penalty.
+	DriverGraceSeconds int64 `json:"driver_grace_seconds"`
+	// DriverPenaltyCents is charged to a driver cancelling after the grace period.
+	DriverPenaltyCents int64 `json:"driver_penalty_cents"`
+	// WaivedReasons never incur a charge, whoever gives them.
+	WaivedReasons []domain.CancellationReason `json:"waived_reasons,omitempty"`
+}
+
+// DefaultPolicies returns the policies used when none are configured.
+func DefaultPolicies() map[string]Policy {
+	waived := []domain.CancellationReason{domain.ReasonDriverUnsafePickup}
+	return map[string]Policy{
+		"economy":   {RiderGraceSeconds: 120, RiderFeeCents: 500, DriverGraceSeconds: 120, DriverPenaltyCents: 300, WaivedReasons: waived},
+		"comfort":   {RiderGraceSeconds: 120, RiderFeeCents: 650, DriverGraceSeconds: 120, DriverPenaltyCents: 400, WaivedReasons: waived},
+		"xl":        {RiderGraceSeconds: 120, RiderFeeCents: 800, DriverGraceSeconds: 120, DriverPenaltyCents: 500, WaivedReasons: waived},
+		"motorbike": {RiderGraceSeconds: 60, RiderFeeCents: 300, DriverGraceSeconds: 60, DriverPenaltyCents: 200, WaivedReasons: waived},
+		"pool":      {RiderGraceSeconds: 120, RiderFeeCents: 300, DriverGraceSeconds: 120, DriverPenaltyCents: 200, WaivedReasons: waived},
+	}
+}
+
+// Charge is the outcome of applying a policy to a cancellation.
+type Charge struct {
+	// FeeCents is charged to the rider.
+	FeeCents int64
+	// PenaltyCents is charged to the driver.
+	PenaltyCents int64
+}
+
+// Engine applies per vehicle type policies. Vehicle types without a policy
+// cancel for free.
+type Engine struct {
+	policies map[string]Policy
+}
+
+// NewEngine constructs an engine. A nil map falls back to DefaultPolicies.
+func NewEngine(policies map[string]Policy) *Engine {
+	if policies == nil {
+		policies = DefaultPolicies()
+	}
+	copied := make(map[string]Policy, len(policies))
+	for vehicleType, policy := range policies {
+		copied[vehicleType] = policy
+	}
+	return &Engine{policies: copied}
+}
+
+// Decide returns what the party cancelling as actor owes when cancelling trip
+// at now for reason.
+func (e *Engine) Decide(trip domain.Trip, actor domain.TripStatus, reason domain.CancellationReason, now time.Time) Charge {
+	policy, ok := e.policies[trip.VehicleType]
+	if !ok || trip.AcceptedAt == nil || slices.Contains(policy.WaivedReasons, reason) {
+		return Charge{}
+	}
+	sinceAccept := now.Sub(*trip.AcceptedAt)
+	switch actor {
+	case domain.StatusCancelledRider:
+		if sinceAccept >= time.Duration(policy.RiderGraceSeconds)*time.Second {
+			return Charge{FeeCents: policy.RiderFeeCents}
+		}
+	case domain.StatusCancelledDriver:
+		if sinceAccept >= time.Duration(policy.DriverGraceSeconds)*time.Second {
+			return Charge{PenaltyCents: policy.DriverPenaltyCents}
+		}
+	}
+	return Charge{}
+}
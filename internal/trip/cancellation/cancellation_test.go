@@ -0,0 +1,47 @@
+package cancellation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/cancellation"
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+func TestDecideChargesByTimeSinceAcceptance(t *testing.T) {
+	engine := cancellation.NewEngine(map[string]cancellation.Policy{
+		"sedan": {
+			RiderGraceSeconds:  120,
+			RiderFeeCents:      500,
+			DriverGraceSeconds: 60,
+			DriverPenaltyCents: 300,
+			WaivedReasons:      []domain.CancellationReason{domain.ReasonDriverUnsafePickup},
+		},
+	})
+	accepted := time.Unix(1_000, 0).UTC()
+	trip := domain.Trip{VehicleType: "sedan", AcceptedAt: &accepted}
+
+	cases := []struct {
+		name   string
+		trip   domain.Trip
+		actor  domain.TripStatus
+		reason domain.CancellationReason
+		after  time.Duration
+		want   cancellation.Charge
+	}{
+		{name: "not accepted yet", trip: domain.Trip{VehicleType: "sedan"}, actor: domain.StatusCancelledRider, after: time.Hour},
+		{name: "rider within grace", trip: trip, actor: domain.StatusCancelledRider, after: 119 * time.Second},
+		{name: "rider after grace", trip: trip, actor: domain.StatusCancelledRider, after: 120 * time.Second, want: cancellation.Charge{FeeCents: 500}},
+		{name: "driver within grace", trip: trip, actor: domain.StatusCancelledDriver, after: 59 * time.Second},
+		{name: "driver after grace", trip: trip, actor: domain.StatusCancelledDriver, after: time.Minute, want: cancellation.Charge{PenaltyCents: 300}},
+		{name: "waived reason", trip: trip, actor: domain.StatusCancelledDriver, reason: domain.ReasonDriverUnsafePickup, after: time.Hour},
+		{name: "no policy", trip: domain.Trip{VehicleType: "suv", AcceptedAt: &accepted}, actor: domain.StatusCancelledRider, after: time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, engine.Decide(tc.trip, tc.actor, tc.reason, accepted.Add(tc.after)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// ErrUnknownProduct indicates a vehicle type that is not in the catalog.
+var ErrUnknownProduct = domain.ErrUnknownVehicleType
+
+// Product codes of the default catalog. A trip's VehicleType holds one of them.
+const (
+	Economy   = "economy"
+	Comfort   = "comfort"
+	XL        = "xl"
+	Motorbike = "motorbike"
+	Pool      = "pool"
+)
+
+// Product is a ride option riders can request.
+type Product struct {
+	// Code identifies the product; trips and drivers refer to it as their
+	// vehicle type.
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Seats is how many riders the vehicle carries.
+	Seats int `json:"seats"`
+	// PricingKey selects the product's rate card, so several products can
+	// share one tariff.
+	PricingKey string `json:"pricing_key"`
+	// Shared products pool riders: a driver on such a trip can pick up more
+	// riders of the same product while seats are free.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// DefaultProducts returns the catalog used when none is configured.
+func DefaultProducts() []Product {
+	return []Product{
+		{Code: Economy, Name: "Economy", Seats: 4, PricingKey: Economy},
+		{Code: Comfort, Name: "Comfort", Seats: 4, PricingKey: Comfort},
+		{Code: XL, Name: "XL", Seats: 6, PricingKey: XL},
+		{Code: Motorbike, Name: "Motorbike", Seats: 1, PricingKey: Motorbike},
+		{Code: Pool, Name: "Pool", Seats: 3, PricingKey: Pool, Shared: true},
+	}
+}
+
+// Catalog resolves vehicle types to products.
+type Catalog struct {
+	products []Product
+	byCode   map[string]Product
+}
+
+// New constructs a catalog. A nil slice falls back to DefaultProducts.
+// Products need a unique code and at least one seat; an empty pricing key
+// defaults to the code.
+func New(products []Product) (*Catalog, error) {
+	if products == nil {
+		products = DefaultProducts()
+	}
+	c := &Catalog{byCode: make(map[string]Product, len(products))}
+	for _, p := range products {
+		if p.Code == "" {
+			return nil, errors.New("product without code")
+		}
+		if _, dup := c.byCode[p.Code]; dup {
+			return nil, fmt.Errorf("duplicate product %q", p.Code)
+		}
+		if p.Seats <= 0 {
+			return nil, fmt.Errorf("product %q: seats must be positive", p.Code)
+		}
+		if p.PricingKey == "" {
+			p.PricingKey = p.Code
+		}
+		c.products = append(c.products, p)
+		c.byCode[p.Code] = p
+	}
+	return c, nil
+}
+
+// Default returns the catalog of DefaultProducts.
+func Default() *Catalog {
+	c, err := New(DefaultProducts())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Lookup returns the product with code, or ErrUnknownProduct.
+func (c *Catalog) Lookup(code string) (Product, error) {
+	p, ok := c.byCode[code]
+	if !ok {
+		return Product{}, fmt.Errorf("%w: %q", ErrUnknownProduct, code)
+	}
+	return p, nil
+}
+
+// Products lists the catalog in its configured order.
+func (c *Catalog) Products() []Product {
+	return append([]Product(nil), c.products...)
+}
@@ -0,0 +1,32 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/catalog"
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+func TestCatalogResolvesProductsAndRejectsInvalidOnes(t *testing.T) {
+	c, err := catalog.New([]catalog.Product{
+		{Code: "economy", Name: "Economy", Seats: 4},
+		{Code: "economy_green", Name: "Economy Green", Seats: 4, PricingKey: "economy"},
+	})
+	require.NoError(t, err)
+
+	product, err := c.Lookup("economy")
+	require.NoError(t, err)
+	require.Equal(t, "economy", product.PricingKey)
+	product, err = c.Lookup("economy_green")
+	require.NoError(t, err)
+	require.Equal(t, "economy", product.PricingKey)
+	_, err = c.Lookup("sedan")
+	require.ErrorIs(t, err, domain.ErrUnknownVehicleType)
+
+	_, err = catalog.New([]catalog.Product{{Code: "xl", Seats: 6}, {Code: "xl", Seats: 7}})
+	require.Error(t, err)
+	_, err = catalog.New([]catalog.Product{{Code: "xl"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// ErrActiveTrip is returned when a rider or driver would end up on two active
+// trips at once. The concrete error is an *ActiveTripError.
+var ErrActiveTrip = errors.New("active trip already exists")
+
+// Party names who holds a conflicting active trip.
+type Party string
+
+const (
+	PartyRider  Party = "rider"
+	PartyDriver Party = "driver"
+)
+
+// ActiveTripError reports the trip that blocks another one. TripID may be nil
+// when the conflict was detected by a storage constraint; callers resolve it
+// with a search for the party's active trip.
+type ActiveTripError struct {
+	Party  Party
+	TripID uuid.UUID
+}
+
+func (e *ActiveTripError) Error() string {
+	if e.TripID == uuid.Nil {
+		return fmt.Sprintf("%s already has an active trip", e.Party)
+	}
+	return fmt.Sprintf("%s already has active trip %s", e.Party, e.TripID)
+}
+
+// Unwrap lets errors.Is match ErrActiveTrip.
+func (e *ActiveTripError) Unwrap() error { return ErrActiveTrip }
+
+// ActiveStatuses lists the statuses in which a trip occupies its rider and,
+// once one is assigned, its driver. Scheduled rides only become active when
+// they are released to matching.
+func ActiveStatuses() []TripStatus {
+	return []TripStatus{
+		StatusRequested,
+		StatusDriverAssigned,
+		StatusDriverAccepted,
+		StatusPickupEnRoute,
+		StatusArrived,
+		StatusInProgress,
+	}
+}
+
+// Active reports whether t is in one of ActiveStatuses.
+func (t Trip) Active() bool {
+	return slices.Contains(ActiveStatuses(), t.Status)
+}
+
+// ConflictsWith returns an *ActiveTripError when t and other are distinct
+// active trips sharing a rider, or sharing a driver without riding the same
+// pool, and nil otherwise.
+func (t Trip) ConflictsWith(other Trip) error {
+	if t.ID == other.ID || !t.Active() || !other.Active() {
+		return nil
+	}
+	if t.RiderID == other.RiderID {
+		return &ActiveTripError{Party: PartyRider, TripID: other.ID}
+	}
+	if t.DriverID != nil && other.DriverID != nil && *t.DriverID == *other.DriverID && t.PoolKey() != other.PoolKey() {
+		return &ActiveTripError{Party: PartyDriver, TripID: other.ID}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidAdjustment is returned for adjustments of an unknown kind, with
+	// an amount of the wrong sign or that would refund more than was charged.
+	ErrInvalidAdjustment = errors.New("invalid fare adjustment")
+	// ErrTipWindowClosed is returned when a tip is added too long after the
+	// trip finished.
+	ErrTipWindowClosed = errors.New("tip window closed")
+	// ErrSupportOnly is returned when a caller who is not an admin refunds or
+	// corrects a fare.
+	ErrSupportOnly = errors.New("only support may refund or correct a fare")
+	// ErrAdjustmentsUnavailable is returned when no adjustment store is
+	// configured.
+	ErrAdjustmentsUnavailable = errors.New("fare adjustments unavailable")
+)
+
+// AdjustmentKind classifies a change to a completed trip's fare.
+type AdjustmentKind string
+
+const (
+	// AdjustmentTip is added by the rider and always increases the total.
+	AdjustmentTip AdjustmentKind = "tip"
+	// AdjustmentRefund is issued by support and always decreases the total.
+	AdjustmentRefund AdjustmentKind = "refund"
+	// AdjustmentCorrection is a support correction in either direction.
+	AdjustmentCorrection AdjustmentKind = "adjustment"
+)
+
+// MaxAdjustmentReason bounds the length of an adjustment's reason.
+const MaxAdjustmentReason = 200
+
+// DefaultTipWindow is how long after completion a rider can add a tip.
+const DefaultTipWindow = 72 * time.Hour
+
+// FareAdjustment is an immutable change to a completed trip's fare. Records
+// are only ever appended; a mistaken adjustment is undone by another one.
+type FareAdjustment struct {
+	ID     uuid.UUID      `json:"id"`
+	TripID uuid.UUID      `json:"trip_id"`
+	Kind   AdjustmentKind `json:"kind"`
+	// AmountCents is added to the trip's total: positive for tips and
+	// surcharges, negative for refunds.
+	AmountCents int64  `json:"amount_cents"`
+	Reason      string `json:"reason,omitempty"`
+	// ActorID is the rider adding a tip or the support agent adjusting the fare.
+	ActorID   uuid.UUID `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the amount's sign against the kind and that support
+// adjustments carry a reason.
+func (a FareAdjustment) Validate() error {
+	if a.ActorID == uuid.Nil {
+		return fmt.Errorf("%w: actor required", ErrInvalidAdjustment)
+	}
+	switch a.Kind {
+	case AdjustmentTip:
+		if a.AmountCents <= 0 {
+			return fmt.Errorf("%w: tips must be positive", ErrInvalidAdjustment)
+		}
+	case AdjustmentRefund:
+		if a.AmountCents >= 0 {
+			return fmt.Errorf("%w: refunds must be negative", ErrInvalidAdjustment)
+		}
+	case AdjustmentCorrection:
+		if a.AmountCents == 0 {
+			return fmt.Errorf("%w: amount required", ErrInvalidAdjustment)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidAdjustment, a.Kind)
+	}
+	if a.Kind != AdjustmentTip && a.Reason == "" {
+		return fmt.Errorf("%w: %s requires a reason", ErrInvalidAdjustment, a.Kind)
+	}
+	if utf8.RuneCountInString(a.Reason) > MaxAdjustmentReason {
+		return fmt.Errorf("%w: reason longer than %d characters", ErrInvalidAdjustment, MaxAdjustmentReason)
+	}
+	return nil
+}
+
+// TotalCents is what the rider pays for the trip once adjustments are applied.
+func (t Trip) TotalCents() int64 {
+	return t.PriceCents + t.AdjustmentCents
+}
+
+// ApplyAdjustment adds a to the trip's adjustments. Adjustments never take
+// the total below zero.
+func (t *Trip) ApplyAdjustment(a FareAdjustment) error {
+	if t.Status != StatusCompleted {
+		return fmt.Errorf("%w: cannot adjust the fare of a %s trip", ErrInvalidTransition, t.Status)
+	}
+	if t.TotalCents()+a.AmountCents < 0 {
+		return fmt.Errorf("%w: refund exceeds the %d cents charged", ErrInvalidAdjustment, t.TotalCents())
+	}
+	t.AdjustmentCents += a.AmountCents
+	return nil
+}
+
+// FareTotal returns fareCents with every adjustment applied.
+func FareTotal(fareCents int64, adjustments []FareAdjustment) int64 {
+	total := fareCents
+	for _, a := range adjustments {
+		total += a.AmountCents
+	}
+	return total
+}
+
+// FareAdjustmentRepository appends and lists fare adjustments. There is
+// deliberately no way to change or remove a stored adjustment.
+type FareAdjustmentRepository interface {
+	CreateFareAdjustment(ctx context.Context, adjustment FareAdjustment) error
+	// ListFareAdjustments returns a trip's adjustments oldest first.
+	ListFareAdjustments(ctx context.Context, tripID uuid.UUID) ([]FareAdjustment, error)
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "math"
+
+const earthRadiusMeters = 6371000.0
+
+// HaversineMeters returns the great-circle distance between a and b.
+func HaversineMeters(a, b GeoPoint) float64 {
+	lat1 := toRadians(a.Lat)
+	lat2 := toRadians(b.Lat)
+	dlat := toRadians(b.Lat - a.Lat)
+	dlon := toRadians(b.Lng - a.Lng)
+
+	sinDlat := math.Sin(dlat / 2)
+	sinDlon := math.Sin(dlon / 2)
+	aa := sinDlat*sinDlat + math.Cos(lat1)*math.Cos(lat2)*sinDlon*sinDlon
+	c := 2 * math.Atan2(math.Sqrt(aa), math.Sqrt(1-aa))
+	return earthRadiusMeters * c
+}
+
+// RouteMeters sums the great-circle distances of consecutive legs of route.
+func RouteMeters(route ...GeoPoint) float64 {
+	var total float64
+	for i := 1; i < len(route); i++ {
+		total += HaversineMeters(route[i-1], route[i])
+	}
+	return total
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+// polylinePrecision is the coordinate scale of the encoded polyline format,
+// five decimal places.
+const polylinePrecision = 1e5
+
+// EncodePolyline encodes points in the encoded polyline algorithm format
+// understood by common map SDKs.
+func EncodePolyline(points []GeoPoint) string {
+	var (
+		buf              []byte
+		prevLat, prevLng int64
+	)
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * polylinePrecision))
+		lng := int64(math.Round(p.Lng * polylinePrecision))
+		buf = appendPolylineValue(buf, lat-prevLat)
+		buf = appendPolylineValue(buf, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return string(buf)
+}
+
+func appendPolylineValue(buf []byte, v int64) []byte {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		buf = append(buf, byte((0x20|(u&0x1f))+63))
+		u >>= 5
+	}
+	return append(buf, byte(u+63))
+}
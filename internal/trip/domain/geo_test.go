@@ -0,0 +1,15 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+func TestEncodePolylineMatchesReferenceEncoding(t *testing.T) {
+	points := []domain.GeoPoint{{Lat: 38.5, Lng: -120.2}, {Lat: 40.7, Lng: -120.95}, {Lat: 43.252, Lng: -126.453}}
+	require.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", domain.EncodePolyline(points))
+	require.Empty(t, domain.EncodePolyline(nil))
+}
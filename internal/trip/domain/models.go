@@ -12,18 +12,102 @@ import (
 type TripStatus string
 
 const (
+	StatusScheduled       TripStatus = "SCHEDULED"
 	StatusRequested       TripStatus = "REQUESTED"
 	StatusDriverAssigned  TripStatus = "DRIVER_ASSIGNED"
 	StatusDriverAccepted  TripStatus = "DRIVER_ACCEPTED"
 	StatusPickupEnRoute   TripStatus = "PICKUP_EN_ROUTE"
+	StatusArrived         TripStatus = "ARRIVED"
 	StatusInProgress      TripStatus = "IN_PROGRESS"
 	StatusCompleted       TripStatus = "COMPLETED"
 	StatusCancelledRider  TripStatus = "CANCELLED_BY_RIDER"
 	StatusCancelledDriver TripStatus = "CANCELLED_BY_DRIVER"
+	// StatusNoDriverFound ends a trip nobody could be matched to in time.
+	StatusNoDriverFound TripStatus = "NO_DRIVER_FOUND"
 )
 
-// ErrInvalidTransition is returned when a state transition is not allowed.
-var ErrInvalidTransition = errors.New("invalid trip state transition")
+var (
+	// ErrInvalidTransition is returned when a state transition is not allowed.
+	ErrInvalidTransition = errors.New("invalid trip state transition")
+	// ErrTripNotFound is returned when a trip does not exist.
+	ErrTripNotFound = errors.New("trip not found")
+	// ErrVersionConflict is returned when an update was based on a stale trip version.
+	ErrVersionConflict = errors.New("trip version conflict")
+	// ErrWaitingWindowOpen is returned when a no-show is recorded before the
+	// rider's free waiting time has elapsed.
+	ErrWaitingWindowOpen = errors.New("free waiting window has not elapsed")
+	// ErrNoDriverAvailable is returned by matching engines when no driver could be reserved.
+	ErrNoDriverAvailable = errors.New("no driver available")
+	// ErrAcceptDeadlineNotReached is returned when an assignment is expired
+	// while the driver can still accept it.
+	ErrAcceptDeadlineNotReached = errors.New("acceptance deadline not reached")
+	// ErrMatchTimeoutNotReached is returned when an unmatched trip is expired
+	// while matching may still find a driver.
+	ErrMatchTimeoutNotReached = errors.New("matching timeout not reached")
+	// ErrUnknownVehicleType is returned when no rate card exists for a vehicle type.
+	ErrUnknownVehicleType = errors.New("unknown vehicle type")
+	// ErrQuoteInvalid is returned for quote tokens that are malformed, forged
+	// or do not match the trip being requested.
+	ErrQuoteInvalid = errors.New("invalid quote token")
+	// ErrQuoteExpired is returned for quote tokens presented after their expiry.
+	ErrQuoteExpired = errors.New("quote token expired")
+	// ErrQuotesUnavailable is returned when quoting is not configured.
+	ErrQuotesUnavailable = errors.New("upfront quotes unavailable")
+	// ErrInvalidPickupTime is returned when a scheduled pickup is too soon or
+	// too far ahead to be booked.
+	ErrInvalidPickupTime = errors.New("invalid pickup time")
+	// ErrLeadWindowNotStarted is returned when a scheduled trip is released
+	// to matching before its lead window.
+	ErrLeadWindowNotStarted = errors.New("scheduled pickup lead window not started")
+	// ErrPickupGraceNotElapsed is returned when a scheduled trip is expired
+	// before its pickup grace period has passed.
+	ErrPickupGraceNotElapsed = errors.New("scheduled pickup grace period not elapsed")
+	// ErrNoPendingStop is returned when a stop is reached but every stop was
+	// already visited.
+	ErrNoPendingStop = errors.New("no pending stop")
+	// ErrNotAtStop is returned when leaving a stop the driver has not reached.
+	ErrNotAtStop = errors.New("driver is not at a stop")
+	// ErrTooManyStops is returned when a trip requests more stops than allowed.
+	ErrTooManyStops = errors.New("too many stops")
+	// ErrInvalidCancelReason is returned for a reason code the cancelling
+	// party may not give.
+	ErrInvalidCancelReason = errors.New("invalid cancellation reason")
+	// ErrUnauthenticated is returned when an operation acting for a user is
+	// called without the user's claims.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// CancellationReason explains why a trip was cancelled.
+type CancellationReason string
+
+const (
+	ReasonRiderNoShow CancellationReason = "rider_no_show"
+
+	// Reasons a rider may give.
+	ReasonRiderChangedPlans    CancellationReason = "rider_changed_plans"
+	ReasonRiderDriverTooFar    CancellationReason = "rider_driver_too_far"
+	ReasonRiderBookedByMistake CancellationReason = "rider_booked_by_mistake"
+	ReasonRiderOther           CancellationReason = "rider_other"
+
+	// Reasons a driver may give.
+	ReasonDriverRiderUnreachable CancellationReason = "driver_rider_unreachable"
+	ReasonDriverVehicleIssue     CancellationReason = "driver_vehicle_issue"
+	ReasonDriverUnsafePickup     CancellationReason = "driver_unsafe_pickup"
+	ReasonDriverOther            CancellationReason = "driver_other"
+)
+
+// CancellationReasons lists the reasons the party cancelling as actor
+// (StatusCancelledRider or StatusCancelledDriver) may give. The first entry is
+// the catch-all used when no reason is given.
+func CancellationReasons(actor TripStatus) []CancellationReason {
+	switch actor {
+	case StatusCancelledRider:
+		return []CancellationReason{ReasonRiderOther, ReasonRiderChangedPlans, ReasonRiderDriverTooFar, ReasonRiderBookedByMistake}
+	case StatusCancelledDriver:
+		return []CancellationReason{ReasonDriverOther, ReasonDriverRiderUnreachable, ReasonDriverVehicleIssue, ReasonDriverUnsafePickup}
+	}
+	return nil
+}
 
 // GeoPoint captures latitude and longitude using WGS84.
 type GeoPoint struct {
@@ -31,6 +115,13 @@ type GeoPoint struct {
 	Lng float64 `json:"lng"`
 }
 
+// Stop is an intermediate waypoint between pickup and dropoff.
+type Stop struct {
+	Point      GeoPoint   `json:"point"`
+	ArrivedAt  *time.Time `json:"arrived_at,omitempty"`
+	DepartedAt *time.Time `json:"departed_at,omitempty"`
+}
+
 // Trip aggregates the data required to manage a ride lifecycle.
 type Trip struct {
 	ID          uuid.UUID
@@ -43,24 +134,132 @@ type Trip struct {
 	Status      TripStatus
 	RequestedAt time.Time
 	AcceptedAt  *time.Time
+	ArrivedAt   *time.Time
 	StartedAt   *time.Time
 	FinishedAt  *time.Time
 	CancelledAt *time.Time
 	CancelledBy *TripStatus
 	PriceCents  int64
 	Version     int64
+
+	CancelReason         CancellationReason
+	CancellationFeeCents int64
+	// DriverPenaltyCents is charged to the driver for a late cancellation.
+	DriverPenaltyCents int64
+	// AdjustmentCents sums the FareAdjustment records of a completed trip;
+	// TotalCents is what the rider ends up paying.
+	AdjustmentCents int64
+
+	// AcceptDeadline is when the assigned driver's offer lapses.
+	AcceptDeadline *time.Time
+	// DeclinedDrivers lists drivers that declined the trip or let the offer
+	// expire; they are excluded when the trip is dispatched again.
+	DeclinedDrivers []uuid.UUID
+	// FareBreakdown itemises how PriceCents was calculated.
+	FareBreakdown []FareLine
+	// QuoteID references the upfront quote the rider accepted, if any.
+	QuoteID *uuid.UUID
+	// UpfrontPriceCents is the price agreed when the trip was requested; it
+	// overrides the metered fare on completion.
+	UpfrontPriceCents int64
+	// PickupAt is the requested pickup time of a ride booked in advance.
+	PickupAt *time.Time
+	// RemindersSent counts the scheduled ride reminders already emitted.
+	RemindersSent int
+	// Stops are visited in order between Pickup and Dropoff.
+	Stops []Stop
+	// Seats is how many seats the rider books.
+	Seats int
+	// PoolID names the shared route of a pooled trip that joined a driver
+	// already carrying another rider.
+	PoolID *uuid.UUID
+	// DrivenMeters is the distance measured from the driver's breadcrumbs
+	// when the trip completed, zero when none were recorded.
+	DrivenMeters int64
+	// RateCard is the product's tariff when the trip was requested; the trip
+	// is priced from it even if the product or tariff changes later. Trips
+	// requested before tariffs were recorded have none.
+	RateCard *RateCard
+}
+
+// Route returns the pickup, every stop and the dropoff in travel order.
+func (t Trip) Route() []GeoPoint {
+	route := make([]GeoPoint, 0, len(t.Stops)+2)
+	route = append(route, t.Pickup)
+	for _, stop := range t.Stops {
+		route = append(route, stop.Point)
+	}
+	return append(route, t.Dropoff)
+}
+
+// NextStop returns the index of the first stop not reached yet, or -1.
+func (t Trip) NextStop() int {
+	for i, stop := range t.Stops {
+		if stop.ArrivedAt == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// CurrentStop returns the index of the stop the driver is waiting at, or -1.
+func (t Trip) CurrentStop() int {
+	for i, stop := range t.Stops {
+		if stop.ArrivedAt != nil && stop.DepartedAt == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// RateCard holds one tariff.
+type RateCard struct {
+	BaseFareCents    int64 `json:"base_fare_cents"`
+	PerKMCents       int64 `json:"per_km_cents"`
+	PerMinuteCents   int64 `json:"per_minute_cents"`
+	PerStopCents     int64 `json:"per_stop_cents"`
+	MinimumFareCents int64 `json:"minimum_fare_cents"`
+}
+
+// FareLine is a single item of a trip's fare.
+type FareLine struct {
+	Code        string `json:"code"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// HasDeclined reports whether driverID previously declined the trip.
+func (t Trip) HasDeclined(driverID uuid.UUID) bool {
+	for _, id := range t.DeclinedDrivers {
+		if id == driverID {
+			return true
+		}
+	}
+	return false
 }
 
 // TripEventType enumerates domain events published by the service.
 type TripEventType string
 
 const (
-	EventTripRequested  TripEventType = "TripRequested"
-	EventDriverAssigned TripEventType = "DriverAssigned"
-	EventDriverAccepted TripEventType = "DriverAccepted"
-	EventTripStarted    TripEventType = "TripStarted"
-	EventTripFinished   TripEventType = "TripFinished"
-	EventTripCancelled  TripEventType = "TripCancelled"
+	EventTripScheduled     TripEventType = "TripScheduled"
+	EventScheduleReminder  TripEventType = "ScheduledRideReminder"
+	EventTripReleased      TripEventType = "ScheduledTripReleased"
+	EventTripRequested     TripEventType = "TripRequested"
+	EventDriverAssigned    TripEventType = "DriverAssigned"
+	EventDriverAccepted    TripEventType = "DriverAccepted"
+	EventDriverDeclined    TripEventType = "DriverDeclined"
+	EventAssignmentExpired TripEventType = "AssignmentExpired"
+	EventNoDriverFound     TripEventType = "NoDriverFound"
+	EventTripExpired       TripEventType = "TripExpired"
+	EventDriverEnRoute     TripEventType = "DriverEnRoute"
+	EventDriverArrived     TripEventType = "DriverArrived"
+	EventTripStarted       TripEventType = "TripStarted"
+	EventStopReached       TripEventType = "StopReached"
+	EventStopDeparted      TripEventType = "StopDeparted"
+	EventTripFinished      TripEventType = "TripFinished"
+	EventTripCancelled     TripEventType = "TripCancelled"
+	EventTripRated         TripEventType = "TripRated"
+	EventFareAdjusted      TripEventType = "FareAdjusted"
 )
 
 // TripEvent captures a domain event for the outbox pattern.
@@ -68,7 +267,7 @@ type TripEvent struct {
 	ID        int64
 	TripID    uuid.UUID
 	Type      TripEventType
-	Payload   map[string]any
+	Payload   EventPayload
 	CreatedAt time.Time
 }
 
@@ -76,14 +275,41 @@ type TripEvent struct {
 type Repository interface {
 	CreateTrip(ctx context.Context, trip Trip) (Trip, error)
 	GetTripByID(ctx context.Context, id uuid.UUID) (Trip, error)
+	// UpdateTrip persists trip only if the stored version still equals
+	// trip.Version, returning ErrVersionConflict otherwise.
 	UpdateTrip(ctx context.Context, trip Trip) (Trip, error)
 	CreateTripEvent(ctx context.Context, event TripEvent) error
+	// ListTripEvents returns the events of a trip in the order they were recorded.
+	ListTripEvents(ctx context.Context, tripID uuid.UUID) ([]TripEvent, error)
+	// ListTripsByStatus returns up to limit trips in status, oldest request first.
+	ListTripsByStatus(ctx context.Context, status TripStatus, limit int) ([]Trip, error)
+	// ListScheduledTrips returns up to limit SCHEDULED trips picking up after
+	// pickupAfter and at or before pickupBefore, earliest pickup first.
+	ListScheduledTrips(ctx context.Context, pickupAfter, pickupBefore time.Time, limit int) ([]Trip, error)
+	// ListUnmatchedTrips returns up to limit REQUESTED trips whose matching,
+	// per Trip.MatchingStartedAt(lead), started at or before startedBefore,
+	// earliest start first.
+	ListUnmatchedTrips(ctx context.Context, startedBefore time.Time, lead time.Duration, limit int) ([]Trip, error)
+	// SearchTrips returns up to limit trips matching filter, newest request
+	// first, starting after the cursor when one is given.
+	SearchTrips(ctx context.Context, filter TripFilter, after *TripCursor, limit int) ([]Trip, error)
 }
 
-// IdempotencyRepository stores request/response pairs for idempotent APIs.
-type IdempotencyRepository interface {
-	GetResponse(ctx context.Context, key string) ([]byte, bool, error)
-	PutResponse(ctx context.Context, key string, payload []byte) error
+// Tx exposes the stores bound to a single unit of work. Everything written
+// through it is committed or rolled back together.
+type Tx interface {
+	Trips() Repository
+	Ratings() RatingRepository
+	Adjustments() FareAdjustmentRepository
+	Pools() PoolRepository
+	Outbox() EventPublisher
+}
+
+// UnitOfWork runs fn inside one transaction so the trip row, its trip_events
+// entry and the outbox message are persisted atomically. A non-nil error from
+// fn rolls the transaction back.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(tx Tx) error) error
 }
 
 // LocationSnapshot is cached to Redis for ETA/matching decisions.
@@ -95,12 +321,29 @@ type LocationSnapshot struct {
 	Updated  time.Time
 }
 
-// MatchingEngine selects a driver for a trip request.
+// SeatReserver is implemented by matching engines that can seat a rider in
+// a vehicle already carrying others, as pooled rides need.
+type SeatReserver interface {
+	// PoolCandidates lists up to k drivers of trip's vehicle type near its
+	// pickup, closest first.
+	PoolCandidates(ctx context.Context, trip Trip, k int) ([]uuid.UUID, error)
+	// ReserveSeats holds trip's seats in driverID's vehicle of capacity seats,
+	// counting the seats of the driver's current trips.
+	ReserveSeats(ctx context.Context, driverID uuid.UUID, trip Trip, capacity int) (bool, error)
+	// ReleaseSeats frees the seats held for tripID only.
+	ReleaseSeats(ctx context.Context, driverID, tripID uuid.UUID) error
+}
+
+// MatchingEngine selects a driver for a trip request. Implementations must
+// skip drivers listed in trip.DeclinedDrivers.
 type MatchingEngine interface {
 	ReserveDriver(ctx context.Context, trip Trip) (*uuid.UUID, error)
+	// ReleaseDriver frees a reservation so the driver can be offered other trips.
+	ReleaseDriver(ctx context.Context, driverID uuid.UUID) error
 }
 
-// EventPublisher publishes domain events via the outbox worker.
+// EventPublisher hands domain events to the outbox. Inside a unit of work it
+// enqueues an outbox row; the outbox worker is responsible for NATS delivery.
 type EventPublisher interface {
 	Publish(ctx context.Context, event TripEvent) error
 }
@@ -0,0 +1,303 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/pkg/jsonschema"
+)
+
+// ErrUnknownEventType is returned for event types without a registered
+// payload.
+var ErrUnknownEventType = errors.New("unknown trip event type")
+
+// EventPayload is the typed body of a trip event. Every TripEventType has
+// exactly one payload type; its JSON form is the contract with consumers of
+// trip events.
+type EventPayload interface {
+	EventType() TripEventType
+}
+
+// TripRequestedPayload carries every field a new trip starts with, so the
+// trip can be rebuilt from its events alone.
+type TripRequestedPayload struct {
+	RiderID           uuid.UUID  `json:"rider_id"`
+	Pickup            GeoPoint   `json:"pickup"`
+	Dropoff           GeoPoint   `json:"dropoff"`
+	VehicleType       string     `json:"vehicle_type"`
+	Seats             int        `json:"seats"`
+	Stops             []GeoPoint `json:"stops,omitempty"`
+	QuoteID           *uuid.UUID `json:"quote_id,omitempty"`
+	UpfrontPriceCents int64      `json:"upfront_price_cents,omitempty"`
+	RateCard          *RateCard  `json:"rate_card,omitempty"`
+}
+
+// TripScheduledPayload is TripRequestedPayload for a ride booked in advance.
+type TripScheduledPayload struct {
+	TripRequestedPayload
+	PickupAt time.Time `json:"pickup_at"`
+}
+
+// ScheduleReminderPayload reminds the rider of an upcoming scheduled ride.
+type ScheduleReminderPayload struct {
+	RiderID         uuid.UUID `json:"rider_id"`
+	PickupAt        time.Time `json:"pickup_at"`
+	MinutesToPickup int64     `json:"minutes_to_pickup"`
+	RemindersSent   int       `json:"reminders_sent"`
+}
+
+// TripReleasedPayload marks a scheduled ride handed to matching.
+type TripReleasedPayload struct {
+	PickupAt time.Time `json:"pickup_at"`
+}
+
+// DriverAssignedPayload offers the trip to a driver until AcceptDeadline.
+type DriverAssignedPayload struct {
+	DriverID       uuid.UUID `json:"driver_id"`
+	AcceptDeadline time.Time `json:"accept_deadline"`
+	// PoolID is set when the trip joins the driver's shared route.
+	PoolID *uuid.UUID `json:"pool_id,omitempty"`
+}
+
+// DriverAcceptedPayload names the driver who accepted the trip.
+type DriverAcceptedPayload struct {
+	DriverID uuid.UUID `json:"driver_id"`
+}
+
+// DriverDeclinedPayload names the driver who turned the trip down.
+type DriverDeclinedPayload struct {
+	DriverID uuid.UUID `json:"driver_id"`
+}
+
+// AssignmentExpiredPayload names the driver who let the offer lapse.
+type AssignmentExpiredPayload struct {
+	DriverID uuid.UUID `json:"driver_id"`
+}
+
+// NoDriverFoundPayload records a matching round that reserved nobody.
+type NoDriverFoundPayload struct {
+	DeclinedCount int `json:"declined_count"`
+}
+
+// TripExpiredPayload ends a trip no driver was matched to in time.
+type TripExpiredPayload struct {
+	// WaitedSeconds is how long matching ran.
+	WaitedSeconds int64 `json:"waited_seconds"`
+	DeclinedCount int   `json:"declined_count"`
+}
+
+// DriverEnRoutePayload is empty: the event itself is the information.
+type DriverEnRoutePayload struct{}
+
+// DriverArrivedPayload is empty; the arrival time is the event's.
+type DriverArrivedPayload struct{}
+
+// TripStartedPayload is empty; the start time is the event's.
+type TripStartedPayload struct{}
+
+// StopReachedPayload names the stop the driver reached.
+type StopReachedPayload struct {
+	StopIndex int      `json:"stop_index"`
+	Point     GeoPoint `json:"point"`
+}
+
+// StopDepartedPayload names the stop the driver left.
+type StopDepartedPayload struct {
+	StopIndex int `json:"stop_index"`
+}
+
+// TripFinishedPayload holds the final fare and what it was based on.
+type TripFinishedPayload struct {
+	PriceCents      int64      `json:"price_cents"`
+	DistanceKM      float64    `json:"distance_km"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	FareBreakdown   []FareLine `json:"fare_breakdown"`
+	// DrivenMeters is set when the distance came from recorded breadcrumbs.
+	DrivenMeters int64 `json:"driven_meters,omitempty"`
+}
+
+// TripCancelledPayload records who cancelled, why, and what it cost.
+type TripCancelledPayload struct {
+	Status       TripStatus         `json:"status"`
+	Reason       CancellationReason `json:"reason"`
+	FeeCents     int64              `json:"fee_cents"`
+	PenaltyCents int64              `json:"penalty_cents"`
+}
+
+// TripRatedPayload announces a rating. Comments are free text and stay out
+// of the event stream.
+type TripRatedPayload struct {
+	RaterID   uuid.UUID `json:"rater_id"`
+	RateeID   uuid.UUID `json:"ratee_id"`
+	RateeRole Party     `json:"ratee_role"`
+	Stars     int       `json:"stars"`
+	Tags      []string  `json:"tags"`
+}
+
+// FareAdjustedPayload mirrors a FareAdjustment and the resulting total.
+type FareAdjustedPayload struct {
+	AdjustmentID uuid.UUID      `json:"adjustment_id"`
+	Kind         AdjustmentKind `json:"kind"`
+	AmountCents  int64          `json:"amount_cents"`
+	Reason       string         `json:"reason"`
+	ActorID      uuid.UUID      `json:"actor_id"`
+	TotalCents   int64          `json:"total_cents"`
+}
+
+func (TripRequestedPayload) EventType() TripEventType     { return EventTripRequested }
+func (TripScheduledPayload) EventType() TripEventType     { return EventTripScheduled }
+func (ScheduleReminderPayload) EventType() TripEventType  { return EventScheduleReminder }
+func (TripReleasedPayload) EventType() TripEventType      { return EventTripReleased }
+func (DriverAssignedPayload) EventType() TripEventType    { return EventDriverAssigned }
+func (DriverAcceptedPayload) EventType() TripEventType    { return EventDriverAccepted }
+func (DriverDeclinedPayload) EventType() TripEventType    { return EventDriverDeclined }
+func (AssignmentExpiredPayload) EventType() TripEventType { return EventAssignmentExpired }
+func (NoDriverFoundPayload) EventType() TripEventType     { return EventNoDriverFound }
+func (TripExpiredPayload) EventType() TripEventType       { return EventTripExpired }
+func (DriverEnRoutePayload) EventType() TripEventType     { return EventDriverEnRoute }
+func (DriverArrivedPayload) EventType() TripEventType     { return EventDriverArrived }
+func (TripStartedPayload) EventType() TripEventType       { return EventTripStarted }
+func (StopReachedPayload) EventType() TripEventType       { return EventStopReached }
+func (StopDepartedPayload) EventType() TripEventType      { return EventStopDeparted }
+func (TripFinishedPayload) EventType() TripEventType      { return EventTripFinished }
+func (TripCancelledPayload) EventType() TripEventType     { return EventTripCancelled }
+func (TripRatedPayload) EventType() TripEventType         { return EventTripRated }
+func (FareAdjustedPayload) EventType() TripEventType      { return EventFareAdjusted }
+
+// eventSchema registers the payload type of an event type and the version of
+// its schema.
+type eventSchema struct {
+	version int
+	zero    EventPayload
+	decode  func(raw []byte) (EventPayload, error)
+}
+
+func schemaOf[P EventPayload](version int) eventSchema {
+	var zero P
+	return eventSchema{
+		version: version,
+		zero:    zero,
+		decode: func(raw []byte) (EventPayload, error) {
+			var p P
+			if len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+				if err := json.Unmarshal(raw, &p); err != nil {
+					return nil, err
+				}
+			}
+			return p, nil
+		},
+	}
+}
+
+// eventSchemas lists every event type. Bump an event's version when its
+// payload changes in a way existing consumers cannot read; adding optional
+// fields keeps the version.
+var eventSchemas = map[TripEventType]eventSchema{
+	EventTripRequested:     schemaOf[TripRequestedPayload](1),
+	EventTripScheduled:     schemaOf[TripScheduledPayload](1),
+	EventScheduleReminder:  schemaOf[ScheduleReminderPayload](1),
+	EventTripReleased:      schemaOf[TripReleasedPayload](1),
+	EventDriverAssigned:    schemaOf[DriverAssignedPayload](1),
+	EventDriverAccepted:    schemaOf[DriverAcceptedPayload](1),
+	EventDriverDeclined:    schemaOf[DriverDeclinedPayload](1),
+	EventAssignmentExpired: schemaOf[AssignmentExpiredPayload](1),
+	EventNoDriverFound:     schemaOf[NoDriverFoundPayload](1),
+	EventTripExpired:       schemaOf[TripExpiredPayload](1),
+	EventDriverEnRoute:     schemaOf[DriverEnRoutePayload](1),
+	EventDriverArrived:     schemaOf[DriverArrivedPayload](1),
+	EventTripStarted:       schemaOf[TripStartedPayload](1),
+	EventStopReached:       schemaOf[StopReachedPayload](1),
+	EventStopDeparted:      schemaOf[StopDepartedPayload](1),
+	EventTripFinished:      schemaOf[TripFinishedPayload](1),
+	EventTripCancelled:     schemaOf[TripCancelledPayload](1),
+	EventTripRated:         schemaOf[TripRatedPayload](1),
+	EventFareAdjusted:      schemaOf[FareAdjustedPayload](1),
+}
+
+// EventTypes lists every registered event type in name order.
+func EventTypes() []TripEventType {
+	types := make([]TripEventType, 0, len(eventSchemas))
+	for t := range eventSchemas {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// EventSchemaVersion returns the schema version of t's payload, or 0 for an
+// unknown type.
+func EventSchemaVersion(t TripEventType) int {
+	return eventSchemas[t].version
+}
+
+// EventSchema describes the payload of one event type.
+type EventSchema struct {
+	Type    TripEventType      `json:"type"`
+	Version int                `json:"version"`
+	Schema  *jsonschema.Schema `json:"schema"`
+}
+
+// EventSchemas returns the JSON Schema of every event payload, ordered by
+// event type.
+func EventSchemas() []EventSchema {
+	types := EventTypes()
+	schemas := make([]EventSchema, 0, len(types))
+	for _, t := range types {
+		schema := eventSchemas[t]
+		schemas = append(schemas, EventSchema{
+			Type:    t,
+			Version: schema.version,
+			Schema:  jsonschema.Generate(string(t), schema.zero),
+		})
+	}
+	return schemas
+}
+
+// NewEventPayload returns the zero payload of t.
+func NewEventPayload(t TripEventType) (EventPayload, error) {
+	schema, ok := eventSchemas[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, t)
+	}
+	return schema.zero, nil
+}
+
+// DecodeEventPayload decodes the JSON payload of an event of type t. An empty
+// or null payload decodes to the zero payload.
+func DecodeEventPayload(t TripEventType, raw []byte) (EventPayload, error) {
+	schema, ok := eventSchemas[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, t)
+	}
+	payload, err := schema.decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s payload: %w", t, err)
+	}
+	return payload, nil
+}
+
+// UnmarshalJSON decodes the payload into the type registered for the
+// event's type.
+func (e *TripEvent) UnmarshalJSON(data []byte) error {
+	type plain TripEvent
+	var raw struct {
+		plain
+		Payload json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	payload, err := DecodeEventPayload(raw.Type, raw.Payload)
+	if err != nil {
+		return err
+	}
+	*e = TripEvent(raw.plain)
+	e.Payload = payload
+	return nil
+}
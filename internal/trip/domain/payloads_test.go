@@ -0,0 +1,75 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/pkg/jsonschema"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/event_schemas.json from the current payload types")
+
+const eventSchemasGolden = "testdata/event_schemas.json"
+
+// TestEventSchemasStayCompatible compares every payload schema with the one
+// published last. A schema may grow compatibly at the same version; anything
+// that would break existing consumers needs a version bump, and every change
+// needs the golden file regenerated with -update. The check runs against the
+// committed golden file, so -update cannot paper over a breaking change.
+func TestEventSchemasStayCompatible(t *testing.T) {
+	current := make(map[domain.TripEventType]domain.EventSchema)
+	for _, schema := range domain.EventSchemas() {
+		current[schema.Type] = schema
+	}
+
+	data, err := os.ReadFile(eventSchemasGolden)
+	require.NoError(t, err)
+	var published map[domain.TripEventType]domain.EventSchema
+	require.NoError(t, json.Unmarshal(data, &published))
+
+	for eventType, prev := range published {
+		next, ok := current[eventType]
+		require.True(t, ok, "event type %s was removed; consumers still expect it", eventType)
+		require.GreaterOrEqual(t, next.Version, prev.Version, "%s schema version went backwards", eventType)
+		if next.Version == prev.Version {
+			require.Empty(t, jsonschema.Compatible(prev.Schema, next.Schema),
+				"%s changed incompatibly; bump its version in eventSchemas", eventType)
+		}
+	}
+
+	if *update {
+		data, err := json.MarshalIndent(current, "", "  ")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(eventSchemasGolden, append(data, '\n'), 0o644))
+		return
+	}
+
+	// Round-trip so both sides have the same shape before comparing.
+	encoded, err := json.Marshal(current)
+	require.NoError(t, err)
+	var generated map[domain.TripEventType]domain.EventSchema
+	require.NoError(t, json.Unmarshal(encoded, &generated))
+	require.Equal(t, published, generated, "event schemas changed; run go test -run TestEventSchemasStayCompatible -update")
+}
+
+func TestEventPayloadsRoundTripThroughJSON(t *testing.T) {
+	for _, eventType := range domain.EventTypes() {
+		payload, err := domain.NewEventPayload(eventType)
+		require.NoError(t, err)
+		require.Equal(t, eventType, payload.EventType())
+
+		raw, err := json.Marshal(payload)
+		require.NoError(t, err)
+		decoded, err := domain.DecodeEventPayload(eventType, raw)
+		require.NoError(t, err)
+		require.Equal(t, payload, decoded)
+	}
+
+	_, err := domain.DecodeEventPayload("NOT_AN_EVENT", nil)
+	require.ErrorIs(t, err, domain.ErrUnknownEventType)
+}
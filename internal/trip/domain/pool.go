@@ -0,0 +1,190 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrPoolNotFound is returned when no shared route exists for a pool ID.
+	ErrPoolNotFound = errors.New("pool not found")
+	// ErrInvalidSeats is returned when a trip books no seats or more than its
+	// product carries.
+	ErrInvalidSeats = errors.New("invalid seat count")
+)
+
+// Default pooling limits.
+const (
+	// DefaultPoolMaxDetour bounds how much later a pooled rider reaches their
+	// dropoff because of another rider joining.
+	DefaultPoolMaxDetour = 8 * time.Minute
+	// DefaultPoolMaxPickupWait bounds how long a rider joining a pool waits
+	// for the driver to reach them.
+	DefaultPoolMaxPickupWait = 10 * time.Minute
+)
+
+// SeatCount returns the seats the trip occupies. Trips stored before seats
+// were recorded count as one.
+func (t Trip) SeatCount() int {
+	return max(t.Seats, 1)
+}
+
+// PoolKey identifies the shared route the trip rides on. A pool is named
+// after its first trip, which therefore has no PoolID of its own.
+func (t Trip) PoolKey() uuid.UUID {
+	if t.PoolID != nil {
+		return *t.PoolID
+	}
+	return t.ID
+}
+
+// WaypointKind tells whether a waypoint picks a rider up or drops them off.
+type WaypointKind string
+
+const (
+	WaypointPickup  WaypointKind = "pickup"
+	WaypointDropoff WaypointKind = "dropoff"
+)
+
+// Waypoint is one stop on a shared driver route.
+type Waypoint struct {
+	TripID uuid.UUID    `json:"trip_id"`
+	Kind   WaypointKind `json:"kind"`
+	Point  GeoPoint     `json:"point"`
+}
+
+// Pool is the route a driver follows while carrying several pooled trips.
+// Waypoints keep their planned order, including those already visited, so
+// the driver's progress can be derived from the trips' statuses.
+type Pool struct {
+	ID          uuid.UUID  `json:"id"`
+	DriverID    uuid.UUID  `json:"driver_id"`
+	VehicleType string     `json:"vehicle_type"`
+	Waypoints   []Waypoint `json:"waypoints"`
+	Version     int64      `json:"version"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// NewPool returns the unsaved pool of a single trip.
+func NewPool(anchor Trip) Pool {
+	pool := Pool{ID: anchor.ID, VehicleType: anchor.VehicleType}
+	if anchor.DriverID != nil {
+		pool.DriverID = *anchor.DriverID
+	}
+	pool.Waypoints = []Waypoint{
+		{TripID: anchor.ID, Kind: WaypointPickup, Point: anchor.Pickup},
+		{TripID: anchor.ID, Kind: WaypointDropoff, Point: anchor.Dropoff},
+	}
+	return pool
+}
+
+// Progress splits the route into what the driver has done and what is left,
+// given the current state of the pool's trips. Waypoints of trips that were
+// cancelled or left the pool are dropped. The driver is taken to be at the
+// last visited waypoint.
+func (p Pool) Progress(trips map[uuid.UUID]Trip) (visited, remaining []Waypoint) {
+	for _, wp := range p.Waypoints {
+		trip, ok := trips[wp.TripID]
+		if !ok || trip.PoolKey() != p.ID {
+			continue
+		}
+		switch {
+		case trip.Status == StatusCompleted:
+			visited = append(visited, wp)
+		case !trip.Active():
+			// Cancelled before the route reached it.
+		case wp.Kind == WaypointPickup && trip.StartedAt != nil:
+			visited = append(visited, wp)
+		default:
+			remaining = append(remaining, wp)
+		}
+	}
+	return visited, remaining
+}
+
+// LegEstimator predicts the driving time between two points.
+type LegEstimator func(from, to GeoPoint) time.Duration
+
+// Insertion is a feasible way of adding a trip to a shared route.
+type Insertion struct {
+	// Route is the new remaining route.
+	Route []Waypoint
+	// Added is how much longer the whole route takes.
+	Added time.Duration
+}
+
+// PoolLimits bound what sharing a ride may cost its riders.
+type PoolLimits struct {
+	MaxDetour     time.Duration
+	MaxPickupWait time.Duration
+}
+
+// PlanInsertion finds where to insert trip's pickup and dropoff into the
+// remaining route driven from start so that the route grows the least. An
+// insertion is feasible when the driver reaches the new rider within
+// MaxPickupWait, no rider on the route reaches their dropoff more than
+// MaxDetour later than planned and the new rider spends at most MaxDetour
+// longer in the vehicle than a direct ride would take.
+func PlanInsertion(start GeoPoint, remaining []Waypoint, trip Trip, leg LegEstimator, limits PoolLimits) (Insertion, bool) {
+	pickup := Waypoint{TripID: trip.ID, Kind: WaypointPickup, Point: trip.Pickup}
+	dropoff := Waypoint{TripID: trip.ID, Kind: WaypointDropoff, Point: trip.Dropoff}
+	baseArrivals, baseTotal := arrivals(start, remaining, leg)
+	direct := leg(trip.Pickup, trip.Dropoff)
+
+	var best Insertion
+	found := false
+	for i := 0; i <= len(remaining); i++ {
+		for j := i; j <= len(remaining); j++ {
+			route := slices.Clone(remaining[:i])
+			route = append(route, pickup)
+			route = append(route, remaining[i:j]...)
+			route = append(route, dropoff)
+			route = append(route, remaining[j:]...)
+			at, total := arrivals(start, route, leg)
+			if at[pickup] > limits.MaxPickupWait || at[dropoff]-at[pickup]-direct > limits.MaxDetour {
+				continue
+			}
+			feasible := true
+			for wp, base := range baseArrivals {
+				if wp.Kind == WaypointDropoff && at[wp]-base > limits.MaxDetour {
+					feasible = false
+					break
+				}
+			}
+			if !feasible {
+				continue
+			}
+			if added := total - baseTotal; !found || added < best.Added {
+				best, found = Insertion{Route: route, Added: added}, true
+			}
+		}
+	}
+	return best, found
+}
+
+// arrivals returns when each waypoint of route is reached, measured from
+// start, and the duration of the whole route.
+func arrivals(start GeoPoint, route []Waypoint, leg LegEstimator) (map[Waypoint]time.Duration, time.Duration) {
+	at := make(map[Waypoint]time.Duration, len(route))
+	var elapsed time.Duration
+	from := start
+	for _, wp := range route {
+		elapsed += leg(from, wp.Point)
+		at[wp] = elapsed
+		from = wp.Point
+	}
+	return at, elapsed
+}
+
+// PoolRepository stores shared routes.
+type PoolRepository interface {
+	GetPool(ctx context.Context, id uuid.UUID) (Pool, error)
+	// SavePool inserts a pool whose Version is zero, or updates the stored pool
+	// if its version still equals pool.Version, returning ErrVersionConflict
+	// otherwise. The saved pool carries its new version.
+	SavePool(ctx context.Context, pool Pool) (Pool, error)
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidRating is returned for ratings outside the star range or with
+	// oversized tags or comments.
+	ErrInvalidRating = errors.New("invalid rating")
+	// ErrAlreadyRated is returned when a user rates the same trip twice.
+	ErrAlreadyRated = errors.New("trip already rated")
+	// ErrRatingWindowClosed is returned when a trip is rated too long after
+	// it finished.
+	ErrRatingWindowClosed = errors.New("rating window closed")
+	// ErrNotTripParty is returned when a user who was neither the rider nor
+	// the driver of a trip acts on it.
+	ErrNotTripParty = errors.New("user is not part of the trip")
+	// ErrRatingsUnavailable is returned when no rating store is configured.
+	ErrRatingsUnavailable = errors.New("ratings unavailable")
+)
+
+// Rating limits.
+const (
+	MinStars          = 1
+	MaxStars          = 5
+	MaxRatingTags     = 5
+	MaxRatingTagLen   = 32
+	MaxRatingComment  = 500
+	DefaultRatingSpan = 100
+)
+
+// DefaultRatingWindow is how long after completion a trip can be rated.
+const DefaultRatingWindow = 7 * 24 * time.Hour
+
+// Rating is the feedback one party of a completed trip gives the other.
+type Rating struct {
+	TripID  uuid.UUID `json:"trip_id"`
+	RaterID uuid.UUID `json:"rater_id"`
+	RateeID uuid.UUID `json:"ratee_id"`
+	// RateeRole is the part the rated user played in the trip.
+	RateeRole Party     `json:"ratee_role"`
+	Stars     int       `json:"stars"`
+	Tags      []string  `json:"tags,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the star range and the size of tags and comment.
+func (r Rating) Validate() error {
+	if r.Stars < MinStars || r.Stars > MaxStars {
+		return fmt.Errorf("%w: stars must be between %d and %d", ErrInvalidRating, MinStars, MaxStars)
+	}
+	if len(r.Tags) > MaxRatingTags {
+		return fmt.Errorf("%w: at most %d tags", ErrInvalidRating, MaxRatingTags)
+	}
+	for _, tag := range r.Tags {
+		if tag == "" || utf8.RuneCountInString(tag) > MaxRatingTagLen || strings.TrimSpace(tag) != tag {
+			return fmt.Errorf("%w: bad tag %q", ErrInvalidRating, tag)
+		}
+	}
+	if utf8.RuneCountInString(r.Comment) > MaxRatingComment {
+		return fmt.Errorf("%w: comment longer than %d characters", ErrInvalidRating, MaxRatingComment)
+	}
+	return nil
+}
+
+// RatingSummary aggregates the ratings a user received in one role.
+type RatingSummary struct {
+	UserID uuid.UUID `json:"user_id"`
+	Role   Party     `json:"role"`
+	Count  int64     `json:"count"`
+	// Average is the mean over every rating received.
+	Average float64 `json:"average"`
+	// RollingAverage follows recent ratings: each new rating is weighted
+	// 1/min(Count, span), approximating the mean of the last span ratings.
+	RollingAverage float64   `json:"rolling_average"`
+	StarsTotal     int64     `json:"-"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Add folds a rating of stars given at into the summary.
+func (s RatingSummary) Add(stars, span int, at time.Time) RatingSummary {
+	if span <= 0 {
+		span = DefaultRatingSpan
+	}
+	s.Count++
+	s.StarsTotal += int64(stars)
+	s.Average = float64(s.StarsTotal) / float64(s.Count)
+	s.RollingAverage += (float64(stars) - s.RollingAverage) / float64(min(s.Count, int64(span)))
+	s.UpdatedAt = at
+	return s
+}
+
+// RatingRepository stores ratings and the per user summaries derived from
+// them.
+type RatingRepository interface {
+	// CreateRating stores rating and folds it into the ratee's summary for
+	// the rated role, returning ErrAlreadyRated when the rater already rated
+	// the trip. span is passed to RatingSummary.Add.
+	CreateRating(ctx context.Context, rating Rating, span int) error
+	// ListTripRatings returns the ratings given for a trip.
+	ListTripRatings(ctx context.Context, tripID uuid.UUID) ([]Rating, error)
+	// GetRatingSummaries returns the summaries of every role userID was rated in.
+	GetRatingSummaries(ctx context.Context, userID uuid.UUID) ([]RatingSummary, error)
+}
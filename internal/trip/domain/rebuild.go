@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEventLogDrift is returned when a stored trip differs from the trip
+// rebuilt from its events.
+var ErrEventLogDrift = errors.New("trip and event log differ")
+
+// Rebuild folds a trip's events, oldest first, into the trip they describe.
+// Events without a payload fold like ones with the zero payload of their type.
+func Rebuild(events []TripEvent) (Trip, error) {
+	if len(events) == 0 {
+		return Trip{}, ErrTripNotFound
+	}
+	var trip Trip
+	for i, event := range events {
+		payload := event.Payload
+		if payload == nil {
+			var err error
+			if payload, err = NewEventPayload(event.Type); err != nil {
+				return Trip{}, err
+			}
+		}
+		if payload.EventType() != event.Type {
+			return Trip{}, fmt.Errorf("%s event with %s payload", event.Type, payload.EventType())
+		}
+		at := event.CreatedAt.UTC()
+		if i == 0 && event.Type != EventTripRequested && event.Type != EventTripScheduled {
+			return Trip{}, fmt.Errorf("event log starts with %s", event.Type)
+		}
+		switch p := payload.(type) {
+		case TripRequestedPayload:
+			if i != 0 {
+				return Trip{}, fmt.Errorf("%s after trip creation", event.Type)
+			}
+			trip = requestedTrip(event.TripID, p, at)
+			continue
+		case TripScheduledPayload:
+			if i != 0 {
+				return Trip{}, fmt.Errorf("%s after trip creation", event.Type)
+			}
+			trip = requestedTrip(event.TripID, p.TripRequestedPayload, at)
+			trip.Status = StatusScheduled
+			trip.PickupAt = utcPtr(&p.PickupAt)
+			continue
+		case NoDriverFoundPayload, TripRatedPayload:
+			// Recorded without touching the trip.
+			continue
+		case ScheduleReminderPayload:
+			trip.RemindersSent = p.RemindersSent
+		case TripReleasedPayload:
+			trip.Status = StatusRequested
+		case DriverAssignedPayload:
+			trip.Status = StatusDriverAssigned
+			trip.DriverID = &p.DriverID
+			trip.AcceptDeadline = utcPtr(&p.AcceptDeadline)
+			trip.PoolID = p.PoolID
+		case DriverAcceptedPayload:
+			trip.Status = StatusDriverAccepted
+			trip.AcceptedAt = &at
+			trip.AcceptDeadline = nil
+		case DriverDeclinedPayload:
+			trip.withdraw(p.DriverID)
+		case AssignmentExpiredPayload:
+			trip.withdraw(p.DriverID)
+		case TripExpiredPayload:
+			trip.Status = StatusNoDriverFound
+		case DriverEnRoutePayload:
+			trip.Status = StatusPickupEnRoute
+		case DriverArrivedPayload:
+			trip.Status = StatusArrived
+			trip.ArrivedAt = &at
+		case TripStartedPayload:
+			trip.Status = StatusInProgress
+			trip.StartedAt = &at
+		case StopReachedPayload:
+			if p.StopIndex < 0 || p.StopIndex >= len(trip.Stops) {
+				return Trip{}, fmt.Errorf("%s for unknown stop %d", event.Type, p.StopIndex)
+			}
+			if current := trip.CurrentStop(); current >= 0 {
+				trip.Stops[current].DepartedAt = &at
+			}
+			trip.Stops[p.StopIndex].ArrivedAt = &at
+		case StopDepartedPayload:
+			if p.StopIndex < 0 || p.StopIndex >= len(trip.Stops) {
+				return Trip{}, fmt.Errorf("%s for unknown stop %d", event.Type, p.StopIndex)
+			}
+			trip.Stops[p.StopIndex].DepartedAt = &at
+		case TripFinishedPayload:
+			trip.Status = StatusCompleted
+			trip.FinishedAt = &at
+			trip.PriceCents = p.PriceCents
+			trip.FareBreakdown = p.FareBreakdown
+			trip.DrivenMeters = p.DrivenMeters
+		case TripCancelledPayload:
+			by := p.Status
+			trip.Status = by
+			trip.CancelledAt = &at
+			trip.CancelledBy = &by
+			trip.CancelReason = p.Reason
+			trip.CancellationFeeCents = p.FeeCents
+			trip.DriverPenaltyCents = p.PenaltyCents
+		case FareAdjustedPayload:
+			trip.AdjustmentCents += p.AmountCents
+		default:
+			return Trip{}, fmt.Errorf("unknown event type %s", event.Type)
+		}
+		trip.Version++
+	}
+	return trip, nil
+}
+
+func requestedTrip(id uuid.UUID, p TripRequestedPayload, at time.Time) Trip {
+	trip := Trip{
+		ID:                id,
+		RiderID:           p.RiderID,
+		Pickup:            p.Pickup,
+		Dropoff:           p.Dropoff,
+		VehicleType:       p.VehicleType,
+		Status:            StatusRequested,
+		RequestedAt:       at,
+		QuoteID:           p.QuoteID,
+		UpfrontPriceCents: p.UpfrontPriceCents,
+		RateCard:          p.RateCard,
+		Seats:             max(p.Seats, 1),
+		Version:           1,
+	}
+	for _, point := range p.Stops {
+		trip.Stops = append(trip.Stops, Stop{Point: point})
+	}
+	return trip
+}
+
+// withdraw returns the trip to matching after driverID declined or let the
+// offer expire.
+func (t *Trip) withdraw(driverID uuid.UUID) {
+	t.Status = StatusRequested
+	t.DriverID = nil
+	t.AcceptDeadline = nil
+	t.PoolID = nil
+	t.DeclinedDrivers = append(t.DeclinedDrivers, driverID)
+}
+
+// DiffTrips lists the fields that differ between a and b. Empty and nil
+// collections are considered equal and timestamps are compared at the
+// microsecond precision Postgres stores.
+func DiffTrips(a, b Trip) ([]string, error) {
+	fieldsA, err := tripFields(a)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, err := tripFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var diff []string
+	for name, valueA := range fieldsA {
+		if !bytes.Equal(valueA, fieldsB[name]) {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+func tripFields(trip Trip) (map[string]json.RawMessage, error) {
+	trip.RequestedAt = trip.RequestedAt.UTC().Truncate(time.Microsecond)
+	for _, t := range []**time.Time{
+		&trip.AcceptedAt, &trip.ArrivedAt, &trip.StartedAt, &trip.FinishedAt,
+		&trip.CancelledAt, &trip.AcceptDeadline, &trip.PickupAt,
+	} {
+		*t = truncated(*t)
+	}
+	stops := make([]Stop, len(trip.Stops))
+	for i, stop := range trip.Stops {
+		stop.ArrivedAt = truncated(stop.ArrivedAt)
+		stop.DepartedAt = truncated(stop.DepartedAt)
+		stops[i] = stop
+	}
+	trip.Stops = stops
+	raw, err := json.Marshal(trip)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if bytes.Equal(value, []byte("[]")) {
+			fields[name] = json.RawMessage("null")
+		}
+	}
+	return fields, nil
+}
+
+func truncated(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.UTC().Truncate(time.Microsecond)
+	return &v
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := t.UTC()
+	return &v
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRoutesUnavailable is returned when no breadcrumb store is configured.
+var ErrRoutesUnavailable = errors.New("trip routes unavailable")
+
+// Breadcrumb filtering.
+const (
+	// MaxBreadcrumbAccuracyMeters drops fixes less accurate than this. Zero
+	// accuracy means the device did not report one and is kept.
+	MaxBreadcrumbAccuracyMeters = 50.0
+	// BreadcrumbJitterMeters is the smallest move counted towards the driven
+	// distance, so a parked vehicle's GPS noise does not add up.
+	BreadcrumbJitterMeters = 10.0
+	// RouteCoverageMeters is how far a driven route may start from the
+	// pickup and end from the dropoff and still count as covering the trip.
+	RouteCoverageMeters = 250.0
+)
+
+// Breadcrumb is a driver position recorded while a trip is in progress.
+type Breadcrumb struct {
+	TripID     uuid.UUID `json:"trip_id"`
+	Point      GeoPoint  `json:"point"`
+	Speed      float64   `json:"speed"`
+	Accuracy   float64   `json:"accuracy"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Usable reports whether the fix is accurate enough to record.
+func (b Breadcrumb) Usable() bool {
+	return b.Accuracy <= MaxBreadcrumbAccuracyMeters
+}
+
+// DrivenRoute is the path a trip actually took.
+type DrivenRoute struct {
+	Points         []GeoPoint
+	DistanceMeters float64
+	Duration       time.Duration
+}
+
+// MeasureRoute follows breadcrumbs, oldest first, skipping moves shorter than
+// BreadcrumbJitterMeters. The duration spans the first and last breadcrumb.
+func MeasureRoute(crumbs []Breadcrumb) DrivenRoute {
+	var route DrivenRoute
+	if len(crumbs) == 0 {
+		return route
+	}
+	last := crumbs[0].Point
+	route.Points = append(route.Points, last)
+	for _, crumb := range crumbs[1:] {
+		step := HaversineMeters(last, crumb.Point)
+		if step < BreadcrumbJitterMeters {
+			continue
+		}
+		route.DistanceMeters += step
+		route.Points = append(route.Points, crumb.Point)
+		last = crumb.Point
+	}
+	route.Duration = crumbs[len(crumbs)-1].RecordedAt.Sub(crumbs[0].RecordedAt)
+	return route
+}
+
+// Covers reports whether the route runs from pickup to dropoff, give or take
+// RouteCoverageMeters at either end. Routes with gaps at the start or end,
+// for example because the driver's device went offline, do not.
+func (r DrivenRoute) Covers(pickup, dropoff GeoPoint) bool {
+	if len(r.Points) < 2 {
+		return false
+	}
+	return HaversineMeters(r.Points[0], pickup) <= RouteCoverageMeters &&
+		HaversineMeters(r.Points[len(r.Points)-1], dropoff) <= RouteCoverageMeters
+}
+
+// BreadcrumbRepository stores the breadcrumbs of trips.
+type BreadcrumbRepository interface {
+	AppendBreadcrumb(ctx context.Context, crumb Breadcrumb) error
+	// ListBreadcrumbs returns a trip's breadcrumbs oldest first.
+	ListBreadcrumbs(ctx context.Context, tripID uuid.UUID) ([]Breadcrumb, error)
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TripFilter narrows a trip search. Zero fields match every trip.
+type TripFilter struct {
+	RiderID  *uuid.UUID
+	DriverID *uuid.UUID
+	Statuses []TripStatus
+	// RequestedFrom is inclusive and RequestedTo exclusive.
+	RequestedFrom *time.Time
+	RequestedTo   *time.Time
+}
+
+// Matches reports whether trip satisfies every field of f.
+func (f TripFilter) Matches(trip Trip) bool {
+	if f.RiderID != nil && trip.RiderID != *f.RiderID {
+		return false
+	}
+	if f.DriverID != nil && (trip.DriverID == nil || *trip.DriverID != *f.DriverID) {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if trip.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.RequestedFrom != nil && trip.RequestedAt.Before(*f.RequestedFrom) {
+		return false
+	}
+	if f.RequestedTo != nil && !trip.RequestedAt.Before(*f.RequestedTo) {
+		return false
+	}
+	return true
+}
+
+// TripCursor is a keyset position in the newest-first trip listing. A page
+// continues with the trips strictly after it in (requested_at, id)
+// descending order, so pages stay stable while new trips are requested.
+type TripCursor struct {
+	RequestedAt time.Time `json:"t"`
+	ID          uuid.UUID `json:"id"`
+}
+
+// CursorAfter returns the cursor positioned on trip.
+func CursorAfter(trip Trip) TripCursor {
+	return TripCursor{RequestedAt: trip.RequestedAt.UTC(), ID: trip.ID}
+}
+
+// Before reports whether trip sorts after c in the listing, i.e. belongs to
+// the page that c starts.
+func (c TripCursor) Before(trip Trip) bool {
+	if !trip.RequestedAt.Equal(c.RequestedAt) {
+		return trip.RequestedAt.Before(c.RequestedAt)
+	}
+	return trip.ID.String() < c.ID.String()
+}
+
+// Encode returns the opaque string form handed to clients.
+func (c TripCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ParseTripCursor decodes a cursor produced by Encode.
+func ParseTripCursor(s string) (TripCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return TripCursor{}, ErrInvalidCursor
+	}
+	var c TripCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == uuid.Nil || c.RequestedAt.IsZero() {
+		return TripCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,369 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrDriverNotAssigned is returned when a driver acts on a trip assigned to someone else.
+var ErrDriverNotAssigned = errors.New("driver not assigned to trip")
+
+// Command names an action that moves a trip from one status to another.
+type Command string
+
+const (
+	CommandRelease        Command = "release"
+	CommandAssignDriver   Command = "assign_driver"
+	CommandAccept         Command = "accept"
+	CommandDecline        Command = "decline"
+	CommandExpire         Command = "expire_assignment"
+	CommandExpireRequest  Command = "expire_request"
+	CommandDepart         Command = "depart"
+	CommandArrive         Command = "arrive"
+	CommandRiderNoShow    Command = "rider_no_show"
+	CommandStart          Command = "start"
+	CommandReachStop      Command = "reach_stop"
+	CommandLeaveStop      Command = "leave_stop"
+	CommandComplete       Command = "complete"
+	CommandCancelByRider  Command = "cancel_by_rider"
+	CommandCancelByDriver Command = "cancel_by_driver"
+)
+
+// InitialStatus is the status trips for immediate pickup are created in.
+const InitialStatus = StatusRequested
+
+// InitialStatuses lists every status a trip can be created in: rides booked
+// in advance start out SCHEDULED.
+func InitialStatuses() []TripStatus {
+	return []TripStatus{InitialStatus, StatusScheduled}
+}
+
+// Input carries the command arguments guards may inspect.
+type Input struct {
+	DriverID *uuid.UUID
+	Now      time.Time
+}
+
+// Guard vetoes a transition by returning a non-nil error.
+type Guard func(trip Trip, in Input) error
+
+// Transition is a single edge of the trip lifecycle graph.
+type Transition struct {
+	From    TripStatus
+	Command Command
+	To      TripStatus
+	Guard   Guard
+	Event   TripEventType
+}
+
+type transitionKey struct {
+	from    TripStatus
+	command Command
+}
+
+// StateMachine validates trip transitions against a declarative table.
+type StateMachine struct {
+	transitions []Transition
+	index       map[transitionKey]Transition
+}
+
+// NewStateMachine builds a machine from transitions. Declaring the same
+// (from, command) pair twice is a programming error and panics.
+func NewStateMachine(transitions ...Transition) *StateMachine {
+	m := &StateMachine{index: make(map[transitionKey]Transition, len(transitions))}
+	for _, t := range transitions {
+		key := transitionKey{from: t.From, command: t.Command}
+		if _, dup := m.index[key]; dup {
+			panic(fmt.Sprintf("duplicate transition %s --%s-->", t.From, t.Command))
+		}
+		m.index[key] = t
+		m.transitions = append(m.transitions, t)
+	}
+	return m
+}
+
+// Fire applies cmd to trip, moving it to the target status when the
+// transition exists and its guard passes. The matched transition is returned
+// so callers can emit its event.
+func (m *StateMachine) Fire(trip *Trip, cmd Command, in Input) (Transition, error) {
+	t, ok := m.index[transitionKey{from: trip.Status, command: cmd}]
+	if !ok {
+		return Transition{}, fmt.Errorf("%w: %s from %s", ErrInvalidTransition, cmd, trip.Status)
+	}
+	if t.Guard != nil {
+		if err := t.Guard(*trip, in); err != nil {
+			return Transition{}, err
+		}
+	}
+	trip.Status = t.To
+	return t, nil
+}
+
+// Can reports whether cmd is declared for status, ignoring guards.
+func (m *StateMachine) Can(status TripStatus, cmd Command) bool {
+	_, ok := m.index[transitionKey{from: status, command: cmd}]
+	return ok
+}
+
+// Transitions returns the declared transitions in declaration order.
+func (m *StateMachine) Transitions() []Transition {
+	return append([]Transition(nil), m.transitions...)
+}
+
+// Commands returns every command used by the machine, sorted by name.
+func (m *StateMachine) Commands() []Command {
+	seen := make(map[Command]struct{})
+	var cmds []Command
+	for _, t := range m.transitions {
+		if _, ok := seen[t.Command]; !ok {
+			seen[t.Command] = struct{}{}
+			cmds = append(cmds, t.Command)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i] < cmds[j] })
+	return cmds
+}
+
+// GraphEdge is the serialisable form of a Transition.
+type GraphEdge struct {
+	From    TripStatus    `json:"from"`
+	Command Command       `json:"command"`
+	To      TripStatus    `json:"to"`
+	Event   TripEventType `json:"event"`
+	Guarded bool          `json:"guarded"`
+}
+
+// Graph describes the machine for documentation and tooling.
+type Graph struct {
+	Initial  TripStatus   `json:"initial"`
+	Entries  []TripStatus `json:"entries"`
+	States   []TripStatus `json:"states"`
+	Terminal []TripStatus `json:"terminal"`
+	Edges    []GraphEdge  `json:"edges"`
+}
+
+// Graph returns the machine as states and edges. States without outgoing
+// edges are reported as terminal.
+func (m *StateMachine) Graph() Graph {
+	g := Graph{Initial: InitialStatus, Entries: InitialStatuses()}
+	outgoing := make(map[TripStatus]bool)
+	seen := make(map[TripStatus]bool)
+	addState := func(s TripStatus) {
+		if !seen[s] {
+			seen[s] = true
+			g.States = append(g.States, s)
+		}
+	}
+	for _, s := range g.Entries {
+		addState(s)
+	}
+	for _, t := range m.transitions {
+		addState(t.From)
+		addState(t.To)
+		outgoing[t.From] = true
+		g.Edges = append(g.Edges, GraphEdge{From: t.From, Command: t.Command, To: t.To, Event: t.Event, Guarded: t.Guard != nil})
+	}
+	for _, s := range g.States {
+		if !outgoing[s] {
+			g.Terminal = append(g.Terminal, s)
+		}
+	}
+	return g
+}
+
+// DOT renders the machine in Graphviz DOT format.
+func (m *StateMachine) DOT() string {
+	g := m.Graph()
+	var b strings.Builder
+	b.WriteString("digraph trip {\n\trankdir=LR;\n\tstart [shape=point];\n")
+	for _, s := range g.Terminal {
+		fmt.Fprintf(&b, "\t%q [shape=doublecircle];\n", s)
+	}
+	fmt.Fprintf(&b, "\tstart -> %q [label=%q];\n", g.Initial, "create / "+string(EventTripRequested))
+	fmt.Fprintf(&b, "\tstart -> %q [label=%q];\n", StatusScheduled, "schedule / "+string(EventTripScheduled))
+	for _, e := range g.Edges {
+		label := string(e.Command) + " / " + string(e.Event)
+		if e.Guarded {
+			label = "[guarded] " + label
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", e.From, e.To, label)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// DefaultFreeWaitingWindow is how long a driver waits at pickup before the
+// rider may be marked as a no-show.
+const DefaultFreeWaitingWindow = 5 * time.Minute
+
+// DefaultScheduleLeadTime is how long before a scheduled pickup matching starts.
+const DefaultScheduleLeadTime = 15 * time.Minute
+
+// DefaultMatchTimeout is how long matching may take before a trip ends as
+// NO_DRIVER_FOUND.
+const DefaultMatchTimeout = 5 * time.Minute
+
+// DefaultPickupGracePeriod is how long past its pickup time a scheduled trip
+// that could not be released waits before it ends as NO_DRIVER_FOUND.
+const DefaultPickupGracePeriod = 30 * time.Minute
+
+// LifecycleConfig tunes the guards of the trip state machine.
+type LifecycleConfig struct {
+	FreeWaitingWindow time.Duration
+	// ScheduleLeadTime is how long before PickupAt a scheduled trip may be
+	// released to matching.
+	ScheduleLeadTime time.Duration
+	// MatchTimeout is how long a trip may wait for a driver, counted from
+	// MatchingStartedAt, before it can be expired.
+	MatchTimeout time.Duration
+	// PickupGracePeriod is how long past PickupAt a scheduled trip that was
+	// never released may wait before it can be expired.
+	PickupGracePeriod time.Duration
+}
+
+// TripStateMachine returns the lifecycle every trip follows.
+func TripStateMachine(cfg LifecycleConfig) *StateMachine {
+	if cfg.FreeWaitingWindow <= 0 {
+		cfg.FreeWaitingWindow = DefaultFreeWaitingWindow
+	}
+	if cfg.ScheduleLeadTime <= 0 {
+		cfg.ScheduleLeadTime = DefaultScheduleLeadTime
+	}
+	if cfg.MatchTimeout <= 0 {
+		cfg.MatchTimeout = DefaultMatchTimeout
+	}
+	if cfg.PickupGracePeriod <= 0 {
+		cfg.PickupGracePeriod = DefaultPickupGracePeriod
+	}
+	transitions := []Transition{
+		{From: StatusScheduled, Command: CommandRelease, To: StatusRequested, Guard: leadWindowStarted(cfg.ScheduleLeadTime), Event: EventTripReleased},
+		{From: StatusScheduled, Command: CommandExpireRequest, To: StatusNoDriverFound, Guard: pickupGraceElapsed(cfg.PickupGracePeriod), Event: EventTripExpired},
+		{From: StatusRequested, Command: CommandAssignDriver, To: StatusDriverAssigned, Guard: requireDriver, Event: EventDriverAssigned},
+		{From: StatusRequested, Command: CommandExpireRequest, To: StatusNoDriverFound, Guard: matchTimeoutElapsed(cfg.MatchTimeout, cfg.ScheduleLeadTime), Event: EventTripExpired},
+		{From: StatusDriverAssigned, Command: CommandAccept, To: StatusDriverAccepted, Guard: requireAssignedDriver, Event: EventDriverAccepted},
+		{From: StatusDriverAssigned, Command: CommandDecline, To: StatusRequested, Guard: requireAssignedDriver, Event: EventDriverDeclined},
+		{From: StatusDriverAssigned, Command: CommandExpire, To: StatusRequested, Guard: acceptDeadlinePassed, Event: EventAssignmentExpired},
+		{From: StatusDriverAccepted, Command: CommandDepart, To: StatusPickupEnRoute, Event: EventDriverEnRoute},
+		{From: StatusDriverAccepted, Command: CommandArrive, To: StatusArrived, Event: EventDriverArrived},
+		{From: StatusPickupEnRoute, Command: CommandArrive, To: StatusArrived, Event: EventDriverArrived},
+		{From: StatusArrived, Command: CommandRiderNoShow, To: StatusCancelledDriver, Guard: waitingWindowElapsed(cfg.FreeWaitingWindow), Event: EventTripCancelled},
+		{From: StatusDriverAccepted, Command: CommandStart, To: StatusInProgress, Event: EventTripStarted},
+		{From: StatusPickupEnRoute, Command: CommandStart, To: StatusInProgress, Event: EventTripStarted},
+		{From: StatusArrived, Command: CommandStart, To: StatusInProgress, Event: EventTripStarted},
+		{From: StatusInProgress, Command: CommandReachStop, To: StatusInProgress, Guard: stopPending, Event: EventStopReached},
+		{From: StatusInProgress, Command: CommandLeaveStop, To: StatusInProgress, Guard: atStop, Event: EventStopDeparted},
+		{From: StatusInProgress, Command: CommandComplete, To: StatusCompleted, Event: EventTripFinished},
+	}
+	for _, from := range []TripStatus{StatusScheduled, StatusRequested, StatusDriverAssigned, StatusDriverAccepted, StatusPickupEnRoute, StatusArrived} {
+		transitions = append(transitions, Transition{From: from, Command: CommandCancelByRider, To: StatusCancelledRider, Event: EventTripCancelled})
+	}
+	for _, from := range []TripStatus{StatusDriverAssigned, StatusDriverAccepted, StatusPickupEnRoute, StatusArrived} {
+		transitions = append(transitions, Transition{From: from, Command: CommandCancelByDriver, To: StatusCancelledDriver, Event: EventTripCancelled})
+	}
+	return NewStateMachine(transitions...)
+}
+
+// Statuses lists every declared trip status.
+func Statuses() []TripStatus {
+	return []TripStatus{
+		StatusScheduled,
+		StatusRequested,
+		StatusDriverAssigned,
+		StatusDriverAccepted,
+		StatusPickupEnRoute,
+		StatusArrived,
+		StatusInProgress,
+		StatusCompleted,
+		StatusCancelledRider,
+		StatusCancelledDriver,
+		StatusNoDriverFound,
+	}
+}
+
+func requireDriver(_ Trip, in Input) error {
+	if in.DriverID == nil {
+		return errors.New("driver id required")
+	}
+	return nil
+}
+
+func requireAssignedDriver(trip Trip, in Input) error {
+	if in.DriverID == nil || trip.DriverID == nil || *trip.DriverID != *in.DriverID {
+		return ErrDriverNotAssigned
+	}
+	return nil
+}
+
+func waitingWindowElapsed(window time.Duration) Guard {
+	return func(trip Trip, in Input) error {
+		if trip.ArrivedAt == nil || in.Now.Sub(*trip.ArrivedAt) < window {
+			return ErrWaitingWindowOpen
+		}
+		return nil
+	}
+}
+
+func stopPending(trip Trip, _ Input) error {
+	if trip.NextStop() < 0 {
+		return ErrNoPendingStop
+	}
+	return nil
+}
+
+func atStop(trip Trip, _ Input) error {
+	if trip.CurrentStop() < 0 {
+		return ErrNotAtStop
+	}
+	return nil
+}
+
+func leadWindowStarted(lead time.Duration) Guard {
+	return func(trip Trip, in Input) error {
+		if trip.PickupAt == nil || in.Now.Before(trip.PickupAt.Add(-lead)) {
+			return ErrLeadWindowNotStarted
+		}
+		return nil
+	}
+}
+
+func pickupGraceElapsed(grace time.Duration) Guard {
+	return func(trip Trip, in Input) error {
+		if trip.PickupAt == nil || in.Now.Before(trip.PickupAt.Add(grace)) {
+			return ErrPickupGraceNotElapsed
+		}
+		return nil
+	}
+}
+
+func matchTimeoutElapsed(timeout, lead time.Duration) Guard {
+	return func(trip Trip, in Input) error {
+		if in.Now.Before(trip.MatchingStartedAt(lead).Add(timeout)) {
+			return ErrMatchTimeoutNotReached
+		}
+		return nil
+	}
+}
+
+// MatchingStartedAt is when the trip started looking for a driver: when it
+// was requested or, for a ride booked in advance, when its lead window
+// opened.
+func (t Trip) MatchingStartedAt(lead time.Duration) time.Time {
+	if t.PickupAt != nil {
+		if opened := t.PickupAt.Add(-lead); opened.After(t.RequestedAt) {
+			return opened
+		}
+	}
+	return t.RequestedAt
+}
+
+func acceptDeadlinePassed(trip Trip, in Input) error {
+	if trip.AcceptDeadline == nil || in.Now.Before(*trip.AcceptDeadline) {
+		return ErrAcceptDeadlineNotReached
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+func TestTripStateMachineRejectsEveryUndeclaredTransition(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{})
+	driverID := uuid.New()
+	arrivedAt := time.Unix(0, 0).UTC()
+	// Inputs that satisfy every guard, so only the table decides.
+	in := domain.Input{DriverID: &driverID, Now: arrivedAt.Add(time.Hour)}
+
+	for _, status := range domain.Statuses() {
+		for _, cmd := range machine.Commands() {
+			trip := domain.Trip{
+				Status: status, DriverID: &driverID, ArrivedAt: &arrivedAt, AcceptDeadline: &arrivedAt, PickupAt: &arrivedAt,
+				// Waiting at the first stop with another one still ahead.
+				Stops: []domain.Stop{{ArrivedAt: &arrivedAt}, {}},
+			}
+			_, err := machine.Fire(&trip, cmd, in)
+			if machine.Can(status, cmd) {
+				require.NoError(t, err, "%s --%s--> should be allowed", status, cmd)
+				continue
+			}
+			require.ErrorIs(t, err, domain.ErrInvalidTransition, "%s --%s--> should be rejected", status, cmd)
+			require.Equal(t, status, trip.Status, "rejected transition must not change status")
+		}
+	}
+}
+
+func TestTripStateMachineGuards(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{})
+	assigned := uuid.New()
+	other := uuid.New()
+
+	trip := domain.Trip{Status: domain.StatusDriverAssigned, DriverID: &assigned}
+	_, err := machine.Fire(&trip, domain.CommandAccept, domain.Input{DriverID: &other})
+	require.ErrorIs(t, err, domain.ErrDriverNotAssigned)
+	require.Equal(t, domain.StatusDriverAssigned, trip.Status)
+
+	transition, err := machine.Fire(&trip, domain.CommandAccept, domain.Input{DriverID: &assigned})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusDriverAccepted, trip.Status)
+	require.Equal(t, domain.EventDriverAccepted, transition.Event)
+}
+
+func TestTripStateMachineNoShowWaitsForFreeWindow(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{FreeWaitingWindow: 3 * time.Minute})
+	arrivedAt := time.Unix(0, 0).UTC()
+	trip := domain.Trip{Status: domain.StatusArrived, ArrivedAt: &arrivedAt}
+
+	_, err := machine.Fire(&trip, domain.CommandRiderNoShow, domain.Input{Now: arrivedAt.Add(2 * time.Minute)})
+	require.ErrorIs(t, err, domain.ErrWaitingWindowOpen)
+
+	_, err = machine.Fire(&trip, domain.CommandRiderNoShow, domain.Input{Now: arrivedAt.Add(3 * time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCancelledDriver, trip.Status)
+}
+
+func TestTripStateMachineGraph(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{})
+	graph := machine.Graph()
+
+	require.Equal(t, domain.StatusRequested, graph.Initial)
+	require.Equal(t, []domain.TripStatus{domain.StatusRequested, domain.StatusScheduled}, graph.Entries)
+	require.ElementsMatch(t, domain.Statuses(), graph.States, "every status must be reachable in the graph")
+	require.ElementsMatch(t, []domain.TripStatus{
+		domain.StatusCompleted,
+		domain.StatusCancelledRider,
+		domain.StatusCancelledDriver,
+		domain.StatusNoDriverFound,
+	}, graph.Terminal)
+	require.Len(t, graph.Edges, len(machine.Transitions()))
+	require.Contains(t, machine.DOT(), `"DRIVER_ACCEPTED" -> "PICKUP_EN_ROUTE" [label="depart / DriverEnRoute"];`)
+}
+
+func TestTripStateMachineReleasesScheduledTripAtLeadWindow(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{ScheduleLeadTime: 10 * time.Minute})
+	pickupAt := time.Unix(0, 0).UTC().Add(time.Hour)
+	trip := domain.Trip{Status: domain.StatusScheduled, PickupAt: &pickupAt}
+
+	_, err := machine.Fire(&trip, domain.CommandRelease, domain.Input{Now: pickupAt.Add(-11 * time.Minute)})
+	require.ErrorIs(t, err, domain.ErrLeadWindowNotStarted)
+
+	transition, err := machine.Fire(&trip, domain.CommandRelease, domain.Input{Now: pickupAt.Add(-10 * time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusRequested, trip.Status)
+	require.Equal(t, domain.EventTripReleased, transition.Event)
+}
+
+func TestTripStateMachineExpiresScheduledTripAfterPickupGrace(t *testing.T) {
+	machine := domain.TripStateMachine(domain.LifecycleConfig{PickupGracePeriod: 20 * time.Minute})
+	pickupAt := time.Unix(0, 0).UTC().Add(time.Hour)
+	trip := domain.Trip{Status: domain.StatusScheduled, PickupAt: &pickupAt}
+
+	_, err := machine.Fire(&trip, domain.CommandExpireRequest, domain.Input{Now: pickupAt.Add(19 * time.Minute)})
+	require.ErrorIs(t, err, domain.ErrPickupGraceNotElapsed)
+
+	transition, err := machine.Fire(&trip, domain.CommandExpireRequest, domain.Input{Now: pickupAt.Add(20 * time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusNoDriverFound, trip.Status)
+	require.Equal(t, domain.EventTripExpired, transition.Event)
+}
@@ -2,65 +2,178 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
+	"github.com/example/ridellite/internal/auth"
 	"github.com/example/ridellite/internal/trip/domain"
 	"github.com/example/ridellite/internal/trip/service"
+	"github.com/example/ridellite/pkg/idempotency"
 )
 
 // HTTP exposes trip endpoints following the Clean Architecture flow.
 type HTTP struct {
-	svc *service.Service
+	svc          *service.Service
+	idempotency  func(http.Handler) http.Handler
+	authenticate func(http.Handler) http.Handler
+}
+
+// Option customises an HTTP handler.
+type Option func(*HTTP)
+
+// WithIdempotency makes every authenticated mutating route replay the stored
+// response for a repeated Idempotency-Key. Keys are scoped to the subject of
+// the caller's token unless cfg.Scope says otherwise.
+func WithIdempotency(store idempotency.Store, cfg idempotency.Config) Option {
+	return func(h *HTTP) {
+		if cfg.Scope == nil {
+			cfg.Scope = subject
+		}
+		h.idempotency = idempotency.Middleware(store, cfg)
+	}
+}
+
+// subject is the subject of the claims authenticating r.
+func subject(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims != nil {
+		return claims.Subject
+	}
+	return ""
+}
+
+// WithAuthentication requires a JWT signed with secret on the routes that act
+// as the trip's rider, driver or an admin. Without it those routes answer 401.
+func WithAuthentication(secret string) Option {
+	return func(h *HTTP) {
+		h.authenticate = auth.Middleware(secret, auth.RoleRider, auth.RoleDriver, auth.RoleAdmin)
+	}
 }
 
 // NewHTTP constructs a handler.
-func NewHTTP(svc *service.Service) *HTTP {
-	return &HTTP{svc: svc}
+func NewHTTP(svc *service.Service, opts ...Option) *HTTP {
+	h := &HTTP{svc: svc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Router builds the chi router with all endpoints and middlewares.
 func (h *HTTP) Router() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID, middleware.RealIP, middleware.Logger, middleware.Recoverer)
-	r.Post("/v1/trips", h.createTrip)
-	r.Get("/v1/trips/{id}", h.getTrip)
-	r.Post("/v1/trips/{id}/cancel", h.cancelTrip)
-	r.Post("/v1/trips/{id}/start", h.startTrip)
-	r.Post("/v1/trips/{id}/complete", h.completeTrip)
+	// Idempotency keys are scoped to the authenticated subject, so the
+	// middleware only runs behind authentication and a stored response only
+	// replays to the caller it was served to. Authorization is left to the
+	// service.
+	r.Group(func(r chi.Router) {
+		if h.authenticate != nil {
+			r.Use(h.authenticate)
+			h.useIdempotency(r)
+		}
+		r.Post("/v1/quotes", h.quote)
+		r.Post("/v1/trips", h.createTrip)
+		r.Post("/v1/trips/{id}/accept", h.acceptTrip)
+		r.Post("/v1/trips/{id}/decline", h.declineTrip)
+		r.Post("/v1/trips/{id}/en-route", h.driverEnRoute)
+		r.Post("/v1/trips/{id}/arrive", h.driverArrived)
+		r.Post("/v1/trips/{id}/no-show", h.riderNoShow)
+		r.Post("/v1/trips/{id}/cancel", h.cancelTrip)
+		r.Post("/v1/trips/{id}/start", h.startTrip)
+		r.Post("/v1/trips/{id}/stops/reach", h.reachStop)
+		r.Post("/v1/trips/{id}/stops/leave", h.leaveStop)
+		r.Post("/v1/trips/{id}/complete", h.completeTrip)
+		r.Post("/v1/trips/{id}/ratings", h.rateTrip)
+		r.Post("/v1/trips/{id}/adjustments", h.adjustFare)
+		r.Get("/v1/trips", h.searchTrips)
+		r.Get("/v1/trips/{id}/ratings", h.listTripRatings)
+		r.Get("/v1/users/{id}/ratings", h.userRatings)
+		r.Get("/v1/trips/{id}/route", h.tripRoute)
+	})
+	h.publicRoutes(r)
 	return r
 }
 
+func (h *HTTP) useIdempotency(r chi.Router) {
+	if h.idempotency != nil {
+		r.Use(h.idempotency)
+	}
+}
+
+// publicRoutes registers the routes that do not act for an authenticated
+// user.
+func (h *HTTP) publicRoutes(r chi.Router) {
+	r.Get("/v1/products", h.listProducts)
+	r.Get("/v1/trips/{id}", h.getTrip)
+	r.Get("/v1/trips/{id}/events", h.listTripEvents)
+	r.Get("/v1/state-machine", h.stateMachine)
+	r.Get("/v1/events/schemas", h.listEventSchemas)
+	r.Get("/v1/events/schemas/{type}", h.getEventSchema)
+	r.Get("/v1/trips/{id}/adjustments", h.fareStatement)
+	r.Get("/v1/pools/{id}", h.getPool)
+}
+
+func (h *HTTP) listProducts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.svc.Products())
+}
+
 type createTripRequest struct {
-	RiderID     string          `json:"rider_id"`
-	Pickup      domain.GeoPoint `json:"pickup"`
-	Dropoff     domain.GeoPoint `json:"dropoff"`
-	VehicleType string          `json:"vehicle_type"`
+	Pickup      domain.GeoPoint   `json:"pickup"`
+	Dropoff     domain.GeoPoint   `json:"dropoff"`
+	Stops       []domain.GeoPoint `json:"stops,omitempty"`
+	VehicleType string            `json:"vehicle_type"`
+	QuoteToken  string            `json:"quote_token,omitempty"`
+	PickupAt    *time.Time        `json:"pickup_at,omitempty"`
+	Seats       int               `json:"seats,omitempty"`
 }
 
-func (h *HTTP) createTrip(w http.ResponseWriter, r *http.Request) {
+func (h *HTTP) quote(w http.ResponseWriter, r *http.Request) {
 	var payload createTripRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	riderID, err := uuid.Parse(payload.RiderID)
+
+	resp, err := h.svc.Quote(r.Context(), service.QuoteRequest{
+		Pickup:      payload.Pickup,
+		Dropoff:     payload.Dropoff,
+		Stops:       payload.Stops,
+		VehicleType: payload.VehicleType,
+	})
 	if err != nil {
-		http.Error(w, "invalid rider_id", http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *HTTP) createTrip(w http.ResponseWriter, r *http.Request) {
+	var payload createTripRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	resp, err := h.svc.CreateTrip(r.Context(), r.Header.Get("Idempotency-Key"), service.CreateTripRequest{
-		RiderID:     riderID,
+	resp, err := h.svc.CreateTrip(r.Context(), service.CreateTripRequest{
 		Pickup:      payload.Pickup,
 		Dropoff:     payload.Dropoff,
+		Stops:       payload.Stops,
 		VehicleType: payload.VehicleType,
+		QuoteToken:  payload.QuoteToken,
+		PickupAt:    payload.PickupAt,
+		Seats:       payload.Seats,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, resp)
@@ -74,25 +187,207 @@ func (h *HTTP) getTrip(w http.ResponseWriter, r *http.Request) {
 	}
 	trip, err := h.svc.GetTrip(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+// searchTrips lists the caller's trips, or any trip for admins, filtered by
+// rider_id, driver_id, status (repeated or comma separated) and an RFC 3339
+// requested_from/requested_to range. Pages are continued by passing back
+// next_cursor as cursor.
+func (h *HTTP) searchTrips(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var (
+		req service.SearchTripsRequest
+		err error
+	)
+	if req.Filter.RiderID, err = optionalUUID(query.Get("rider_id")); err != nil {
+		http.Error(w, "invalid rider_id", http.StatusBadRequest)
+		return
+	}
+	if req.Filter.DriverID, err = optionalUUID(query.Get("driver_id")); err != nil {
+		http.Error(w, "invalid driver_id", http.StatusBadRequest)
+		return
+	}
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if !slices.Contains(domain.Statuses(), domain.TripStatus(status)) {
+				http.Error(w, "invalid status "+status, http.StatusBadRequest)
+				return
+			}
+			req.Filter.Statuses = append(req.Filter.Statuses, domain.TripStatus(status))
+		}
+	}
+	if req.Filter.RequestedFrom, err = optionalTime(query.Get("requested_from")); err != nil {
+		http.Error(w, "invalid requested_from", http.StatusBadRequest)
+		return
+	}
+	if req.Filter.RequestedTo, err = optionalTime(query.Get("requested_to")); err != nil {
+		http.Error(w, "invalid requested_to", http.StatusBadRequest)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if req.Limit, err = strconv.Atoi(limit); err != nil || req.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Cursor = query.Get("cursor")
+
+	resp, err := h.svc.SearchTrips(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func optionalUUID(s string) (*uuid.UUID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func optionalTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (h *HTTP) listTripEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	events, err := h.svc.ListTripEvents(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if events == nil {
+		events = []domain.TripEvent{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// stateMachine returns the trip lifecycle as JSON, or as Graphviz DOT when
+// called with ?format=dot.
+func (h *HTTP) stateMachine(w http.ResponseWriter, r *http.Request) {
+	machine := h.svc.StateMachine()
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(machine.DOT()))
+		return
+	}
+	writeJSON(w, http.StatusOK, machine.Graph())
+}
+
+func (h *HTTP) declineTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.DeclineTrip(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) driverEnRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.DriverEnRoute(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) driverArrived(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.DriverArrived(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) riderNoShow(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.RiderNoShow(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) acceptTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.AcceptTrip(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, trip)
 }
 
+type cancelTripRequest struct {
+	Reason domain.CancellationReason `json:"reason"`
+}
+
+// cancelTrip takes the reason code from an optional JSON body, falling back to
+// the reason query parameter. The caller's token decides whether the rider or
+// the driver cancels.
 func (h *HTTP) cancelTrip(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	actor := domain.StatusCancelledRider
-	if r.URL.Query().Get("actor") == "driver" {
-		actor = domain.StatusCancelledDriver
+	payload := cancelTripRequest{Reason: domain.CancellationReason(r.URL.Query().Get("reason"))}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	trip, err := h.svc.CancelTrip(r.Context(), id, actor)
+	trip, err := h.svc.CancelTrip(r.Context(), id, payload.Reason)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, trip)
@@ -106,7 +401,35 @@ func (h *HTTP) startTrip(w http.ResponseWriter, r *http.Request) {
 	}
 	trip, err := h.svc.StartTrip(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) reachStop(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.ReachStop(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+func (h *HTTP) leaveStop(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	trip, err := h.svc.LeaveStop(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, trip)
@@ -118,19 +441,197 @@ func (h *HTTP) completeTrip(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	var payload struct {
-		PriceCents int64 `json:"price_cents"`
+	trip, err := h.svc.CompleteTrip(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trip)
+}
+
+type rateTripRequest struct {
+	Stars   int      `json:"stars"`
+	Tags    []string `json:"tags,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+func (h *HTTP) rateTrip(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
+	var payload rateTripRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	trip, err := h.svc.CompleteTrip(r.Context(), id, payload.PriceCents)
+	rating, err := h.svc.RateTrip(r.Context(), id, service.RateTripRequest{
+		Stars:   payload.Stars,
+		Tags:    payload.Tags,
+		Comment: payload.Comment,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, trip)
+	writeJSON(w, http.StatusCreated, rating)
+}
+
+func (h *HTTP) listTripRatings(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	ratings, err := h.svc.ListTripRatings(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ratings)
+}
+
+func (h *HTTP) userRatings(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	summaries, err := h.svc.RatingSummaries(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (h *HTTP) tripRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	route, err := h.svc.TripRoute(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, route)
+}
+
+func (h *HTTP) getPool(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	route, err := h.svc.PoolRoute(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, route)
+}
+
+type adjustFareRequest struct {
+	Kind        domain.AdjustmentKind `json:"kind"`
+	AmountCents int64                 `json:"amount_cents"`
+	Reason      string                `json:"reason,omitempty"`
+}
+
+// adjustFare records a tip from the trip's rider or a refund or correction
+// from an admin. The caller's token names the actor.
+func (h *HTTP) adjustFare(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var payload adjustFareRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	adjustment, err := h.svc.AdjustFare(r.Context(), id, service.AdjustFareRequest{
+		Kind:        payload.Kind,
+		AmountCents: payload.AmountCents,
+		Reason:      payload.Reason,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, adjustment)
+}
+
+func (h *HTTP) fareStatement(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	statement, err := h.svc.FareStatement(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, statement)
+}
+
+// activeTripResponse tells the client which trip blocks the request.
+type activeTripResponse struct {
+	Error  string       `json:"error"`
+	Party  domain.Party `json:"party"`
+	TripID uuid.UUID    `json:"active_trip_id"`
+}
+
+func (h *HTTP) listEventSchemas(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.svc.EventSchemas())
+}
+
+func (h *HTTP) getEventSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := h.svc.EventSchema(domain.TripEventType(chi.URLParam(r, "type")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// writeError maps domain errors onto HTTP status codes.
+func writeError(w http.ResponseWriter, err error) {
+	var active *domain.ActiveTripError
+	if errors.As(err, &active) {
+		writeJSON(w, http.StatusConflict, activeTripResponse{Error: active.Error(), Party: active.Party, TripID: active.TripID})
+		return
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, domain.ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, domain.ErrTripNotFound), errors.Is(err, domain.ErrPoolNotFound),
+		errors.Is(err, domain.ErrUnknownEventType):
+		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidTransition), errors.Is(err, domain.ErrVersionConflict),
+		errors.Is(err, domain.ErrWaitingWindowOpen), errors.Is(err, domain.ErrNoPendingStop),
+		errors.Is(err, domain.ErrNotAtStop), errors.Is(err, domain.ErrAlreadyRated),
+		errors.Is(err, domain.ErrRatingWindowClosed), errors.Is(err, domain.ErrTipWindowClosed):
+		status = http.StatusConflict
+	case errors.Is(err, domain.ErrDriverNotAssigned), errors.Is(err, domain.ErrNotTripParty),
+		errors.Is(err, domain.ErrSupportOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, domain.ErrUnknownVehicleType), errors.Is(err, domain.ErrQuoteInvalid),
+		errors.Is(err, domain.ErrQuoteExpired), errors.Is(err, domain.ErrInvalidPickupTime),
+		errors.Is(err, domain.ErrTooManyStops), errors.Is(err, domain.ErrInvalidCursor),
+		errors.Is(err, domain.ErrInvalidCancelReason), errors.Is(err, domain.ErrInvalidRating),
+		errors.Is(err, domain.ErrInvalidAdjustment), errors.Is(err, domain.ErrInvalidSeats):
+		status = http.StatusBadRequest
+	case errors.Is(err, domain.ErrQuotesUnavailable), errors.Is(err, domain.ErrRatingsUnavailable),
+		errors.Is(err, domain.ErrAdjustmentsUnavailable), errors.Is(err, domain.ErrRoutesUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
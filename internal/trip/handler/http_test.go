@@ -0,0 +1,171 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/auth"
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/handler"
+	"github.com/example/ridellite/internal/trip/repository"
+	"github.com/example/ridellite/internal/trip/service"
+	"github.com/example/ridellite/pkg/idempotency"
+)
+
+const secret = "test-secret"
+
+type stubPublisher struct{}
+
+func (stubPublisher) Publish(context.Context, domain.TripEvent) error { return nil }
+
+type stubClock struct{ t time.Time }
+
+func (s stubClock) Now() time.Time { return s.t }
+
+// token signs claims for the user id in role.
+func token(t *testing.T, role string, id uuid.UUID) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Role:             role,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: id.String()},
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+// newServer serves a driver-accepted trip between riderID and driverID.
+func newServer(t *testing.T, riderID, driverID uuid.UUID, opts ...handler.Option) (http.Handler, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := stubClock{t: time.Unix(0, 0).UTC()}
+	trip, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:          uuid.New(),
+		RiderID:     riderID,
+		DriverID:    &driverID,
+		Status:      domain.StatusDriverAccepted,
+		VehicleType: "economy",
+		RequestedAt: clock.Now(),
+	})
+	require.NoError(t, err)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, stubPublisher{}), nil, clock)
+	opts = append(opts, handler.WithAuthentication(secret))
+	return handler.NewHTTP(svc, opts...).Router(), trip.ID
+}
+
+func post(h http.Handler, path, bearer string) *httptest.ResponseRecorder {
+	return serve(h, http.MethodPost, path, bearer)
+}
+
+func get(h http.Handler, path, bearer string) *httptest.ResponseRecorder {
+	return serve(h, http.MethodGet, path, bearer)
+}
+
+func serve(h http.Handler, method, path, bearer string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDriverCommandsRequireTheAssignedDriver(t *testing.T) {
+	riderID, driverID := uuid.New(), uuid.New()
+	h, tripID := newServer(t, riderID, driverID)
+	start := "/v1/trips/" + tripID.String() + "/start"
+
+	require.Equal(t, http.StatusUnauthorized, post(h, start, "").Code)
+	require.Equal(t, http.StatusForbidden, post(h, start, token(t, auth.RoleDriver, uuid.New())).Code)
+	require.Equal(t, http.StatusForbidden, post(h, start, token(t, auth.RoleRider, riderID)).Code)
+
+	rec := post(h, start, token(t, auth.RoleDriver, driverID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var trip domain.Trip
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&trip))
+	require.Equal(t, domain.StatusInProgress, trip.Status)
+}
+
+func TestCancelIgnoresTheActorQueryParameter(t *testing.T) {
+	riderID, driverID := uuid.New(), uuid.New()
+	h, tripID := newServer(t, riderID, driverID)
+
+	rec := post(h, "/v1/trips/"+tripID.String()+"/cancel?actor=driver", token(t, auth.RoleRider, riderID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var trip domain.Trip
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&trip))
+	require.Equal(t, domain.StatusCancelledRider, trip.Status)
+	require.Equal(t, domain.StatusCancelledRider, *trip.CancelledBy)
+}
+
+func TestRatingsAdjustmentsAndRoutesRequireAToken(t *testing.T) {
+	h, tripID := newServer(t, uuid.New(), uuid.New())
+	for _, path := range []string{"/ratings", "/adjustments"} {
+		require.Equal(t, http.StatusUnauthorized, post(h, "/v1/trips/"+tripID.String()+path, "").Code, path)
+	}
+	for _, path := range []string{
+		"/v1/trips/" + tripID.String() + "/ratings",
+		"/v1/users/" + uuid.NewString() + "/ratings",
+		"/v1/trips/" + tripID.String() + "/route",
+	} {
+		require.Equal(t, http.StatusUnauthorized, get(h, path, "").Code, path)
+	}
+}
+
+func TestBookingAndQuotingRequireAToken(t *testing.T) {
+	h, _ := newServer(t, uuid.New(), uuid.New())
+	for _, path := range []string{"/v1/trips", "/v1/quotes"} {
+		require.Equal(t, http.StatusUnauthorized, post(h, path, "").Code, path)
+	}
+}
+
+func TestSearchOnlyFindsTheCallersTrips(t *testing.T) {
+	riderID, driverID := uuid.New(), uuid.New()
+	h, tripID := newServer(t, riderID, driverID)
+
+	require.Equal(t, http.StatusUnauthorized, get(h, "/v1/trips", "").Code)
+	require.Equal(t, http.StatusForbidden, get(h, "/v1/trips?rider_id="+riderID.String(), token(t, auth.RoleRider, uuid.New())).Code)
+
+	for _, bearer := range []string{token(t, auth.RoleDriver, driverID), token(t, auth.RoleAdmin, uuid.New())} {
+		rec := get(h, "/v1/trips", bearer)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page service.SearchTripsResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		require.Len(t, page.Trips, 1)
+		require.Equal(t, tripID, page.Trips[0].ID)
+	}
+
+	rec := get(h, "/v1/trips", token(t, auth.RoleRider, uuid.New()))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page service.SearchTripsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Empty(t, page.Trips)
+}
+
+func TestIdempotencyKeysOnlyReplayToTheirCaller(t *testing.T) {
+	riderID, driverID := uuid.New(), uuid.New()
+	h, tripID := newServer(t, riderID, driverID, handler.WithIdempotency(idempotency.NewMemoryStore(nil), idempotency.Config{}))
+	cancel := "/v1/trips/" + tripID.String() + "/cancel"
+
+	first := serve(h, http.MethodPost, cancel, token(t, auth.RoleRider, riderID), idempotency.Header, "k1")
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+	retry := serve(h, http.MethodPost, cancel, token(t, auth.RoleRider, riderID), idempotency.Header, "k1")
+	require.Equal(t, "true", retry.Header().Get(idempotency.ReplayedHeader))
+	require.Equal(t, first.Body.String(), retry.Body.String())
+
+	other := serve(h, http.MethodPost, cancel, token(t, auth.RoleDriver, driverID), idempotency.Header, "k1")
+	require.Empty(t, other.Header().Get(idempotency.ReplayedHeader), "another caller's key never replays")
+	require.Equal(t, http.StatusConflict, other.Code, other.Body.String())
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/surge"
+)
+
+// Surge exposes the current surge multipliers per geohash cell.
+type Surge struct {
+	engine *surge.Engine
+}
+
+// NewSurge constructs a surge handler.
+func NewSurge(engine *surge.Engine) *Surge {
+	return &Surge{engine: engine}
+}
+
+// Router serves GET / with every tracked cell, or only the cell containing
+// ?lat=&lng= when both are given. Mount it at /v1/surge.
+func (h *Surge) Router() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", h.list)
+	return r
+}
+
+func (h *Surge) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("lat") == "" && q.Get("lng") == "" {
+		writeJSON(w, http.StatusOK, map[string]any{"cells": h.engine.Cells()})
+		return
+	}
+	lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(q.Get("lng"), 64)
+	if errLat != nil || errLng != nil {
+		http.Error(w, "invalid lat/lng", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.engine.At(domain.GeoPoint{Lat: lat, Lng: lng}))
+}
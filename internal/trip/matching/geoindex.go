@@ -12,31 +12,54 @@ import (
 
 const defaultGeoKey = "driver:locs"
 
+// upsertLocationScript moves driver ARGV[1] to longitude ARGV[2] and latitude
+// ARGV[3] in the bare key KEYS[1] and, unless ARGV[4] is empty, in the key
+// KEYS[3] of product ARGV[4], dropping them from the key of the product the
+// hash KEYS[2] last recorded for them.
+var upsertLocationScript = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[2], ARGV[1])
+if previous and previous ~= ARGV[4] then
+  redis.call('ZREM', KEYS[1] .. ':' .. previous, ARGV[1])
+end
+redis.call('GEOADD', KEYS[1], ARGV[2], ARGV[3], ARGV[1])
+if ARGV[4] == '' then
+  redis.call('HDEL', KEYS[2], ARGV[1])
+  return 1
+end
+redis.call('GEOADD', KEYS[3], ARGV[2], ARGV[3], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[4])
+return 1
+`)
+
 // RedisGeoIndex persists driver locations in Redis using the GEO* family of
-// commands.
+// commands. Every product has its own GEO key, "<key>:<vehicle type>", so
+// searches for one product never see drivers of another; the bare key holds
+// every driver for unfiltered searches. The hash "<key>:product-of" remembers
+// which product key each driver was last added to.
 type RedisGeoIndex struct {
-	client redis.GeoCmdable
+	client redis.Cmdable
 	key    string
 }
 
 // NewRedisGeoIndex constructs a GEO-backed index. The provided client must be
 // safe for concurrent use (go-redis clients satisfy this requirement).
-func NewRedisGeoIndex(client redis.GeoCmdable, key string) *RedisGeoIndex {
+func NewRedisGeoIndex(client redis.Cmdable, key string) *RedisGeoIndex {
 	if key == "" {
 		key = defaultGeoKey
 	}
 	return &RedisGeoIndex{client: client, key: key}
 }
 
-// Nearby queries Redis for the closest drivers using GEOSEARCH.
-func (g *RedisGeoIndex) Nearby(ctx context.Context, p domain.GeoPoint, radiusKM float64, k int) ([]uuid.UUID, error) {
+// Nearby queries Redis for the closest drivers of vehicleType using
+// GEOSEARCH. An empty vehicleType searches every driver.
+func (g *RedisGeoIndex) Nearby(ctx context.Context, p domain.GeoPoint, radiusKM float64, k int, vehicleType string) ([]uuid.UUID, error) {
 	if k <= 0 {
 		return nil, nil
 	}
 	if radiusKM <= 0 {
 		radiusKM = 5 // sensible default radius in kilometres
 	}
-	locations, err := g.client.GeoSearchLocation(ctx, g.key, &redis.GeoSearchQuery{
+	locations, err := g.client.GeoSearchLocation(ctx, g.productKey(vehicleType), &redis.GeoSearchQuery{
 		Longitude:  p.Lng,
 		Latitude:   p.Lat,
 		Radius:     radiusKM,
@@ -59,11 +82,25 @@ func (g *RedisGeoIndex) Nearby(ctx context.Context, p domain.GeoPoint, radiusKM
 	return results, nil
 }
 
-// UpsertLocation stores or updates a driver's position inside the GEO index.
-func (g *RedisGeoIndex) UpsertLocation(ctx context.Context, driverID uuid.UUID, p domain.GeoPoint) error {
-	return g.client.GeoAdd(ctx, g.key, &redis.GeoLocation{
-		Longitude: p.Lng,
-		Latitude:  p.Lat,
-		Name:      driverID.String(),
-	}).Err()
+// UpsertLocation stores or updates a driver's position inside the GEO index
+// of their vehicle type. Every key changes atomically in one script, and a
+// driver who switched products is removed from the previous product's key.
+func (g *RedisGeoIndex) UpsertLocation(ctx context.Context, driverID uuid.UUID, vehicleType string, p domain.GeoPoint) error {
+	keys := []string{g.key, g.productsKey(), g.productKey(vehicleType)}
+	err := upsertLocationScript.Run(ctx, g.client, keys, driverID.String(), p.Lng, p.Lat, vehicleType).Err()
+	if err != nil {
+		return fmt.Errorf("redis upsert location: %w", err)
+	}
+	return nil
+}
+
+func (g *RedisGeoIndex) productKey(vehicleType string) string {
+	if vehicleType == "" {
+		return g.key
+	}
+	return g.key + ":" + vehicleType
+}
+
+func (g *RedisGeoIndex) productsKey() string {
+	return g.key + ":product-of"
 }
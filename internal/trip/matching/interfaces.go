@@ -11,15 +11,56 @@ import (
 
 // GeoIndex exposes the ability to fetch nearby driver identifiers based on a
 // pickup coordinate. Implementations are expected to return drivers sorted by
-// proximity (closest first) and respect the provided limit.
+// proximity (closest first) and respect the provided limit. Only drivers of
+// vehicleType are returned unless it is empty.
 type GeoIndex interface {
-	Nearby(ctx context.Context, p domain.GeoPoint, radiusKM float64, k int) ([]uuid.UUID, error)
+	Nearby(ctx context.Context, p domain.GeoPoint, radiusKM float64, k int, vehicleType string) ([]uuid.UUID, error)
 }
 
-// ReservationStore coordinates exclusive driver reservations across the fleet.
+// ReservationStore coordinates driver reservations across the fleet. A
+// driver's reservation holds seats of their vehicle for one or more trips.
 // The TTL controls how long the reservation should be considered valid in the
 // underlying datastore.
 type ReservationStore interface {
+	// TryReserve reserves the driver exclusively for tripID.
 	TryReserve(ctx context.Context, driverID, tripID uuid.UUID, ttl time.Duration) (bool, error)
+	// TryReserveSeats adds hold to the driver's reservation if the seats held
+	// for other trips leave room for it.
+	TryReserveSeats(ctx context.Context, driverID uuid.UUID, hold SeatHold, ttl time.Duration) (bool, error)
+	// Release drops every hold of the driver.
 	Release(ctx context.Context, driverID uuid.UUID) error
+	// ReleaseSeats drops the driver's hold for tripID only.
+	ReleaseSeats(ctx context.Context, driverID, tripID uuid.UUID) error
+}
+
+// SeatHold asks for Seats of a vehicle with Capacity seats on behalf of TripID.
+type SeatHold struct {
+	TripID   uuid.UUID
+	Seats    int
+	Capacity int
+	// Occupied lists the seats of the driver's assigned trips. They count
+	// against Capacity whether or not their own hold has expired.
+	Occupied map[uuid.UUID]int
+}
+
+// exclusive is the hold TryReserve places: the whole vehicle for one trip.
+func exclusive(tripID uuid.UUID) SeatHold {
+	return SeatHold{TripID: tripID, Seats: 1, Capacity: 1}
+}
+
+// fits reports whether hold fits next to the seats already held, counting
+// every other trip once whether it is held, occupied or both.
+func (h SeatHold) fits(held map[uuid.UUID]int) bool {
+	used := 0
+	for tripID, seats := range h.Occupied {
+		if tripID != h.TripID {
+			used += seats
+		}
+	}
+	for tripID, seats := range held {
+		if _, counted := h.Occupied[tripID]; !counted && tripID != h.TripID {
+			used += seats
+		}
+	}
+	return used+h.Seats <= h.Capacity
 }
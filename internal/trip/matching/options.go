@@ -0,0 +1,79 @@
+package matching
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// TripFinder searches stored trips. domain.Repository satisfies it.
+type TripFinder interface {
+	SearchTrips(ctx context.Context, filter domain.TripFilter, after *domain.TripCursor, limit int) ([]domain.Trip, error)
+}
+
+// Option customises a matcher.
+type Option func(*options)
+
+type options struct {
+	trips TripFinder
+}
+
+// WithActiveTrips makes the matcher skip drivers that already have an active
+// trip in trips. Reservations only live for their TTL, so without it a driver
+// whose reservation expired mid-trip can be offered a second one.
+func WithActiveTrips(trips TripFinder) Option {
+	return func(o *options) { o.trips = trips }
+}
+
+func buildOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// seatHold asks for trip's seats in driverID's vehicle. With WithActiveTrips
+// the seats of the driver's other active trips count as occupied.
+func (o options) seatHold(ctx context.Context, driverID uuid.UUID, trip domain.Trip, capacity int) (SeatHold, error) {
+	hold := SeatHold{TripID: trip.ID, Seats: trip.SeatCount(), Capacity: capacity, Occupied: make(map[uuid.UUID]int)}
+	if o.trips == nil {
+		return hold, nil
+	}
+	trips, err := o.trips.SearchTrips(ctx, domain.TripFilter{
+		DriverID: &driverID,
+		Statuses: domain.ActiveStatuses(),
+	}, nil, capacity+1)
+	if err != nil {
+		return SeatHold{}, fmt.Errorf("active trips of driver %s: %w", driverID, err)
+	}
+	for _, active := range trips {
+		if active.ID != trip.ID {
+			hold.Occupied[active.ID] = active.SeatCount()
+		}
+	}
+	return hold, nil
+}
+
+// busy reports whether driverID is on an active trip other than tripID.
+func (o options) busy(ctx context.Context, driverID, tripID uuid.UUID) (bool, error) {
+	if o.trips == nil {
+		return false, nil
+	}
+	trips, err := o.trips.SearchTrips(ctx, domain.TripFilter{
+		DriverID: &driverID,
+		Statuses: domain.ActiveStatuses(),
+	}, nil, 2)
+	if err != nil {
+		return false, fmt.Errorf("active trips of driver %s: %w", driverID, err)
+	}
+	for _, trip := range trips {
+		if trip.ID != tripID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
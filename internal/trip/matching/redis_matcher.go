@@ -2,7 +2,6 @@ package matching
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -17,7 +16,7 @@ import (
 )
 
 // ErrNoCandidate signals that no driver could be reserved.
-var ErrNoCandidate = errors.New("no candidate driver available")
+var ErrNoCandidate = fmt.Errorf("no candidate driver: %w", domain.ErrNoDriverAvailable)
 
 // RedisMatcherConfig defines tunable parameters for the matcher.
 type RedisMatcherConfig struct {
@@ -35,10 +34,11 @@ type RedisMatcher struct {
 	logger *zap.Logger
 	config RedisMatcherConfig
 	tracer trace.Tracer
+	opts   options
 }
 
 // NewRedisMatcher wires the matcher with the required collaborators.
-func NewRedisMatcher(geo GeoIndex, store ReservationStore, logger *zap.Logger, cfg RedisMatcherConfig) *RedisMatcher {
+func NewRedisMatcher(geo GeoIndex, store ReservationStore, logger *zap.Logger, cfg RedisMatcherConfig, opts ...Option) *RedisMatcher {
 	if cfg.RadiusKM <= 0 {
 		cfg.RadiusKM = 5
 	}
@@ -63,6 +63,7 @@ func NewRedisMatcher(geo GeoIndex, store ReservationStore, logger *zap.Logger, c
 		logger: logger,
 		config: cfg,
 		tracer: otel.Tracer("trip.matching.redis"),
+		opts:   buildOptions(opts),
 	}
 }
 
@@ -77,13 +78,26 @@ func (m *RedisMatcher) ReserveDriver(ctx context.Context, trip domain.Trip) (*uu
 
 	var lastErr error
 	for attempt := 1; attempt <= m.config.MaxAttempts; attempt++ {
-		candidates, err := m.geo.Nearby(ctx, trip.Pickup, m.config.RadiusKM, m.config.TopK)
+		candidates, err := m.geo.Nearby(ctx, trip.Pickup, m.config.RadiusKM, m.config.TopK+len(trip.DeclinedDrivers), trip.VehicleType)
 		if err != nil {
 			lastErr = fmt.Errorf("fetch candidates: %w", err)
 			break
 		}
 		m.logger.Debug("matching candidates", append(logFields, zap.Int("attempt", attempt), zap.Int("candidate_count", len(candidates)))...)
 		for _, driverID := range candidates {
+			if trip.HasDeclined(driverID) {
+				continue
+			}
+			busy, err := m.opts.busy(ctx, driverID, trip.ID)
+			if err != nil {
+				lastErr = err
+				m.logger.Warn("active trip lookup failed", append(logFields, zap.Error(err), zap.String("driver_id", driverID.String()))...)
+				continue
+			}
+			if busy {
+				assignmentAttempts.WithLabelValues("busy").Inc()
+				continue
+			}
 			reserved, err := m.store.TryReserve(ctx, driverID, trip.ID, m.config.ReserveTTL)
 			if err != nil {
 				lastErr = fmt.Errorf("reserve driver %s: %w", driverID, err)
@@ -123,6 +137,48 @@ func (m *RedisMatcher) ReserveDriver(ctx context.Context, trip domain.Trip) (*uu
 	return nil, ErrNoCandidate
 }
 
+// ReleaseDriver implements domain.MatchingEngine.
+func (m *RedisMatcher) ReleaseDriver(ctx context.Context, driverID uuid.UUID) error {
+	if err := m.store.Release(ctx, driverID); err != nil {
+		return err
+	}
+	m.logger.Info("driver released", zap.String("driver_id", driverID.String()))
+	return nil
+}
+
+// PoolCandidates implements domain.SeatReserver, searching the matcher's
+// radius.
+func (m *RedisMatcher) PoolCandidates(ctx context.Context, trip domain.Trip, k int) ([]uuid.UUID, error) {
+	candidates, err := m.geo.Nearby(ctx, trip.Pickup, m.config.RadiusKM, k, trip.VehicleType)
+	if err != nil {
+		return nil, fmt.Errorf("fetch pool candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+// ReserveSeats implements domain.SeatReserver.
+func (m *RedisMatcher) ReserveSeats(ctx context.Context, driverID uuid.UUID, trip domain.Trip, capacity int) (bool, error) {
+	hold, err := m.opts.seatHold(ctx, driverID, trip, capacity)
+	if err != nil {
+		return false, err
+	}
+	reserved, err := m.store.TryReserveSeats(ctx, driverID, hold, m.config.ReserveTTL)
+	if err != nil {
+		return false, fmt.Errorf("reserve seats of driver %s: %w", driverID, err)
+	}
+	label := "pool_full"
+	if reserved {
+		label = "pooled"
+	}
+	assignmentAttempts.WithLabelValues(label).Inc()
+	return reserved, nil
+}
+
+// ReleaseSeats implements domain.SeatReserver.
+func (m *RedisMatcher) ReleaseSeats(ctx context.Context, driverID, tripID uuid.UUID) error {
+	return m.store.ReleaseSeats(ctx, driverID, tripID)
+}
+
 func (m *RedisMatcher) backoffForAttempt(attempt int) time.Duration {
 	if attempt <= 0 {
 		return m.config.Backoff
@@ -3,6 +3,7 @@ package matching
 import (
 	"context"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -49,6 +50,76 @@ func TestRedisReservationStoreContention(t *testing.T) {
 	require.True(t, reuse, "reservation should succeed after TTL expiry")
 }
 
+func TestRedisReservationStoreHoldsSeatsUpToCapacity(t *testing.T) {
+	ctx := context.Background()
+	client := startRedis(t, ctx)
+	store := NewRedisReservationStore(client, "")
+	driverID := uuid.New()
+	tripA, tripB, tripC, tripD, riding := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	hold := func(tripID uuid.UUID, seats int, occupied map[uuid.UUID]int) bool {
+		t.Helper()
+		ok, err := store.TryReserveSeats(ctx, driverID, SeatHold{TripID: tripID, Seats: seats, Capacity: 3, Occupied: occupied}, 5*time.Second)
+		require.NoError(t, err)
+		return ok
+	}
+
+	require.True(t, hold(tripA, 2, nil))
+	require.False(t, hold(tripB, 2, nil), "two seats are not left")
+	require.True(t, hold(tripC, 1, nil))
+	require.True(t, hold(tripA, 2, map[uuid.UUID]int{tripA: 2}), "a trip's own hold does not count against it")
+
+	key := "reserve:seats:" + driverID.String()
+	require.Equal(t, "hash", client.Type(ctx, key).Val())
+	require.Equal(t, map[string]string{tripA.String(): "2", tripC.String(): "1"}, client.HGetAll(ctx, key).Val())
+	require.Greater(t, client.PTTL(ctx, key).Val(), time.Duration(0))
+
+	require.NoError(t, store.ReleaseSeats(ctx, driverID, tripA))
+	// Occupied trips count once, whether or not they still hold seats.
+	require.False(t, hold(tripB, 2, map[uuid.UUID]int{riding: 1, tripC: 1}))
+	require.True(t, hold(tripB, 2, map[uuid.UUID]int{tripC: 1}))
+	require.False(t, hold(tripD, 1, nil))
+
+	require.NoError(t, store.Release(ctx, driverID))
+	require.Zero(t, client.Exists(ctx, key).Val())
+}
+
+func TestRedisGeoIndexMovesDriversBetweenProducts(t *testing.T) {
+	ctx := context.Background()
+	client := startRedis(t, ctx)
+	geo := NewRedisGeoIndex(client, "")
+	driverID := uuid.New()
+	point := domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}
+
+	require.NoError(t, geo.UpsertLocation(ctx, driverID, "economy", point))
+	require.NoError(t, geo.UpsertLocation(ctx, driverID, "xl", point))
+
+	economy, err := geo.Nearby(ctx, point, 1, 10, "economy")
+	require.NoError(t, err)
+	require.Empty(t, economy, "the driver left the economy key")
+	xl, err := geo.Nearby(ctx, point, 1, 10, "xl")
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{driverID}, xl)
+	all, err := geo.Nearby(ctx, point, 1, 10, "")
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{driverID}, all)
+
+	// Concurrent switches leave the driver in exactly one product key.
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, geo.UpsertLocation(ctx, driverID, []string{"economy", "xl"}[i%2], point))
+		}()
+	}
+	wg.Wait()
+	economy, err = geo.Nearby(ctx, point, 1, 10, "economy")
+	require.NoError(t, err)
+	xl, err = geo.Nearby(ctx, point, 1, 10, "xl")
+	require.NoError(t, err)
+	require.Len(t, append(economy, xl...), 1)
+}
+
 func TestRedisMatcherSkipsBusyDriver(t *testing.T) {
 	ctx := context.Background()
 	client := startRedis(t, ctx)
@@ -58,8 +129,10 @@ func TestRedisMatcherSkipsBusyDriver(t *testing.T) {
 
 	driverBusy := uuid.New()
 	driverFree := uuid.New()
-	require.NoError(t, geo.UpsertLocation(ctx, driverBusy, domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}))
-	require.NoError(t, geo.UpsertLocation(ctx, driverFree, domain.GeoPoint{Lat: 37.7750, Lng: -122.4195}))
+	driverXL := uuid.New()
+	require.NoError(t, geo.UpsertLocation(ctx, driverBusy, "economy", domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}))
+	require.NoError(t, geo.UpsertLocation(ctx, driverXL, "xl", domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}))
+	require.NoError(t, geo.UpsertLocation(ctx, driverFree, "economy", domain.GeoPoint{Lat: 37.7750, Lng: -122.4195}))
 
 	busyTrip := uuid.New()
 	reserved, err := store.TryReserve(ctx, driverBusy, busyTrip, 5*time.Second)
@@ -74,7 +147,7 @@ func TestRedisMatcherSkipsBusyDriver(t *testing.T) {
 		Backoff:     10 * time.Millisecond,
 	})
 
-	trip := domain.Trip{ID: uuid.New(), Pickup: domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}}
+	trip := domain.Trip{ID: uuid.New(), VehicleType: "economy", Pickup: domain.GeoPoint{Lat: 37.7749, Lng: -122.4194}}
 	selected, err := matcher.ReserveDriver(ctx, trip)
 	require.NoError(t, err)
 	require.NotNil(t, selected)
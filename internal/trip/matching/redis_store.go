@@ -3,16 +3,51 @@ package matching
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
-const defaultReservationPrefix = "reserve:driver:"
+// defaultReservationPrefix names the reservation hashes. Reservations used to
+// be plain strings under "reserve:driver:"; the new prefix keeps a rollout
+// from running the seat script against those keys.
+const defaultReservationPrefix = "reserve:seats:"
 
-// RedisReservationStore coordinates driver reservations by relying on Redis
-// SETNX semantics. A TTL is attached to every reservation to avoid stale locks.
+// reserveSeatsScript adds a seat hold to a driver's reservation hash, which
+// maps trip IDs to seats, if the seats already held leave room for it.
+// Trips listed as occupied count once whether or not they still hold seats.
+//
+// KEYS[1] reservation hash
+// ARGV[1] trip ID, ARGV[2] seats, ARGV[3] capacity, ARGV[4] TTL in ms,
+// ARGV[5...] occupied trip ID and seat pairs.
+var reserveSeatsScript = redis.NewScript(`
+local counted = {}
+local used = 0
+for i = 5, #ARGV, 2 do
+  if ARGV[i] ~= ARGV[1] then
+    counted[ARGV[i]] = true
+    used = used + tonumber(ARGV[i + 1])
+  end
+end
+local held = redis.call('HGETALL', KEYS[1])
+for i = 1, #held, 2 do
+  if held[i] ~= ARGV[1] and not counted[held[i]] then
+    used = used + tonumber(held[i + 1])
+  end
+end
+if used + tonumber(ARGV[2]) > tonumber(ARGV[3]) then
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// RedisReservationStore coordinates driver reservations in a Redis hash per
+// driver, updated atomically by a script. A TTL is attached to every
+// reservation to avoid stale locks.
 type RedisReservationStore struct {
 	client     redis.Cmdable
 	keyPrefix  string
@@ -28,24 +63,45 @@ func NewRedisReservationStore(client redis.Cmdable, prefix string) *RedisReserva
 	return &RedisReservationStore{client: client, keyPrefix: prefix}
 }
 
-// TryReserve attempts to acquire a reservation using SET NX EX.
+// TryReserve attempts to reserve the whole vehicle for tripID.
 func (r *RedisReservationStore) TryReserve(ctx context.Context, driverID, tripID uuid.UUID, ttl time.Duration) (bool, error) {
+	return r.TryReserveSeats(ctx, driverID, exclusive(tripID), ttl)
+}
+
+// TryReserveSeats implements ReservationStore. Adding a hold extends the
+// TTL of the driver's whole reservation.
+func (r *RedisReservationStore) TryReserveSeats(ctx context.Context, driverID uuid.UUID, hold SeatHold, ttl time.Duration) (bool, error) {
 	if ttl <= 0 {
 		ttl = 10 * time.Second
 	}
-	key := r.keyPrefix + driverID.String()
-	ok, err := r.client.SetNX(ctx, key, tripID.String(), ttl).Result()
+	args := make([]any, 0, 4+2*len(hold.Occupied))
+	args = append(args, hold.TripID.String(), hold.Seats, hold.Capacity, ttl.Milliseconds())
+	for tripID, seats := range hold.Occupied {
+		args = append(args, tripID.String(), strconv.Itoa(seats))
+	}
+	ok, err := reserveSeatsScript.Run(ctx, r.client, []string{r.key(driverID)}, args...).Int()
 	if err != nil {
-		return false, fmt.Errorf("redis setnx: %w", err)
+		return false, fmt.Errorf("redis reserve seats: %w", err)
 	}
-	return ok, nil
+	return ok == 1, nil
 }
 
 // Release removes the reservation key.
 func (r *RedisReservationStore) Release(ctx context.Context, driverID uuid.UUID) error {
-	key := r.keyPrefix + driverID.String()
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	if err := r.client.Del(ctx, r.key(driverID)).Err(); err != nil {
 		return fmt.Errorf("redis del: %w", err)
 	}
 	return nil
 }
+
+// ReleaseSeats removes the hold of tripID from the driver's reservation.
+func (r *RedisReservationStore) ReleaseSeats(ctx context.Context, driverID, tripID uuid.UUID) error {
+	if err := r.client.HDel(ctx, r.key(driverID), tripID.String()).Err(); err != nil {
+		return fmt.Errorf("redis hdel: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisReservationStore) key(driverID uuid.UUID) string {
+	return r.keyPrefix + driverID.String()
+}
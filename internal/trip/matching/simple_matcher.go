@@ -2,7 +2,6 @@ package matching
 
 import (
 	"context"
-	"errors"
 	"sync"
 	"time"
 
@@ -12,30 +11,42 @@ import (
 )
 
 // ErrNoDriver indicates there is no driver available for reservation.
-var ErrNoDriver = errors.New("no driver available")
+var ErrNoDriver = domain.ErrNoDriverAvailable
 
 // SimpleMatcher implements MatchingEngine using provided dependencies.
 type SimpleMatcher struct {
 	index GeoIndex
 	store ReservationStore
 	limit int
+	opts  options
 }
 
 // NewSimpleMatcher constructs the matcher.
-func NewSimpleMatcher(index GeoIndex, store ReservationStore, limit int) *SimpleMatcher {
+func NewSimpleMatcher(index GeoIndex, store ReservationStore, limit int, opts ...Option) *SimpleMatcher {
 	if limit <= 0 {
 		limit = 3
 	}
-	return &SimpleMatcher{index: index, store: store, limit: limit}
+	return &SimpleMatcher{index: index, store: store, limit: limit, opts: buildOptions(opts)}
 }
 
-// ReserveDriver selects the first reservable driver.
+// ReserveDriver selects the first reservable driver that has not declined the
+// trip and, with WithActiveTrips, is not on another trip.
 func (m *SimpleMatcher) ReserveDriver(ctx context.Context, trip domain.Trip) (*uuid.UUID, error) {
-	candidates, err := m.index.Nearby(ctx, trip.Pickup, 0, m.limit)
+	candidates, err := m.index.Nearby(ctx, trip.Pickup, 0, m.limit+len(trip.DeclinedDrivers), trip.VehicleType)
 	if err != nil {
 		return nil, err
 	}
 	for _, driverID := range candidates {
+		if trip.HasDeclined(driverID) {
+			continue
+		}
+		busy, err := m.opts.busy(ctx, driverID, trip.ID)
+		if err != nil {
+			return nil, err
+		}
+		if busy {
+			continue
+		}
 		reserved, err := m.store.TryReserve(ctx, driverID, trip.ID, time.Minute)
 		if err != nil {
 			return nil, err
@@ -47,6 +58,30 @@ func (m *SimpleMatcher) ReserveDriver(ctx context.Context, trip domain.Trip) (*u
 	return nil, ErrNoDriver
 }
 
+// ReleaseDriver implements domain.MatchingEngine.
+func (m *SimpleMatcher) ReleaseDriver(ctx context.Context, driverID uuid.UUID) error {
+	return m.store.Release(ctx, driverID)
+}
+
+// PoolCandidates implements domain.SeatReserver.
+func (m *SimpleMatcher) PoolCandidates(ctx context.Context, trip domain.Trip, k int) ([]uuid.UUID, error) {
+	return m.index.Nearby(ctx, trip.Pickup, 0, k, trip.VehicleType)
+}
+
+// ReserveSeats implements domain.SeatReserver.
+func (m *SimpleMatcher) ReserveSeats(ctx context.Context, driverID uuid.UUID, trip domain.Trip, capacity int) (bool, error) {
+	hold, err := m.opts.seatHold(ctx, driverID, trip, capacity)
+	if err != nil {
+		return false, err
+	}
+	return m.store.TryReserveSeats(ctx, driverID, hold, time.Minute)
+}
+
+// ReleaseSeats implements domain.SeatReserver.
+func (m *SimpleMatcher) ReleaseSeats(ctx context.Context, driverID, tripID uuid.UUID) error {
+	return m.store.ReleaseSeats(ctx, driverID, tripID)
+}
+
 // MemorySource is a trivial in-memory candidate implementation.
 type MemorySource struct {
 	mu              sync.RWMutex
@@ -59,7 +94,7 @@ func NewMemorySource() *MemorySource {
 	return &MemorySource{driverByVehicle: make(map[uuid.UUID]string)}
 }
 
-// UpsertDriver stores driver coordinate hashed cell.
+// UpsertDriver registers a driver and the vehicle type they drive.
 func (m *MemorySource) UpsertDriver(_ context.Context, driverID uuid.UUID, vehicleType string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -69,8 +104,9 @@ func (m *MemorySource) UpsertDriver(_ context.Context, driverID uuid.UUID, vehic
 	m.driverByVehicle[driverID] = vehicleType
 }
 
-// Nearby returns deterministic order for tests irrespective of coordinates.
-func (m *MemorySource) Nearby(_ context.Context, _ domain.GeoPoint, _ float64, limit int) ([]uuid.UUID, error) {
+// Nearby returns drivers of vehicleType in registration order, irrespective
+// of coordinates, so tests stay deterministic.
+func (m *MemorySource) Nearby(_ context.Context, _ domain.GeoPoint, _ float64, limit int, vehicleType string) ([]uuid.UUID, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if limit <= 0 || limit > len(m.drivers) {
@@ -78,33 +114,44 @@ func (m *MemorySource) Nearby(_ context.Context, _ domain.GeoPoint, _ float64, l
 	}
 	ids := make([]uuid.UUID, 0, limit)
 	for _, driverID := range m.drivers {
-		ids = append(ids, driverID)
 		if len(ids) == limit {
 			break
 		}
+		if vehicleType != "" && m.driverByVehicle[driverID] != vehicleType {
+			continue
+		}
+		ids = append(ids, driverID)
 	}
 	return ids, nil
 }
 
-// MemoryReservationStore ensures exclusive reservation.
+// MemoryReservationStore keeps seat holds per driver. Holds do not expire.
 type MemoryReservationStore struct {
 	mu       sync.Mutex
-	reserved map[uuid.UUID]uuid.UUID
+	reserved map[uuid.UUID]map[uuid.UUID]int
 }
 
 // NewMemoryReservationStore constructs MemoryReservationStore.
 func NewMemoryReservationStore() *MemoryReservationStore {
-	return &MemoryReservationStore{reserved: make(map[uuid.UUID]uuid.UUID)}
+	return &MemoryReservationStore{reserved: make(map[uuid.UUID]map[uuid.UUID]int)}
 }
 
 // TryReserve attempts to reserve a driver for trip.
-func (m *MemoryReservationStore) TryReserve(_ context.Context, driverID uuid.UUID, tripID uuid.UUID, _ time.Duration) (bool, error) {
+func (m *MemoryReservationStore) TryReserve(ctx context.Context, driverID uuid.UUID, tripID uuid.UUID, ttl time.Duration) (bool, error) {
+	return m.TryReserveSeats(ctx, driverID, exclusive(tripID), ttl)
+}
+
+// TryReserveSeats implements ReservationStore.
+func (m *MemoryReservationStore) TryReserveSeats(_ context.Context, driverID uuid.UUID, hold SeatHold, _ time.Duration) (bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.reserved[driverID]; exists {
+	if !hold.fits(m.reserved[driverID]) {
 		return false, nil
 	}
-	m.reserved[driverID] = tripID
+	if m.reserved[driverID] == nil {
+		m.reserved[driverID] = make(map[uuid.UUID]int)
+	}
+	m.reserved[driverID][hold.TripID] = hold.Seats
 	return true, nil
 }
 
@@ -115,3 +162,14 @@ func (m *MemoryReservationStore) Release(_ context.Context, driverID uuid.UUID)
 	delete(m.reserved, driverID)
 	return nil
 }
+
+// ReleaseSeats implements ReservationStore.
+func (m *MemoryReservationStore) ReleaseSeats(_ context.Context, driverID, tripID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.reserved[driverID], tripID)
+	if len(m.reserved[driverID]) == 0 {
+		delete(m.reserved, driverID)
+	}
+	return nil
+}
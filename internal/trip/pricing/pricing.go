@@ -0,0 +1,144 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// ErrUnknownVehicleType indicates there is no rate card for a vehicle type.
+var ErrUnknownVehicleType = domain.ErrUnknownVehicleType
+
+// Fare line codes.
+const (
+	LineBase              = "base_fare"
+	LineDistance          = "distance"
+	LineTime              = "time"
+	LineStops             = "stops"
+	LineMinimumAdjustment = "minimum_fare_adjustment"
+	LineUpfrontAdjustment = "upfront_price_adjustment"
+	LineSurge             = "surge"
+)
+
+// RateCard holds one tariff. Rate cards are keyed by the pricing key of the
+// catalog products that use them.
+type RateCard = domain.RateCard
+
+// DefaultRateCards returns the tariffs used when none are configured.
+func DefaultRateCards() map[string]RateCard {
+	return map[string]RateCard{
+		"economy":   {BaseFareCents: 250, PerKMCents: 120, PerMinuteCents: 25, PerStopCents: 150, MinimumFareCents: 700},
+		"comfort":   {BaseFareCents: 350, PerKMCents: 150, PerMinuteCents: 30, PerStopCents: 175, MinimumFareCents: 900},
+		"xl":        {BaseFareCents: 400, PerKMCents: 180, PerMinuteCents: 35, PerStopCents: 200, MinimumFareCents: 1000},
+		"motorbike": {BaseFareCents: 100, PerKMCents: 70, PerMinuteCents: 10, PerStopCents: 100, MinimumFareCents: 300},
+		"pool":      {BaseFareCents: 200, PerKMCents: 90, PerMinuteCents: 15, PerStopCents: 0, MinimumFareCents: 500},
+	}
+}
+
+// Ride describes what is being priced.
+type Ride struct {
+	// VehicleType selects the rate card; callers pass the product's pricing key.
+	VehicleType string
+	DistanceKM  float64
+	Duration    time.Duration
+	// Stops is the number of intermediate stops.
+	Stops int
+	// RateCard, when set, prices the ride instead of the engine's card for
+	// VehicleType.
+	RateCard *RateCard
+	// SurgeMultiplier scales the fare when above 1.
+	SurgeMultiplier float64
+}
+
+// Fare is the result of pricing a ride.
+type Fare struct {
+	TotalCents int64
+	Lines      []domain.FareLine
+}
+
+// Engine calculates fares from per vehicle type rate cards.
+type Engine struct {
+	cards map[string]RateCard
+}
+
+// NewEngine constructs an engine. A nil map falls back to DefaultRateCards.
+func NewEngine(cards map[string]RateCard) *Engine {
+	if cards == nil {
+		cards = DefaultRateCards()
+	}
+	copied := make(map[string]RateCard, len(cards))
+	for vehicleType, card := range cards {
+		copied[vehicleType] = card
+	}
+	return &Engine{cards: copied}
+}
+
+// Supports reports whether vehicleType has a rate card.
+func (e *Engine) Supports(vehicleType string) bool {
+	_, ok := e.cards[vehicleType]
+	return ok
+}
+
+// RateCard returns the rate card of vehicleType.
+func (e *Engine) RateCard(vehicleType string) (RateCard, error) {
+	card, ok := e.cards[vehicleType]
+	if !ok {
+		return RateCard{}, fmt.Errorf("%w: %q", ErrUnknownVehicleType, vehicleType)
+	}
+	return card, nil
+}
+
+// Calculate prices ride as base fare plus distance, time and stop components,
+// topped up to the vehicle type's minimum fare and then scaled by surge.
+func (e *Engine) Calculate(ride Ride) (Fare, error) {
+	var card RateCard
+	if ride.RateCard != nil {
+		card = *ride.RateCard
+	} else {
+		var err error
+		if card, err = e.RateCard(ride.VehicleType); err != nil {
+			return Fare{}, err
+		}
+	}
+	lines := []domain.FareLine{
+		{Code: LineBase, AmountCents: card.BaseFareCents},
+		{Code: LineDistance, AmountCents: round(ride.DistanceKM * float64(card.PerKMCents))},
+		{Code: LineTime, AmountCents: round(ride.Duration.Minutes() * float64(card.PerMinuteCents))},
+	}
+	if ride.Stops > 0 {
+		lines = append(lines, domain.FareLine{Code: LineStops, AmountCents: int64(ride.Stops) * card.PerStopCents})
+	}
+	var total int64
+	for _, line := range lines {
+		total += line.AmountCents
+	}
+	if total < card.MinimumFareCents {
+		lines = append(lines, domain.FareLine{Code: LineMinimumAdjustment, AmountCents: card.MinimumFareCents - total})
+		total = card.MinimumFareCents
+	}
+	if ride.SurgeMultiplier > 1 {
+		surge := round(float64(total) * (ride.SurgeMultiplier - 1))
+		lines = append(lines, domain.FareLine{Code: LineSurge, AmountCents: surge})
+		total += surge
+	}
+	return Fare{TotalCents: total, Lines: lines}, nil
+}
+
+// Lock settles f at an agreed upfront price, recording the difference to the
+// metered total as an adjustment line.
+func (f Fare) Lock(priceCents int64) Fare {
+	lines := append([]domain.FareLine(nil), f.Lines...)
+	if diff := priceCents - f.TotalCents; diff != 0 {
+		lines = append(lines, domain.FareLine{Code: LineUpfrontAdjustment, AmountCents: diff})
+	}
+	return Fare{TotalCents: priceCents, Lines: lines}
+}
+
+func round(cents float64) int64 {
+	if cents < 0 {
+		return 0
+	}
+	return int64(math.Round(cents))
+}
@@ -0,0 +1,53 @@
+package pricing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/pricing"
+)
+
+func TestCalculateItemisesFare(t *testing.T) {
+	engine := pricing.NewEngine(map[string]pricing.RateCard{
+		"sedan": {BaseFareCents: 200, PerKMCents: 100, PerMinuteCents: 20, MinimumFareCents: 500},
+	})
+
+	fare, err := engine.Calculate(pricing.Ride{VehicleType: "sedan", DistanceKM: 10.5, Duration: 20 * time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, int64(200+1050+400), fare.TotalCents)
+	require.Equal(t, []domain.FareLine{
+		{Code: pricing.LineBase, AmountCents: 200},
+		{Code: pricing.LineDistance, AmountCents: 1050},
+		{Code: pricing.LineTime, AmountCents: 400},
+	}, fare.Lines)
+}
+
+func TestCalculateAppliesMinimumFare(t *testing.T) {
+	engine := pricing.NewEngine(map[string]pricing.RateCard{
+		"sedan": {BaseFareCents: 200, PerKMCents: 100, PerMinuteCents: 20, MinimumFareCents: 500},
+	})
+
+	fare, err := engine.Calculate(pricing.Ride{VehicleType: "sedan", DistanceKM: 1, Duration: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, int64(500), fare.TotalCents)
+	require.Equal(t, domain.FareLine{Code: pricing.LineMinimumAdjustment, AmountCents: 180}, fare.Lines[len(fare.Lines)-1])
+}
+
+func TestCalculateRejectsUnknownVehicleType(t *testing.T) {
+	_, err := pricing.NewEngine(nil).Calculate(pricing.Ride{VehicleType: "hovercraft"})
+	require.ErrorIs(t, err, domain.ErrUnknownVehicleType)
+}
+
+func TestCalculateAppliesSurgeAfterMinimumFare(t *testing.T) {
+	engine := pricing.NewEngine(map[string]pricing.RateCard{
+		"sedan": {BaseFareCents: 200, PerKMCents: 100, PerMinuteCents: 20, MinimumFareCents: 500},
+	})
+
+	fare, err := engine.Calculate(pricing.Ride{VehicleType: "sedan", DistanceKM: 1, Duration: time.Minute, SurgeMultiplier: 1.5})
+	require.NoError(t, err)
+	require.Equal(t, int64(750), fare.TotalCents)
+	require.Equal(t, domain.FareLine{Code: pricing.LineSurge, AmountCents: 250}, fare.Lines[len(fare.Lines)-1])
+}
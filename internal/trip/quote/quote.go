@@ -0,0 +1,121 @@
+package quote
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+var (
+	// ErrInvalid indicates a token that is malformed or was not signed by us.
+	ErrInvalid = domain.ErrQuoteInvalid
+	// ErrExpired indicates a genuine token whose validity has lapsed.
+	ErrExpired = domain.ErrQuoteExpired
+)
+
+// Quote is the upfront price offered to a rider for a specific ride.
+type Quote struct {
+	ID          uuid.UUID
+	RiderID     uuid.UUID
+	VehicleType string
+	Pickup      domain.GeoPoint
+	Dropoff     domain.GeoPoint
+	Stops       []domain.GeoPoint
+	PriceCents  int64
+	ExpiresAt   time.Time
+}
+
+type claims struct {
+	RiderID     string            `json:"rider_id"`
+	VehicleType string            `json:"vehicle_type"`
+	Pickup      domain.GeoPoint   `json:"pickup"`
+	Dropoff     domain.GeoPoint   `json:"dropoff"`
+	Stops       []domain.GeoPoint `json:"stops,omitempty"`
+	PriceCents  int64             `json:"price_cents"`
+	jwt.RegisteredClaims
+}
+
+// Signer issues and verifies HMAC signed quote tokens.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// DefaultTTL applies when NewSigner is given a non-positive ttl.
+const DefaultTTL = 2 * time.Minute
+
+// NewSigner constructs a signer. now is used both to stamp new quotes and to
+// check expiry of presented ones.
+func NewSigner(secret []byte, ttl time.Duration, now func() time.Time) *Signer {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &Signer{secret: secret, ttl: ttl, now: now}
+}
+
+// Issue stamps q with an identifier and expiry and returns it with its token.
+func (s *Signer) Issue(q Quote) (Quote, string, error) {
+	issuedAt := s.now()
+	q.ID = uuid.New()
+	// Tokens carry whole seconds; truncate so the quote matches its token.
+	q.ExpiresAt = issuedAt.Add(s.ttl).UTC().Truncate(time.Second)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RiderID:     q.RiderID.String(),
+		VehicleType: q.VehicleType,
+		Pickup:      q.Pickup,
+		Dropoff:     q.Dropoff,
+		Stops:       q.Stops,
+		PriceCents:  q.PriceCents,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        q.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(q.ExpiresAt),
+		},
+	})
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return Quote{}, "", fmt.Errorf("sign quote: %w", err)
+	}
+	return q, signed, nil
+}
+
+// Verify checks the token's signature and expiry and returns its quote.
+func (s *Signer) Verify(token string) (Quote, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (any, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(s.now))
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return Quote{}, ErrExpired
+	case err != nil:
+		return Quote{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return Quote{}, fmt.Errorf("%w: quote id", ErrInvalid)
+	}
+	riderID, err := uuid.Parse(c.RiderID)
+	if err != nil {
+		return Quote{}, fmt.Errorf("%w: rider id", ErrInvalid)
+	}
+	return Quote{
+		ID:          id,
+		RiderID:     riderID,
+		VehicleType: c.VehicleType,
+		Pickup:      c.Pickup,
+		Dropoff:     c.Dropoff,
+		Stops:       c.Stops,
+		PriceCents:  c.PriceCents,
+		ExpiresAt:   c.ExpiresAt.Time.UTC(),
+	}, nil
+}
@@ -0,0 +1,50 @@
+package quote_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/quote"
+)
+
+func TestVerifyRoundTripsIssuedQuote(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	signer := quote.NewSigner([]byte("secret"), time.Minute, func() time.Time { return now })
+
+	issued, token, err := signer.Issue(quote.Quote{
+		RiderID:     uuid.New(),
+		VehicleType: "sedan",
+		Pickup:      domain.GeoPoint{Lat: 1, Lng: 2},
+		Dropoff:     domain.GeoPoint{Lat: 3, Lng: 4},
+		PriceCents:  1234,
+	})
+	require.NoError(t, err)
+
+	verified, err := signer.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, issued, verified)
+}
+
+func TestVerifyRejectsExpiredAndTamperedTokens(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	signer := quote.NewSigner([]byte("secret"), time.Minute, func() time.Time { return now })
+	_, token, err := signer.Issue(quote.Quote{RiderID: uuid.New(), VehicleType: "sedan", PriceCents: 1234})
+	require.NoError(t, err)
+
+	forger := quote.NewSigner([]byte("other"), time.Minute, func() time.Time { return now })
+	_, forged, err := forger.Issue(quote.Quote{RiderID: uuid.New(), VehicleType: "sedan", PriceCents: 1})
+	require.NoError(t, err)
+	_, err = signer.Verify(forged)
+	require.ErrorIs(t, err, domain.ErrQuoteInvalid)
+
+	_, err = signer.Verify(token[:len(token)-2] + "xx")
+	require.ErrorIs(t, err, domain.ErrQuoteInvalid)
+
+	now = now.Add(2 * time.Minute)
+	_, err = signer.Verify(token)
+	require.ErrorIs(t, err, domain.ErrQuoteExpired)
+}
@@ -2,8 +2,9 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -11,24 +12,38 @@ import (
 )
 
 // ErrNotFound indicates missing entities.
-var ErrNotFound = errors.New("trip not found")
+var ErrNotFound = domain.ErrTripNotFound
 
 // MemoryRepository provides an in-memory implementation suitable for tests and local demos.
 type MemoryRepository struct {
-	mu     sync.RWMutex
-	trips  map[uuid.UUID]domain.Trip
-	events []domain.TripEvent
+	mu        sync.RWMutex
+	trips     map[uuid.UUID]domain.Trip
+	events    []domain.TripEvent
+	ratings   []domain.Rating
+	summaries map[summaryKey]domain.RatingSummary
+	// adjustments is append-only, like the fare_adjustments table.
+	adjustments []domain.FareAdjustment
+	pools       map[uuid.UUID]domain.Pool
+	breadcrumbs map[uuid.UUID][]domain.Breadcrumb
 }
 
 // NewMemoryRepository constructs an empty memory repository.
 func NewMemoryRepository() *MemoryRepository {
-	return &MemoryRepository{trips: make(map[uuid.UUID]domain.Trip)}
+	return &MemoryRepository{
+		trips:       make(map[uuid.UUID]domain.Trip),
+		summaries:   make(map[summaryKey]domain.RatingSummary),
+		pools:       make(map[uuid.UUID]domain.Pool),
+		breadcrumbs: make(map[uuid.UUID][]domain.Breadcrumb),
+	}
 }
 
 // CreateTrip stores the trip and returns it.
 func (m *MemoryRepository) CreateTrip(_ context.Context, trip domain.Trip) (domain.Trip, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if err := m.checkActive(trip); err != nil {
+		return domain.Trip{}, err
+	}
 	m.trips[trip.ID] = trip
 	return trip, nil
 }
@@ -52,19 +67,130 @@ func (m *MemoryRepository) UpdateTrip(_ context.Context, trip domain.Trip) (doma
 	if !ok {
 		return domain.Trip{}, ErrNotFound
 	}
+	if existing.Version != trip.Version {
+		return domain.Trip{}, domain.ErrVersionConflict
+	}
+	if err := m.checkActive(trip); err != nil {
+		return domain.Trip{}, err
+	}
 	trip.Version = existing.Version + 1
 	m.trips[trip.ID] = trip
 	return trip, nil
 }
 
+// ListTripsByStatus returns trips in status ordered by request time.
+func (m *MemoryRepository) ListTripsByStatus(_ context.Context, status domain.TripStatus, limit int) ([]domain.Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var trips []domain.Trip
+	for _, trip := range m.trips {
+		if trip.Status == status {
+			trips = append(trips, trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].RequestedAt.Before(trips[j].RequestedAt) })
+	if limit > 0 && len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
+// ListScheduledTrips returns SCHEDULED trips picking up after pickupAfter and
+// by pickupBefore, earliest pickup first.
+func (m *MemoryRepository) ListScheduledTrips(_ context.Context, pickupAfter, pickupBefore time.Time, limit int) ([]domain.Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var trips []domain.Trip
+	for _, trip := range m.trips {
+		if trip.Status == domain.StatusScheduled && trip.PickupAt != nil && trip.PickupAt.After(pickupAfter) && !trip.PickupAt.After(pickupBefore) {
+			trips = append(trips, trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].PickupAt.Before(*trips[j].PickupAt) })
+	if limit > 0 && len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
+// ListUnmatchedTrips returns REQUESTED trips whose matching started by
+// startedBefore, earliest start first.
+func (m *MemoryRepository) ListUnmatchedTrips(_ context.Context, startedBefore time.Time, lead time.Duration, limit int) ([]domain.Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var trips []domain.Trip
+	for _, trip := range m.trips {
+		if trip.Status == domain.StatusRequested && !trip.MatchingStartedAt(lead).After(startedBefore) {
+			trips = append(trips, trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].MatchingStartedAt(lead).Before(trips[j].MatchingStartedAt(lead)) })
+	if limit > 0 && len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
+// SearchTrips returns trips matching filter, newest request first.
+func (m *MemoryRepository) SearchTrips(_ context.Context, filter domain.TripFilter, after *domain.TripCursor, limit int) ([]domain.Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var trips []domain.Trip
+	for _, trip := range m.trips {
+		if filter.Matches(trip) && (after == nil || after.Before(trip)) {
+			trips = append(trips, trip)
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return domain.CursorAfter(trips[i]).Before(trips[j])
+	})
+	if limit > 0 && len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
 // CreateTripEvent appends events to an in-memory buffer.
 func (m *MemoryRepository) CreateTripEvent(_ context.Context, event domain.TripEvent) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.events = append(m.events, event)
+	m.appendEvents(event)
+	return nil
+}
+
+// ListTripEvents returns the events of tripID in insertion order.
+func (m *MemoryRepository) ListTripEvents(_ context.Context, tripID uuid.UUID) ([]domain.TripEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var events []domain.TripEvent
+	for _, event := range m.events {
+		if event.TripID == tripID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// checkActive enforces one active trip per rider and per driver, standing in
+// for the partial unique indexes on the trips table. Callers must hold m.mu.
+func (m *MemoryRepository) checkActive(trip domain.Trip) error {
+	for _, other := range m.trips {
+		if err := trip.ConflictsWith(other); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// appendEvents assigns sequential identifiers like the trip_events id column.
+// Callers must hold m.mu.
+func (m *MemoryRepository) appendEvents(events ...domain.TripEvent) {
+	for _, event := range events {
+		event.ID = int64(len(m.events) + 1)
+		m.events = append(m.events, event)
+	}
+}
+
 // Events returns stored events (for tests).
 func (m *MemoryRepository) Events() []domain.TripEvent {
 	m.mu.RLock()
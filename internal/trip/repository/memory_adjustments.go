@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// CreateFareAdjustment appends adjustment.
+func (m *MemoryRepository) CreateFareAdjustment(_ context.Context, adjustment domain.FareAdjustment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adjustments = append(m.adjustments, adjustment)
+	return nil
+}
+
+// ListFareAdjustments returns the adjustments of tripID oldest first.
+func (m *MemoryRepository) ListFareAdjustments(_ context.Context, tripID uuid.UUID) ([]domain.FareAdjustment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var adjustments []domain.FareAdjustment
+	for _, adjustment := range m.adjustments {
+		if adjustment.TripID == tripID {
+			adjustments = append(adjustments, adjustment)
+		}
+	}
+	return adjustments, nil
+}
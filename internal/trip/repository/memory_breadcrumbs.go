@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// AppendBreadcrumb stores crumb.
+func (m *MemoryRepository) AppendBreadcrumb(_ context.Context, crumb domain.Breadcrumb) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.breadcrumbs[crumb.TripID] = append(m.breadcrumbs[crumb.TripID], crumb)
+	return nil
+}
+
+// ListBreadcrumbs returns the breadcrumbs of tripID oldest first.
+func (m *MemoryRepository) ListBreadcrumbs(_ context.Context, tripID uuid.UUID) ([]domain.Breadcrumb, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	crumbs := append([]domain.Breadcrumb(nil), m.breadcrumbs[tripID]...)
+	sort.SliceStable(crumbs, func(i, j int) bool { return crumbs[i].RecordedAt.Before(crumbs[j].RecordedAt) })
+	return crumbs, nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// GetPool returns the shared route id, or domain.ErrPoolNotFound.
+func (m *MemoryRepository) GetPool(_ context.Context, id uuid.UUID) (domain.Pool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pool, ok := m.pools[id]
+	if !ok {
+		return domain.Pool{}, domain.ErrPoolNotFound
+	}
+	pool.Waypoints = slices.Clone(pool.Waypoints)
+	return pool, nil
+}
+
+// SavePool inserts or updates pool with optimistic locking on its version.
+func (m *MemoryRepository) SavePool(_ context.Context, pool domain.Pool) (domain.Pool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pools[pool.ID].Version != pool.Version {
+		return domain.Pool{}, domain.ErrVersionConflict
+	}
+	pool.Version++
+	pool.Waypoints = slices.Clone(pool.Waypoints)
+	m.pools[pool.ID] = pool
+	return pool, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+type summaryKey struct {
+	userID uuid.UUID
+	role   domain.Party
+}
+
+// CreateRating stores rating and updates the ratee's summary.
+func (m *MemoryRepository) CreateRating(_ context.Context, rating domain.Rating, span int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkRating(rating); err != nil {
+		return err
+	}
+	m.applyRating(rating, span)
+	return nil
+}
+
+// ListTripRatings returns the ratings of tripID in the order they were given.
+func (m *MemoryRepository) ListTripRatings(_ context.Context, tripID uuid.UUID) ([]domain.Rating, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ratings []domain.Rating
+	for _, rating := range m.ratings {
+		if rating.TripID == tripID {
+			ratings = append(ratings, rating)
+		}
+	}
+	return ratings, nil
+}
+
+// GetRatingSummaries returns userID's summaries ordered by role.
+func (m *MemoryRepository) GetRatingSummaries(_ context.Context, userID uuid.UUID) ([]domain.RatingSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var summaries []domain.RatingSummary
+	for key, summary := range m.summaries {
+		if key.userID == userID {
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Role < summaries[j].Role })
+	return summaries, nil
+}
+
+// checkRating enforces one rating per rater and trip, like the primary key of
+// trip_ratings. Callers must hold m.mu.
+func (m *MemoryRepository) checkRating(rating domain.Rating) error {
+	for _, existing := range m.ratings {
+		if existing.TripID == rating.TripID && existing.RaterID == rating.RaterID {
+			return domain.ErrAlreadyRated
+		}
+	}
+	return nil
+}
+
+// applyRating stores rating and folds it into the ratee's summary. Callers
+// must hold m.mu.
+func (m *MemoryRepository) applyRating(rating domain.Rating, span int) {
+	m.ratings = append(m.ratings, rating)
+	key := summaryKey{userID: rating.RateeID, role: rating.RateeRole}
+	summary, ok := m.summaries[key]
+	if !ok {
+		summary = domain.RatingSummary{UserID: rating.RateeID, Role: rating.RateeRole}
+	}
+	m.summaries[key] = summary.Add(rating.Stars, span, rating.CreatedAt)
+}
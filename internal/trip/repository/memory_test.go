@@ -0,0 +1,80 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/repository"
+)
+
+func TestMemoryRepositoryRejectsStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	trip, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:          uuid.New(),
+		RiderID:     uuid.New(),
+		Status:      domain.StatusRequested,
+		RequestedAt: time.Unix(0, 0).UTC(),
+		Version:     1,
+	})
+	require.NoError(t, err)
+
+	first := trip
+	first.Status = domain.StatusCancelledRider
+	updated, err := repo.UpdateTrip(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), updated.Version)
+
+	stale := trip
+	stale.Status = domain.StatusDriverAssigned
+	_, err = repo.UpdateTrip(ctx, stale)
+	require.ErrorIs(t, err, domain.ErrVersionConflict)
+
+	stored, err := repo.GetTripByID(ctx, trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCancelledRider, stored.Status)
+
+	_, err = repo.UpdateTrip(ctx, domain.Trip{ID: uuid.New()})
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestMemoryUnitOfWorkRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	sink := &recordingPublisher{}
+	uow := repository.NewMemoryUnitOfWork(repo, sink)
+	trip := domain.Trip{ID: uuid.New(), Status: domain.StatusRequested}
+
+	errBoom := errors.New("boom")
+	err := uow.Do(ctx, func(tx domain.Tx) error {
+		if _, err := tx.Trips().CreateTrip(ctx, trip); err != nil {
+			return err
+		}
+		if err := tx.Trips().CreateTripEvent(ctx, domain.TripEvent{TripID: trip.ID, Type: domain.EventTripRequested}); err != nil {
+			return err
+		}
+		if err := tx.Outbox().Publish(ctx, domain.TripEvent{TripID: trip.ID, Type: domain.EventTripRequested}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	require.ErrorIs(t, err, errBoom)
+
+	_, err = repo.GetTripByID(ctx, trip.ID)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+	require.Empty(t, repo.Events())
+	require.Empty(t, sink.events)
+}
+
+type recordingPublisher struct{ events []domain.TripEvent }
+
+func (r *recordingPublisher) Publish(_ context.Context, event domain.TripEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// MemoryUnitOfWork stages writes against a MemoryRepository and applies them
+// atomically on commit. Committed outbox events are handed to sink, which
+// stands in for the outbox worker when no database is configured.
+type MemoryUnitOfWork struct {
+	mu   sync.Mutex
+	repo *MemoryRepository
+	sink domain.EventPublisher
+}
+
+// NewMemoryUnitOfWork constructs a unit of work over repo. sink may be nil.
+func NewMemoryUnitOfWork(repo *MemoryRepository, sink domain.EventPublisher) *MemoryUnitOfWork {
+	return &MemoryUnitOfWork{repo: repo, sink: sink}
+}
+
+// Do implements domain.UnitOfWork.
+func (u *MemoryUnitOfWork) Do(ctx context.Context, fn func(tx domain.Tx) error) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	tx := &memoryTx{
+		repo:     u.repo,
+		trips:    make(map[uuid.UUID]domain.Trip),
+		base:     make(map[uuid.UUID]int64),
+		pools:    make(map[uuid.UUID]domain.Pool),
+		poolBase: make(map[uuid.UUID]int64),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := u.repo.commit(tx); err != nil {
+		return err
+	}
+	if u.sink != nil {
+		for _, event := range tx.outbox {
+			// Best effort: without a database there is no durable outbox to retry from.
+			_ = u.sink.Publish(ctx, event)
+		}
+	}
+	return nil
+}
+
+// newTrip marks a staged trip that did not exist before the transaction.
+const newTrip = -1
+
+type memoryTx struct {
+	repo    *MemoryRepository
+	trips   map[uuid.UUID]domain.Trip
+	base    map[uuid.UUID]int64
+	events  []domain.TripEvent
+	outbox  []domain.TripEvent
+	ratings []stagedRating
+	// adjustments are staged fare adjustments.
+	adjustments []domain.FareAdjustment
+	// pools are staged shared routes; poolBase holds the committed version
+	// each was based on.
+	pools    map[uuid.UUID]domain.Pool
+	poolBase map[uuid.UUID]int64
+}
+
+type stagedRating struct {
+	rating domain.Rating
+	span   int
+}
+
+func (t *memoryTx) Trips() domain.Repository                     { return t }
+func (t *memoryTx) Ratings() domain.RatingRepository             { return memoryRatings{tx: t} }
+func (t *memoryTx) Adjustments() domain.FareAdjustmentRepository { return t }
+func (t *memoryTx) Pools() domain.PoolRepository                 { return memoryPools{tx: t} }
+func (t *memoryTx) Outbox() domain.EventPublisher                { return memoryOutbox{tx: t} }
+
+func (t *memoryTx) CreateTrip(_ context.Context, trip domain.Trip) (domain.Trip, error) {
+	t.trips[trip.ID] = trip
+	t.base[trip.ID] = newTrip
+	return trip, nil
+}
+
+func (t *memoryTx) GetTripByID(ctx context.Context, id uuid.UUID) (domain.Trip, error) {
+	if trip, ok := t.trips[id]; ok {
+		return trip, nil
+	}
+	return t.repo.GetTripByID(ctx, id)
+}
+
+func (t *memoryTx) UpdateTrip(ctx context.Context, trip domain.Trip) (domain.Trip, error) {
+	existing, err := t.GetTripByID(ctx, trip.ID)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if existing.Version != trip.Version {
+		return domain.Trip{}, domain.ErrVersionConflict
+	}
+	if _, staged := t.base[trip.ID]; !staged {
+		t.base[trip.ID] = existing.Version
+	}
+	trip.Version = existing.Version + 1
+	t.trips[trip.ID] = trip
+	return trip, nil
+}
+
+// ListTripsByStatus reads committed state only; staged writes are not visible.
+func (t *memoryTx) ListTripsByStatus(ctx context.Context, status domain.TripStatus, limit int) ([]domain.Trip, error) {
+	return t.repo.ListTripsByStatus(ctx, status, limit)
+}
+
+// ListScheduledTrips reads committed state only; staged writes are not visible.
+func (t *memoryTx) ListScheduledTrips(ctx context.Context, pickupAfter, pickupBefore time.Time, limit int) ([]domain.Trip, error) {
+	return t.repo.ListScheduledTrips(ctx, pickupAfter, pickupBefore, limit)
+}
+
+// ListUnmatchedTrips reads committed state only; staged writes are not visible.
+func (t *memoryTx) ListUnmatchedTrips(ctx context.Context, startedBefore time.Time, lead time.Duration, limit int) ([]domain.Trip, error) {
+	return t.repo.ListUnmatchedTrips(ctx, startedBefore, lead, limit)
+}
+
+// SearchTrips reads committed state only; staged writes are not visible.
+func (t *memoryTx) SearchTrips(ctx context.Context, filter domain.TripFilter, after *domain.TripCursor, limit int) ([]domain.Trip, error) {
+	return t.repo.SearchTrips(ctx, filter, after, limit)
+}
+
+// ListTripEvents reads committed events only.
+func (t *memoryTx) ListTripEvents(ctx context.Context, tripID uuid.UUID) ([]domain.TripEvent, error) {
+	return t.repo.ListTripEvents(ctx, tripID)
+}
+
+func (t *memoryTx) CreateTripEvent(_ context.Context, event domain.TripEvent) error {
+	t.events = append(t.events, event)
+	return nil
+}
+
+func (t *memoryTx) CreateFareAdjustment(_ context.Context, adjustment domain.FareAdjustment) error {
+	t.adjustments = append(t.adjustments, adjustment)
+	return nil
+}
+
+// ListFareAdjustments reads committed adjustments only.
+func (t *memoryTx) ListFareAdjustments(ctx context.Context, tripID uuid.UUID) ([]domain.FareAdjustment, error) {
+	return t.repo.ListFareAdjustments(ctx, tripID)
+}
+
+// memoryRatings stages ratings; reads see committed state only.
+type memoryRatings struct {
+	tx *memoryTx
+}
+
+func (r memoryRatings) CreateRating(_ context.Context, rating domain.Rating, span int) error {
+	for _, staged := range r.tx.ratings {
+		if staged.rating.TripID == rating.TripID && staged.rating.RaterID == rating.RaterID {
+			return domain.ErrAlreadyRated
+		}
+	}
+	r.tx.ratings = append(r.tx.ratings, stagedRating{rating: rating, span: span})
+	return nil
+}
+
+func (r memoryRatings) ListTripRatings(ctx context.Context, tripID uuid.UUID) ([]domain.Rating, error) {
+	return r.tx.repo.ListTripRatings(ctx, tripID)
+}
+
+func (r memoryRatings) GetRatingSummaries(ctx context.Context, userID uuid.UUID) ([]domain.RatingSummary, error) {
+	return r.tx.repo.GetRatingSummaries(ctx, userID)
+}
+
+// memoryPools stages pools like memoryTx stages trips.
+type memoryPools struct {
+	tx *memoryTx
+}
+
+func (p memoryPools) GetPool(ctx context.Context, id uuid.UUID) (domain.Pool, error) {
+	if pool, ok := p.tx.pools[id]; ok {
+		return pool, nil
+	}
+	return p.tx.repo.GetPool(ctx, id)
+}
+
+func (p memoryPools) SavePool(ctx context.Context, pool domain.Pool) (domain.Pool, error) {
+	current, err := p.GetPool(ctx, pool.ID)
+	if err != nil && !errors.Is(err, domain.ErrPoolNotFound) {
+		return domain.Pool{}, err
+	}
+	if current.Version != pool.Version {
+		return domain.Pool{}, domain.ErrVersionConflict
+	}
+	if _, staged := p.tx.poolBase[pool.ID]; !staged {
+		p.tx.poolBase[pool.ID] = current.Version
+	}
+	pool.Version++
+	p.tx.pools[pool.ID] = pool
+	return pool, nil
+}
+
+type memoryOutbox struct {
+	tx *memoryTx
+}
+
+func (o memoryOutbox) Publish(_ context.Context, event domain.TripEvent) error {
+	o.tx.outbox = append(o.tx.outbox, event)
+	return nil
+}
+
+// commit applies staged writes, re-checking versions against concurrent
+// writers that bypassed the unit of work.
+func (m *MemoryRepository) commit(tx *memoryTx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, base := range tx.base {
+		if base == newTrip {
+			continue
+		}
+		existing, ok := m.trips[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if existing.Version != base {
+			return domain.ErrVersionConflict
+		}
+	}
+	for _, trip := range tx.trips {
+		if err := m.checkActive(trip); err != nil {
+			return err
+		}
+	}
+	for _, staged := range tx.ratings {
+		if err := m.checkRating(staged.rating); err != nil {
+			return err
+		}
+	}
+	for id, base := range tx.poolBase {
+		if m.pools[id].Version != base {
+			return domain.ErrVersionConflict
+		}
+	}
+	for _, staged := range tx.ratings {
+		m.applyRating(staged.rating, staged.span)
+	}
+	m.adjustments = append(m.adjustments, tx.adjustments...)
+	for id, pool := range tx.pools {
+		m.pools[id] = pool
+	}
+	for id, trip := range tx.trips {
+		m.trips[id] = trip
+	}
+	m.appendEvents(tx.events...)
+	return nil
+}
@@ -0,0 +1,483 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+const (
+	uniqueViolation    = "23505"
+	exclusionViolation = "23P01"
+	// Partial unique index from migrations/000011_one_active_trip.sql.
+	activeRiderIndex = "trips_one_active_per_rider_idx"
+	// Exclusion constraint from migrations/000015_pooled_rides.sql; drivers may
+	// only hold several active trips of the same pool.
+	activeDriverConstraint = "trips_one_active_pool_per_driver"
+)
+
+// The statements below mirror internal/db/queries/trips.sql and must be kept
+// in sync with it.
+const (
+	createTripQuery = `INSERT INTO trips (
+    id, version, rider_id, driver_id, pickup, dropoff, vehicle_type, status,
+    requested_at, accepted_at, started_at, finished_at, cancelled_at,
+    cancelled_by, price_cents, arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown, quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card
+) VALUES (
+    $1, $2, $3, $4, ST_SetSRID(ST_Point($5, $6), 4326), ST_SetSRID(ST_Point($7, $8), 4326), $9, $10,
+    $11, $12, $13, $14, $15,
+    $16, $17, $18, $19, $20,
+    $21, $22, $23, $24, $25, $26, $27, $28,
+    $29, $30, $31, $32, $33, $34
+)`
+
+	tripSelectColumns = `id, version, rider_id, driver_id,
+    ST_Y(pickup), ST_X(pickup), ST_Y(dropoff), ST_X(dropoff),
+    vehicle_type, status, requested_at, accepted_at, started_at,
+    finished_at, cancelled_at, cancelled_by, price_cents,
+    arrived_at, cancel_reason, cancellation_fee_cents,
+    accept_deadline, declined_drivers, fare_breakdown,
+    quote_id, upfront_price_cents, pickup_at, reminders_sent, stops,
+    driver_penalty_cents, adjustment_cents, seats, pool_id, driven_meters, rate_card`
+
+	getTripQuery = `SELECT ` + tripSelectColumns + `
+FROM trips
+WHERE id = $1
+LIMIT 1`
+
+	listTripsByStatusQuery = `SELECT ` + tripSelectColumns + `
+FROM trips
+WHERE status = $1
+ORDER BY requested_at
+LIMIT $2`
+
+	updateTripQuery = `UPDATE trips
+SET
+    rider_id = $3,
+    driver_id = $4,
+    pickup = ST_SetSRID(ST_Point($5, $6), 4326),
+    dropoff = ST_SetSRID(ST_Point($7, $8), 4326),
+    vehicle_type = $9,
+    status = $10,
+    requested_at = $11,
+    accepted_at = $12,
+    started_at = $13,
+    finished_at = $14,
+    cancelled_at = $15,
+    cancelled_by = $16,
+    price_cents = $17,
+    arrived_at = $18,
+    cancel_reason = $19,
+    cancellation_fee_cents = $20,
+    accept_deadline = $21,
+    declined_drivers = $22,
+    fare_breakdown = $23,
+    quote_id = $24,
+    upfront_price_cents = $25,
+    pickup_at = $26,
+    reminders_sent = $27,
+    stops = $28,
+    driver_penalty_cents = $29,
+    adjustment_cents = $30,
+    seats = $31,
+    pool_id = $32,
+    driven_meters = $33,
+    rate_card = $34,
+    version = version + 1
+WHERE id = $1 AND version = $2
+RETURNING version`
+
+	listScheduledTripsQuery = `SELECT ` + tripSelectColumns + `
+FROM trips
+WHERE status = 'SCHEDULED' AND pickup_at > $1 AND pickup_at <= $2
+ORDER BY pickup_at
+LIMIT $3`
+
+	// listUnmatchedTripsQuery orders by when matching started: the request
+	// time, or $1 seconds before pickup for scheduled rides released later.
+	listUnmatchedTripsQuery = `SELECT ` + tripSelectColumns + `
+FROM trips
+WHERE status = 'REQUESTED'
+  AND GREATEST(requested_at, pickup_at - make_interval(secs => $1::double precision)) <= $2
+ORDER BY GREATEST(requested_at, pickup_at - make_interval(secs => $1::double precision)), id
+LIMIT $3`
+
+	// searchTripsQuery treats NULL parameters and an empty status array as
+	// "no filter". $6/$7 hold the keyset cursor.
+	searchTripsQuery = `SELECT ` + tripSelectColumns + `
+FROM trips
+WHERE ($1::uuid IS NULL OR rider_id = $1)
+  AND ($2::uuid IS NULL OR driver_id = $2)
+  AND (cardinality($3::text[]) = 0 OR status = ANY($3))
+  AND ($4::timestamptz IS NULL OR requested_at >= $4)
+  AND ($5::timestamptz IS NULL OR requested_at < $5)
+  AND ($6::timestamptz IS NULL OR (requested_at, id) < ($6, $7::uuid))
+ORDER BY requested_at DESC, id DESC
+LIMIT $8`
+
+	getTripVersionQuery = `SELECT version FROM trips WHERE id = $1`
+
+	createTripEventQuery = `INSERT INTO trip_events (trip_id, event_type, payload, created_at)
+VALUES ($1, $2, $3, COALESCE($4, now()))`
+
+	listTripEventsQuery = `SELECT id, trip_id, event_type, payload, created_at
+FROM trip_events
+WHERE trip_id = $1
+ORDER BY id`
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// PostgresRepository persists trips in the trips/trip_events tables created
+// by migrations/000001_init.sql.
+type PostgresRepository struct {
+	db dbtx
+}
+
+// NewPostgresRepository constructs a repository backed by the given pool.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateTrip inserts a new trip row.
+func (r *PostgresRepository) CreateTrip(ctx context.Context, trip domain.Trip) (domain.Trip, error) {
+	if trip.Version == 0 {
+		trip.Version = 1
+	}
+	_, err := r.db.ExecContext(ctx, createTripQuery, tripArgs(trip)...)
+	if err != nil {
+		if active := activeTripViolation(err); active != nil {
+			return domain.Trip{}, active
+		}
+		return domain.Trip{}, fmt.Errorf("insert trip: %w", err)
+	}
+	return trip, nil
+}
+
+// GetTripByID loads a trip, returning ErrNotFound when it does not exist.
+func (r *PostgresRepository) GetTripByID(ctx context.Context, id uuid.UUID) (domain.Trip, error) {
+	trip, err := scanTrip(r.db.QueryRowContext(ctx, getTripQuery, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Trip{}, ErrNotFound
+	}
+	if err != nil {
+		return domain.Trip{}, fmt.Errorf("select trip: %w", err)
+	}
+	return trip, nil
+}
+
+// UpdateTrip writes the trip if the stored version still matches
+// trip.Version and returns it with the incremented version.
+func (r *PostgresRepository) UpdateTrip(ctx context.Context, trip domain.Trip) (domain.Trip, error) {
+	var version int64
+	err := r.db.QueryRowContext(ctx, updateTripQuery, tripArgs(trip)...).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Trip{}, r.missingOrConflict(ctx, trip.ID)
+	}
+	if err != nil {
+		if active := activeTripViolation(err); active != nil {
+			return domain.Trip{}, active
+		}
+		return domain.Trip{}, fmt.Errorf("update trip: %w", err)
+	}
+	trip.Version = version
+	return trip, nil
+}
+
+// ListTripsByStatus returns up to limit trips in status, oldest request first.
+func (r *PostgresRepository) ListTripsByStatus(ctx context.Context, status domain.TripStatus, limit int) ([]domain.Trip, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return r.listTrips(ctx, listTripsByStatusQuery, string(status), limit)
+}
+
+// ListScheduledTrips returns up to limit SCHEDULED trips picking up after
+// pickupAfter and by pickupBefore, earliest pickup first.
+func (r *PostgresRepository) ListScheduledTrips(ctx context.Context, pickupAfter, pickupBefore time.Time, limit int) ([]domain.Trip, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return r.listTrips(ctx, listScheduledTripsQuery, pickupAfter, pickupBefore, limit)
+}
+
+// ListUnmatchedTrips returns up to limit REQUESTED trips whose matching
+// started by startedBefore, earliest start first.
+func (r *PostgresRepository) ListUnmatchedTrips(ctx context.Context, startedBefore time.Time, lead time.Duration, limit int) ([]domain.Trip, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return r.listTrips(ctx, listUnmatchedTripsQuery, lead.Seconds(), startedBefore, limit)
+}
+
+// SearchTrips returns up to limit trips matching filter, newest request first.
+func (r *PostgresRepository) SearchTrips(ctx context.Context, filter domain.TripFilter, after *domain.TripCursor, limit int) ([]domain.Trip, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	statuses := make([]string, 0, len(filter.Statuses))
+	for _, status := range filter.Statuses {
+		statuses = append(statuses, string(status))
+	}
+	var (
+		afterAt *time.Time
+		afterID *uuid.UUID
+	)
+	if after != nil {
+		afterAt, afterID = &after.RequestedAt, &after.ID
+	}
+	return r.listTrips(ctx, searchTripsQuery,
+		filter.RiderID, filter.DriverID, statuses,
+		filter.RequestedFrom, filter.RequestedTo,
+		afterAt, afterID, limit,
+	)
+}
+
+func (r *PostgresRepository) listTrips(ctx context.Context, query string, args ...any) ([]domain.Trip, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list trips: %w", err)
+	}
+	defer rows.Close()
+	var trips []domain.Trip
+	for rows.Next() {
+		trip, err := scanTrip(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan trip: %w", err)
+		}
+		trips = append(trips, trip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate trips: %w", err)
+	}
+	return trips, nil
+}
+
+// CreateTripEvent appends an entry to trip_events.
+func (r *PostgresRepository) CreateTripEvent(ctx context.Context, event domain.TripEvent) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("marshal event payload: %w", err)
+	}
+	var createdAt *time.Time
+	if !event.CreatedAt.IsZero() {
+		createdAt = &event.CreatedAt
+	}
+	if _, err := r.db.ExecContext(ctx, createTripEventQuery, event.TripID, string(event.Type), string(payload), createdAt); err != nil {
+		return fmt.Errorf("insert trip event: %w", err)
+	}
+	return nil
+}
+
+// ListTripEvents returns the events of tripID ordered by insertion.
+func (r *PostgresRepository) ListTripEvents(ctx context.Context, tripID uuid.UUID) ([]domain.TripEvent, error) {
+	rows, err := r.db.QueryContext(ctx, listTripEventsQuery, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("list trip events: %w", err)
+	}
+	defer rows.Close()
+	var events []domain.TripEvent
+	for rows.Next() {
+		var (
+			event     domain.TripEvent
+			eventType string
+			payload   []byte
+		)
+		if err := rows.Scan(&event.ID, &event.TripID, &eventType, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan trip event: %w", err)
+		}
+		event.Type = domain.TripEventType(eventType)
+		event.CreatedAt = event.CreatedAt.UTC()
+		if event.Payload, err = domain.DecodeEventPayload(event.Type, payload); err != nil {
+			return nil, fmt.Errorf("decode trip event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate trip events: %w", err)
+	}
+	return events, nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// activeTripViolation maps a violation of the one-active-trip index and
+// constraint onto an *ActiveTripError. The conflicting trip is not known here:
+// the transaction is aborted, so the caller looks it up afterwards.
+func activeTripViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || (pgErr.Code != uniqueViolation && pgErr.Code != exclusionViolation) {
+		return nil
+	}
+	switch pgErr.ConstraintName {
+	case activeRiderIndex:
+		return &domain.ActiveTripError{Party: domain.PartyRider}
+	case activeDriverConstraint:
+		return &domain.ActiveTripError{Party: domain.PartyDriver}
+	}
+	return nil
+}
+
+// missingOrConflict distinguishes why a versioned update touched no rows.
+func (r *PostgresRepository) missingOrConflict(ctx context.Context, id uuid.UUID) error {
+	var current int64
+	err := r.db.QueryRowContext(ctx, getTripVersionQuery, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select trip version: %w", err)
+	}
+	return domain.ErrVersionConflict
+}
+
+// tripArgs returns the positional arguments shared by createTripQuery and
+// updateTripQuery: $1 id, $2 version, then the trip columns in order. New
+// columns are appended so existing placeholders keep their numbers.
+func tripArgs(trip domain.Trip) []any {
+	declined, _ := json.Marshal(trip.DeclinedDrivers)
+	fare, _ := json.Marshal(trip.FareBreakdown)
+	stops, _ := json.Marshal(trip.Stops)
+	var card sql.NullString
+	if trip.RateCard != nil {
+		encoded, _ := json.Marshal(trip.RateCard)
+		card = sql.NullString{String: string(encoded), Valid: true}
+	}
+	return []any{
+		trip.ID, trip.Version, trip.RiderID, trip.DriverID,
+		trip.Pickup.Lng, trip.Pickup.Lat, trip.Dropoff.Lng, trip.Dropoff.Lat,
+		trip.VehicleType, string(trip.Status),
+		trip.RequestedAt, trip.AcceptedAt, trip.StartedAt, trip.FinishedAt, trip.CancelledAt,
+		statusPtr(trip.CancelledBy), trip.PriceCents,
+		trip.ArrivedAt, string(trip.CancelReason), trip.CancellationFeeCents,
+		trip.AcceptDeadline, string(declined), string(fare),
+		trip.QuoteID, trip.UpfrontPriceCents, trip.PickupAt, trip.RemindersSent, string(stops),
+		trip.DriverPenaltyCents, trip.AdjustmentCents, trip.SeatCount(), trip.PoolID, trip.DrivenMeters, card,
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTrip(row rowScanner) (domain.Trip, error) {
+	var (
+		trip        domain.Trip
+		driverID    uuid.NullUUID
+		vehicleType sql.NullString
+		status      string
+		acceptedAt  sql.NullTime
+		startedAt   sql.NullTime
+		finishedAt  sql.NullTime
+		cancelledAt sql.NullTime
+		cancelledBy sql.NullString
+		priceCents  sql.NullInt64
+		arrivedAt   sql.NullTime
+		reason      sql.NullString
+		deadline    sql.NullTime
+		declined    []byte
+		fare        []byte
+		quoteID     uuid.NullUUID
+		pickupAt    sql.NullTime
+		stops       []byte
+		poolID      uuid.NullUUID
+		card        []byte
+	)
+	err := row.Scan(
+		&trip.ID, &trip.Version, &trip.RiderID, &driverID,
+		&trip.Pickup.Lat, &trip.Pickup.Lng, &trip.Dropoff.Lat, &trip.Dropoff.Lng,
+		&vehicleType, &status, &trip.RequestedAt, &acceptedAt, &startedAt,
+		&finishedAt, &cancelledAt, &cancelledBy, &priceCents,
+		&arrivedAt, &reason, &trip.CancellationFeeCents,
+		&deadline, &declined, &fare,
+		&quoteID, &trip.UpfrontPriceCents, &pickupAt, &trip.RemindersSent, &stops,
+		&trip.DriverPenaltyCents, &trip.AdjustmentCents, &trip.Seats, &poolID, &trip.DrivenMeters, &card,
+	)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if driverID.Valid {
+		id := driverID.UUID
+		trip.DriverID = &id
+	}
+	if poolID.Valid {
+		id := poolID.UUID
+		trip.PoolID = &id
+	}
+	trip.VehicleType = vehicleType.String
+	trip.Status = domain.TripStatus(status)
+	trip.AcceptedAt = timePtr(acceptedAt)
+	trip.StartedAt = timePtr(startedAt)
+	trip.FinishedAt = timePtr(finishedAt)
+	trip.CancelledAt = timePtr(cancelledAt)
+	if cancelledBy.Valid {
+		by := domain.TripStatus(cancelledBy.String)
+		trip.CancelledBy = &by
+	}
+	trip.PriceCents = priceCents.Int64
+	trip.ArrivedAt = timePtr(arrivedAt)
+	trip.CancelReason = domain.CancellationReason(reason.String)
+	trip.AcceptDeadline = timePtr(deadline)
+	if len(declined) > 0 {
+		if err := json.Unmarshal(declined, &trip.DeclinedDrivers); err != nil {
+			return domain.Trip{}, fmt.Errorf("decode declined_drivers: %w", err)
+		}
+	}
+	trip.PickupAt = timePtr(pickupAt)
+	if quoteID.Valid {
+		id := quoteID.UUID
+		trip.QuoteID = &id
+	}
+	if len(stops) > 0 {
+		if err := json.Unmarshal(stops, &trip.Stops); err != nil {
+			return domain.Trip{}, fmt.Errorf("decode stops: %w", err)
+		}
+	}
+	if len(fare) > 0 {
+		if err := json.Unmarshal(fare, &trip.FareBreakdown); err != nil {
+			return domain.Trip{}, fmt.Errorf("decode fare_breakdown: %w", err)
+		}
+	}
+	if len(card) > 0 {
+		trip.RateCard = new(domain.RateCard)
+		if err := json.Unmarshal(card, trip.RateCard); err != nil {
+			return domain.Trip{}, fmt.Errorf("decode rate_card: %w", err)
+		}
+	}
+	return trip, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.UTC()
+	return &v
+}
+
+func statusPtr(s *domain.TripStatus) *string {
+	if s == nil {
+		return nil
+	}
+	v := string(*s)
+	return &v
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// The statements below mirror internal/db/queries/fare_adjustments.sql and
+// must be kept in sync with it.
+const (
+	createFareAdjustmentQuery = `INSERT INTO fare_adjustments (id, trip_id, kind, amount_cents, reason, actor_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	listFareAdjustmentsQuery = `SELECT id, trip_id, kind, amount_cents, reason, actor_id, created_at
+FROM fare_adjustments
+WHERE trip_id = $1
+ORDER BY created_at, id`
+)
+
+// CreateFareAdjustment appends adjustment. Call it inside a unit of work
+// together with the trip update that applies it.
+func (r *PostgresRepository) CreateFareAdjustment(ctx context.Context, adjustment domain.FareAdjustment) error {
+	_, err := r.db.ExecContext(ctx, createFareAdjustmentQuery,
+		adjustment.ID, adjustment.TripID, string(adjustment.Kind), adjustment.AmountCents,
+		adjustment.Reason, adjustment.ActorID, adjustment.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert fare adjustment: %w", err)
+	}
+	return nil
+}
+
+// ListFareAdjustments returns the adjustments of tripID oldest first.
+func (r *PostgresRepository) ListFareAdjustments(ctx context.Context, tripID uuid.UUID) ([]domain.FareAdjustment, error) {
+	rows, err := r.db.QueryContext(ctx, listFareAdjustmentsQuery, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("list fare adjustments: %w", err)
+	}
+	defer rows.Close()
+	var adjustments []domain.FareAdjustment
+	for rows.Next() {
+		var (
+			adjustment domain.FareAdjustment
+			kind       string
+		)
+		if err := rows.Scan(&adjustment.ID, &adjustment.TripID, &kind, &adjustment.AmountCents,
+			&adjustment.Reason, &adjustment.ActorID, &adjustment.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan fare adjustment: %w", err)
+		}
+		adjustment.Kind = domain.AdjustmentKind(kind)
+		adjustment.CreatedAt = adjustment.CreatedAt.UTC()
+		adjustments = append(adjustments, adjustment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate fare adjustments: %w", err)
+	}
+	return adjustments, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// The statements below mirror internal/db/queries/breadcrumbs.sql and must be
+// kept in sync with it.
+const (
+	appendBreadcrumbQuery = `INSERT INTO trip_breadcrumbs (trip_id, location, speed, accuracy, recorded_at)
+VALUES ($1, ST_SetSRID(ST_Point($2, $3), 4326), $4, $5, $6)`
+
+	listBreadcrumbsQuery = `SELECT trip_id, ST_Y(location), ST_X(location), speed, accuracy, recorded_at
+FROM trip_breadcrumbs
+WHERE trip_id = $1
+ORDER BY recorded_at, id`
+)
+
+// AppendBreadcrumb inserts crumb.
+func (r *PostgresRepository) AppendBreadcrumb(ctx context.Context, crumb domain.Breadcrumb) error {
+	_, err := r.db.ExecContext(ctx, appendBreadcrumbQuery,
+		crumb.TripID, crumb.Point.Lng, crumb.Point.Lat, crumb.Speed, crumb.Accuracy, crumb.RecordedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert breadcrumb: %w", err)
+	}
+	return nil
+}
+
+// ListBreadcrumbs returns the breadcrumbs of tripID oldest first.
+func (r *PostgresRepository) ListBreadcrumbs(ctx context.Context, tripID uuid.UUID) ([]domain.Breadcrumb, error) {
+	rows, err := r.db.QueryContext(ctx, listBreadcrumbsQuery, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("list breadcrumbs: %w", err)
+	}
+	defer rows.Close()
+	var crumbs []domain.Breadcrumb
+	for rows.Next() {
+		var crumb domain.Breadcrumb
+		if err := rows.Scan(
+			&crumb.TripID, &crumb.Point.Lat, &crumb.Point.Lng, &crumb.Speed, &crumb.Accuracy, &crumb.RecordedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan breadcrumb: %w", err)
+		}
+		crumbs = append(crumbs, crumb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list breadcrumbs: %w", err)
+	}
+	return crumbs, nil
+}
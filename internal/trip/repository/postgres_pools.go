@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// The statements below mirror internal/db/queries/pools.sql and must be kept
+// in sync with it.
+const (
+	getPoolQuery = `SELECT id, driver_id, vehicle_type, waypoints, version, updated_at
+FROM trip_pools
+WHERE id = $1`
+
+	createPoolQuery = `INSERT INTO trip_pools (id, driver_id, vehicle_type, waypoints, version, updated_at)
+VALUES ($1, $2, $3, $4, 1, $5)`
+
+	updatePoolQuery = `UPDATE trip_pools
+SET driver_id = $3, vehicle_type = $4, waypoints = $5, updated_at = $6, version = version + 1
+WHERE id = $1 AND version = $2
+RETURNING version`
+)
+
+// GetPool returns the shared route id, or domain.ErrPoolNotFound.
+func (r *PostgresRepository) GetPool(ctx context.Context, id uuid.UUID) (domain.Pool, error) {
+	var (
+		pool      domain.Pool
+		waypoints []byte
+	)
+	err := r.db.QueryRowContext(ctx, getPoolQuery, id).Scan(
+		&pool.ID, &pool.DriverID, &pool.VehicleType, &waypoints, &pool.Version, &pool.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Pool{}, domain.ErrPoolNotFound
+	}
+	if err != nil {
+		return domain.Pool{}, fmt.Errorf("select pool: %w", err)
+	}
+	if err := json.Unmarshal(waypoints, &pool.Waypoints); err != nil {
+		return domain.Pool{}, fmt.Errorf("decode pool waypoints: %w", err)
+	}
+	pool.UpdatedAt = pool.UpdatedAt.UTC()
+	return pool, nil
+}
+
+// SavePool inserts or updates pool with optimistic locking on its version.
+func (r *PostgresRepository) SavePool(ctx context.Context, pool domain.Pool) (domain.Pool, error) {
+	waypoints, err := json.Marshal(pool.Waypoints)
+	if err != nil {
+		return domain.Pool{}, fmt.Errorf("marshal pool waypoints: %w", err)
+	}
+	if pool.Version == 0 {
+		if _, err := r.db.ExecContext(ctx, createPoolQuery,
+			pool.ID, pool.DriverID, pool.VehicleType, string(waypoints), pool.UpdatedAt,
+		); err != nil {
+			if isUniqueViolation(err) {
+				return domain.Pool{}, domain.ErrVersionConflict
+			}
+			return domain.Pool{}, fmt.Errorf("insert pool: %w", err)
+		}
+		pool.Version = 1
+		return pool, nil
+	}
+	var version int64
+	err = r.db.QueryRowContext(ctx, updatePoolQuery,
+		pool.ID, pool.Version, pool.DriverID, pool.VehicleType, string(waypoints), pool.UpdatedAt,
+	).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Pool{}, domain.ErrVersionConflict
+	}
+	if err != nil {
+		return domain.Pool{}, fmt.Errorf("update pool: %w", err)
+	}
+	pool.Version = version
+	return pool, nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// The statements below mirror internal/db/queries/ratings.sql and must be
+// kept in sync with it.
+const (
+	createRatingQuery = `INSERT INTO trip_ratings (trip_id, rater_id, ratee_id, ratee_role, stars, tags, comment, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (trip_id, rater_id) DO NOTHING`
+
+	upsertRatingSummaryQuery = `INSERT INTO user_ratings (user_id, role, rating_count, stars_total, rolling_average, updated_at)
+VALUES ($1, $2, 1, $3::bigint, $3::double precision, $4)
+ON CONFLICT (user_id, role) DO UPDATE SET
+    rating_count = user_ratings.rating_count + 1,
+    stars_total = user_ratings.stars_total + EXCLUDED.stars_total,
+    rolling_average = user_ratings.rolling_average
+        + (EXCLUDED.stars_total - user_ratings.rolling_average) / LEAST(user_ratings.rating_count + 1, $5::bigint),
+    updated_at = EXCLUDED.updated_at`
+
+	listTripRatingsQuery = `SELECT trip_id, rater_id, ratee_id, ratee_role, stars, tags, comment, created_at
+FROM trip_ratings
+WHERE trip_id = $1
+ORDER BY created_at, rater_id`
+
+	getRatingSummariesQuery = `SELECT user_id, role, rating_count, stars_total, rolling_average, updated_at
+FROM user_ratings
+WHERE user_id = $1
+ORDER BY role`
+)
+
+// CreateRating inserts rating and folds it into the ratee's summary in SQL,
+// so concurrent ratings of one user do not lose updates. Call it inside a
+// unit of work to keep both writes atomic.
+func (r *PostgresRepository) CreateRating(ctx context.Context, rating domain.Rating, span int) error {
+	if span <= 0 {
+		span = domain.DefaultRatingSpan
+	}
+	tags, err := json.Marshal(rating.Tags)
+	if err != nil {
+		return fmt.Errorf("marshal rating tags: %w", err)
+	}
+	res, err := r.db.ExecContext(ctx, createRatingQuery,
+		rating.TripID, rating.RaterID, rating.RateeID, string(rating.RateeRole),
+		rating.Stars, string(tags), rating.Comment, rating.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert rating: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("insert rating: %w", err)
+	} else if n == 0 {
+		return domain.ErrAlreadyRated
+	}
+	if _, err := r.db.ExecContext(ctx, upsertRatingSummaryQuery,
+		rating.RateeID, string(rating.RateeRole), rating.Stars, rating.CreatedAt, span,
+	); err != nil {
+		return fmt.Errorf("update rating summary: %w", err)
+	}
+	return nil
+}
+
+// ListTripRatings returns the ratings given for tripID.
+func (r *PostgresRepository) ListTripRatings(ctx context.Context, tripID uuid.UUID) ([]domain.Rating, error) {
+	rows, err := r.db.QueryContext(ctx, listTripRatingsQuery, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("list trip ratings: %w", err)
+	}
+	defer rows.Close()
+	var ratings []domain.Rating
+	for rows.Next() {
+		var (
+			rating domain.Rating
+			role   string
+			tags   []byte
+		)
+		if err := rows.Scan(&rating.TripID, &rating.RaterID, &rating.RateeID, &role,
+			&rating.Stars, &tags, &rating.Comment, &rating.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan rating: %w", err)
+		}
+		rating.RateeRole = domain.Party(role)
+		rating.CreatedAt = rating.CreatedAt.UTC()
+		if err := json.Unmarshal(tags, &rating.Tags); err != nil {
+			return nil, fmt.Errorf("decode rating tags: %w", err)
+		}
+		ratings = append(ratings, rating)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate ratings: %w", err)
+	}
+	return ratings, nil
+}
+
+// GetRatingSummaries returns userID's summaries ordered by role.
+func (r *PostgresRepository) GetRatingSummaries(ctx context.Context, userID uuid.UUID) ([]domain.RatingSummary, error) {
+	rows, err := r.db.QueryContext(ctx, getRatingSummariesQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get rating summaries: %w", err)
+	}
+	defer rows.Close()
+	var summaries []domain.RatingSummary
+	for rows.Next() {
+		var (
+			summary domain.RatingSummary
+			role    string
+		)
+		if err := rows.Scan(&summary.UserID, &role, &summary.Count, &summary.StarsTotal,
+			&summary.RollingAverage, &summary.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan rating summary: %w", err)
+		}
+		summary.Role = domain.Party(role)
+		summary.UpdatedAt = summary.UpdatedAt.UTC()
+		if summary.Count > 0 {
+			summary.Average = float64(summary.StarsTotal) / float64(summary.Count)
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rating summaries: %w", err)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,70 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/repository"
+)
+
+func TestPostgresRepositoryFoldsRatingsIntoSummaries(t *testing.T) {
+	ctx := context.Background()
+	db := startPostgres(t, ctx)
+	repo := repository.NewPostgresRepository(db)
+	driverID := insertUser(t, ctx, db, "driver")
+	at := time.Unix(1_700_000_000, 0).UTC()
+
+	rate := func(stars int) uuid.UUID {
+		riderID := insertUser(t, ctx, db, "rider")
+		trip, err := repo.CreateTrip(ctx, domain.Trip{
+			ID:          uuid.New(),
+			RiderID:     riderID,
+			DriverID:    &driverID,
+			VehicleType: "economy",
+			Status:      domain.StatusCompleted,
+			RequestedAt: at,
+		})
+		require.NoError(t, err)
+		require.NoError(t, repo.CreateRating(ctx, domain.Rating{
+			TripID:    trip.ID,
+			RaterID:   riderID,
+			RateeID:   driverID,
+			RateeRole: domain.PartyDriver,
+			Stars:     stars,
+			Tags:      []string{"friendly"},
+			CreatedAt: at,
+		}, 2))
+		return trip.ID
+	}
+
+	first := rate(5)
+	rate(3)
+	rate(1)
+
+	ratings, err := repo.ListTripRatings(ctx, first)
+	require.NoError(t, err)
+	require.Len(t, ratings, 1)
+	require.Equal(t, 5, ratings[0].Stars)
+	require.Equal(t, []string{"friendly"}, ratings[0].Tags)
+
+	err = repo.CreateRating(ctx, ratings[0], 2)
+	require.ErrorIs(t, err, domain.ErrAlreadyRated)
+
+	want := domain.RatingSummary{UserID: driverID, Role: domain.PartyDriver}
+	for _, stars := range []int{5, 3, 1} {
+		want = want.Add(stars, 2, at)
+	}
+	summaries, err := repo.GetRatingSummaries(ctx, driverID)
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	require.Equal(t, want.Count, summaries[0].Count)
+	require.Equal(t, want.StarsTotal, summaries[0].StarsTotal)
+	require.InDelta(t, want.Average, summaries[0].Average, 1e-9)
+	require.InDelta(t, want.RollingAverage, summaries[0].RollingAverage, 1e-9)
+	require.True(t, at.Equal(summaries[0].UpdatedAt))
+}
@@ -0,0 +1,59 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	postgrescontainer "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// startPostgres runs a PostGIS database with every migration applied.
+func startPostgres(t *testing.T, ctx context.Context) *sql.DB {
+	pg, err := postgrescontainer.Run(ctx, "postgis/postgis:16-3.4",
+		postgrescontainer.WithDatabase("ridellite"), postgrescontainer.WithUsername("postgres"), postgrescontainer.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").WithOccurrence(2)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pg.Terminate(ctx))
+	})
+	dsn, err := pg.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	require.NoError(t, db.PingContext(ctx))
+	t.Cleanup(func() { _ = db.Close() })
+	migrate(t, ctx, db)
+	return db
+}
+
+// migrate applies the up section of every migration in order.
+func migrate(t *testing.T, ctx context.Context, db *sql.DB) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "migrations", "*.sql"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		require.NoError(t, err)
+		up, _, _ := strings.Cut(string(body), "-- +migrate Down")
+		_, err = db.ExecContext(ctx, up)
+		require.NoError(t, err, file)
+	}
+}
+
+// insertUser adds a users row for trips to reference.
+func insertUser(t *testing.T, ctx context.Context, db *sql.DB, role string) uuid.UUID {
+	id := uuid.New()
+	_, err := db.ExecContext(ctx, `INSERT INTO users (id, role) VALUES ($1, $2)`, id, role)
+	require.NoError(t, err)
+	return id
+}
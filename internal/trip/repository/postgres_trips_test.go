@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/repository"
+)
+
+func TestPostgresRepositoryListsUnmatchedTripsByMatchingStart(t *testing.T) {
+	ctx := context.Background()
+	db := startPostgres(t, ctx)
+	repo := repository.NewPostgresRepository(db)
+	now := time.Unix(1_700_000_000, 0).UTC()
+	lead := 15 * time.Minute
+
+	create := func(requestedAt time.Time, pickupAt *time.Time) uuid.UUID {
+		trip, err := repo.CreateTrip(ctx, domain.Trip{
+			ID:          uuid.New(),
+			RiderID:     insertUser(t, ctx, db, "rider"),
+			VehicleType: "economy",
+			Status:      domain.StatusRequested,
+			RequestedAt: requestedAt,
+			PickupAt:    pickupAt,
+		})
+		require.NoError(t, err)
+		return trip.ID
+	}
+	later := now.Add(time.Hour)
+	released := now.Add(10 * time.Minute)
+	create(now.Add(-12*time.Hour), &later)                  // matching starts in 45 minutes
+	releasedID := create(now.Add(-12*time.Hour), &released) // matching started 5 minutes ago
+	onDemandID := create(now.Add(-10*time.Minute), nil)
+
+	trips, err := repo.ListUnmatchedTrips(ctx, now, lead, 10)
+	require.NoError(t, err)
+	require.Len(t, trips, 2)
+	require.Equal(t, onDemandID, trips[0].ID)
+	require.Equal(t, releasedID, trips[1].ID)
+
+	trips, err = repo.ListUnmatchedTrips(ctx, now, lead, 1)
+	require.NoError(t, err)
+	require.Len(t, trips, 1)
+	require.Equal(t, onDemandID, trips[0].ID, "rides booked long ago do not crowd out the batch")
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	outboxpkg "github.com/example/ridellite/pkg/outbox"
+)
+
+const insertOutboxQuery = `INSERT INTO outbox (topic, payload, headers) VALUES ($1, $2, $3)`
+
+// PostgresUnitOfWork runs trip writes and outbox inserts in one database
+// transaction. The outbox worker later relays the rows to NATS.
+type PostgresUnitOfWork struct {
+	db    *sql.DB
+	topic string
+}
+
+// NewPostgresUnitOfWork constructs a unit of work publishing to topic.
+func NewPostgresUnitOfWork(db *sql.DB, topic string) *PostgresUnitOfWork {
+	return &PostgresUnitOfWork{db: db, topic: topic}
+}
+
+// Do implements domain.UnitOfWork.
+func (u *PostgresUnitOfWork) Do(ctx context.Context, fn func(tx domain.Tx) error) error {
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	scope := postgresTx{
+		trips:  &PostgresRepository{db: tx},
+		outbox: &postgresOutbox{db: tx, topic: u.topic},
+	}
+	if err := fn(scope); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+type postgresTx struct {
+	trips  *PostgresRepository
+	outbox *postgresOutbox
+}
+
+func (t postgresTx) Trips() domain.Repository                     { return t.trips }
+func (t postgresTx) Ratings() domain.RatingRepository             { return t.trips }
+func (t postgresTx) Adjustments() domain.FareAdjustmentRepository { return t.trips }
+func (t postgresTx) Pools() domain.PoolRepository                 { return t.trips }
+func (t postgresTx) Outbox() domain.EventPublisher                { return t.outbox }
+
+// postgresOutbox enqueues events into the outbox table of the surrounding
+// transaction.
+type postgresOutbox struct {
+	db    dbtx
+	topic string
+}
+
+func (o *postgresOutbox) Publish(ctx context.Context, event domain.TripEvent) error {
+	payload, header, err := outboxpkg.Envelope(ctx, event)
+	if err != nil {
+		return err
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("marshal outbox headers: %w", err)
+	}
+	if _, err := o.db.ExecContext(ctx, insertOutboxQuery, o.topic, string(payload), string(headers)); err != nil {
+		return fmt.Errorf("insert outbox: %w", err)
+	}
+	return nil
+}
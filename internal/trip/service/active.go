@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// checkRiderIdle rejects a new trip while the rider already has an active
+// one. The repository enforces the same rule atomically; this check only
+// saves a write in the common case.
+func (s *Service) checkRiderIdle(ctx context.Context, riderID uuid.UUID) error {
+	active, err := s.activeTrip(ctx, domain.TripFilter{RiderID: &riderID})
+	if err != nil {
+		return err
+	}
+	if active != nil {
+		return &domain.ActiveTripError{Party: domain.PartyRider, TripID: active.ID}
+	}
+	return nil
+}
+
+// activeTrip returns the active trip matching filter, or nil when there is none.
+func (s *Service) activeTrip(ctx context.Context, filter domain.TripFilter) (*domain.Trip, error) {
+	filter.Statuses = domain.ActiveStatuses()
+	trips, err := s.repo.SearchTrips(ctx, filter, nil, 1)
+	if err != nil {
+		return nil, fmt.Errorf("find active trip: %w", err)
+	}
+	if len(trips) == 0 {
+		return nil, nil
+	}
+	return &trips[0], nil
+}
+
+// resolveActiveTrip fills in the conflicting trip of an *ActiveTripError
+// raised by a storage constraint, which only knows the party.
+func (s *Service) resolveActiveTrip(ctx context.Context, err error, trip domain.Trip) error {
+	var conflict *domain.ActiveTripError
+	if !errors.As(err, &conflict) || conflict.TripID != uuid.Nil {
+		return err
+	}
+	var filter domain.TripFilter
+	switch conflict.Party {
+	case domain.PartyRider:
+		filter.RiderID = &trip.RiderID
+	case domain.PartyDriver:
+		if trip.DriverID == nil {
+			return err
+		}
+		filter.DriverID = trip.DriverID
+	}
+	active, lookupErr := s.activeTrip(ctx, filter)
+	if lookupErr != nil || active == nil {
+		return err
+	}
+	return &domain.ActiveTripError{Party: conflict.Party, TripID: active.ID}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// AdjustFareRequest describes a tip from the rider or a refund or correction
+// from a support agent. AmountCents is signed: refunds are negative. The
+// actor is the caller named by the claims in the context.
+type AdjustFareRequest struct {
+	Kind        domain.AdjustmentKind
+	AmountCents int64
+	Reason      string
+}
+
+// FareStatement is a completed trip's fare with its adjustments.
+type FareStatement struct {
+	TripID      uuid.UUID               `json:"trip_id"`
+	FareCents   int64                   `json:"fare_cents"`
+	Adjustments []domain.FareAdjustment `json:"adjustments"`
+	// TotalCents is derived from the fare and the adjustment records.
+	TotalCents int64 `json:"total_cents"`
+}
+
+// AdjustFare records an adjustment of a completed trip's fare. Tips must come
+// from the trip's rider within Config.TipWindow of completion; refunds and
+// corrections must come from an admin, need a reason and never take the
+// total below zero. The adjustment record, the trip's running total and the
+// FareAdjusted event are written in one unit of work, so concurrent
+// adjustments of one trip fail with domain.ErrVersionConflict instead of
+// overdrawing it.
+func (s *Service) AdjustFare(ctx context.Context, tripID uuid.UUID, req AdjustFareRequest) (domain.FareAdjustment, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return domain.FareAdjustment{}, err
+	}
+	actorID, err := s.authorizeAdjustment(ctx, trip, req.Kind)
+	if err != nil {
+		return domain.FareAdjustment{}, err
+	}
+	now := s.clock.Now()
+	adjustment := domain.FareAdjustment{
+		ID:          uuid.New(),
+		TripID:      trip.ID,
+		Kind:        req.Kind,
+		AmountCents: req.AmountCents,
+		Reason:      req.Reason,
+		ActorID:     actorID,
+		CreatedAt:   now,
+	}
+	if err := adjustment.Validate(); err != nil {
+		return domain.FareAdjustment{}, err
+	}
+	if adjustment.Kind == domain.AdjustmentTip && trip.FinishedAt != nil && now.After(trip.FinishedAt.Add(*s.config.TipWindow)) {
+		return domain.FareAdjustment{}, domain.ErrTipWindowClosed
+	}
+	if err := trip.ApplyAdjustment(adjustment); err != nil {
+		return domain.FareAdjustment{}, err
+	}
+	event := domain.TripEvent{
+		Type: domain.EventFareAdjusted,
+		Payload: domain.FareAdjustedPayload{
+			AdjustmentID: adjustment.ID,
+			Kind:         adjustment.Kind,
+			AmountCents:  adjustment.AmountCents,
+			Reason:       adjustment.Reason,
+			ActorID:      adjustment.ActorID,
+			TotalCents:   trip.TotalCents(),
+		},
+		CreatedAt: now,
+	}
+	_, err = s.commit(ctx, func(tx domain.Tx) (domain.Trip, error) {
+		if err := tx.Adjustments().CreateFareAdjustment(ctx, adjustment); err != nil {
+			return domain.Trip{}, err
+		}
+		return tx.Trips().UpdateTrip(ctx, trip)
+	}, []domain.TripEvent{event})
+	if err != nil {
+		return domain.FareAdjustment{}, err
+	}
+	return adjustment, nil
+}
+
+// FareStatement returns a trip's fare, its adjustments and the resulting total.
+func (s *Service) FareStatement(ctx context.Context, tripID uuid.UUID) (FareStatement, error) {
+	if s.adjusting == nil {
+		return FareStatement{}, domain.ErrAdjustmentsUnavailable
+	}
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return FareStatement{}, err
+	}
+	adjustments, err := s.adjusting.ListFareAdjustments(ctx, tripID)
+	if err != nil {
+		return FareStatement{}, fmt.Errorf("list fare adjustments of trip %s: %w", tripID, err)
+	}
+	if adjustments == nil {
+		adjustments = []domain.FareAdjustment{}
+	}
+	return FareStatement{
+		TripID:      trip.ID,
+		FareCents:   trip.PriceCents,
+		Adjustments: adjustments,
+		TotalCents:  domain.FareTotal(trip.PriceCents, adjustments),
+	}, nil
+}
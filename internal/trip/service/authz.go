@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/auth"
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// AuditDecision tells why an authorization decision was audited.
+type AuditDecision string
+
+const (
+	// AuditDenied records a caller turned away from a trip.
+	AuditDenied AuditDecision = "denied"
+	// AuditOverride records an admin acting on a trip they are not part of.
+	AuditOverride AuditDecision = "override"
+)
+
+// AuditEntry describes an audited authorization decision.
+type AuditEntry struct {
+	At       time.Time
+	Decision AuditDecision
+	TripID   uuid.UUID
+	Command  domain.Command
+	// UserID and Role identify the caller; both are empty when the call
+	// carried no claims.
+	UserID string
+	Role   string
+	// Reason explains a denial.
+	Reason string
+}
+
+// AuditLog records authorization denials and admin overrides.
+type AuditLog interface {
+	Record(ctx context.Context, entry AuditEntry)
+}
+
+// AuditLogFunc adapts a function to AuditLog.
+type AuditLogFunc func(ctx context.Context, entry AuditEntry)
+
+// Record implements AuditLog.
+func (f AuditLogFunc) Record(ctx context.Context, entry AuditEntry) { f(ctx, entry) }
+
+// WithAuditLog records authorization decisions to log. Without this option
+// they are not recorded.
+func WithAuditLog(log AuditLog) Option {
+	return func(s *Service) { s.audit = log }
+}
+
+// Trip requests, quotes, searches, ratings, routes and fare adjustments are
+// audited under these commands; they do not pass through the state machine.
+const (
+	CommandRequest     domain.Command = "request"
+	CommandQuote       domain.Command = "quote"
+	CommandSearch      domain.Command = "search"
+	CommandRate        domain.Command = "rate"
+	CommandViewRatings domain.Command = "view_ratings"
+	CommandViewRoute   domain.Command = "view_route"
+	CommandAdjustFare  domain.Command = "adjust_fare"
+)
+
+// principal is the authenticated caller of a trip operation.
+type principal struct {
+	subject string
+	id      uuid.UUID
+	role    string
+}
+
+func (p principal) admin() bool { return p.role == auth.RoleAdmin }
+
+// driverOf reports whether p is the driver assigned to trip.
+func (p principal) driverOf(trip domain.Trip) bool {
+	return trip.DriverID != nil && *trip.DriverID == p.id
+}
+
+// riderOf reports whether p is the rider of trip.
+func (p principal) riderOf(trip domain.Trip) bool {
+	return trip.RiderID == p.id
+}
+
+// authorizeDriver checks that the caller is the driver assigned to trip or
+// an admin.
+func (s *Service) authorizeDriver(ctx context.Context, trip domain.Trip, cmd domain.Command) error {
+	p, err := s.principal(ctx, trip, cmd)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.driverOf(trip):
+		return nil
+	case p.admin():
+		s.audited(ctx, AuditOverride, trip, cmd, p, nil)
+		return nil
+	}
+	s.audited(ctx, AuditDenied, trip, cmd, p, domain.ErrDriverNotAssigned)
+	return domain.ErrDriverNotAssigned
+}
+
+// authorizeParty checks that the caller is the rider or the driver of trip,
+// or an admin.
+func (s *Service) authorizeParty(ctx context.Context, trip domain.Trip, cmd domain.Command) error {
+	p, err := s.principal(ctx, trip, cmd)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.riderOf(trip), p.driverOf(trip):
+		return nil
+	case p.admin():
+		s.audited(ctx, AuditOverride, trip, cmd, p, nil)
+		return nil
+	}
+	s.audited(ctx, AuditDenied, trip, cmd, p, domain.ErrNotTripParty)
+	return domain.ErrNotTripParty
+}
+
+// authorizeUser checks that the caller is userID or an admin.
+func (s *Service) authorizeUser(ctx context.Context, userID uuid.UUID, cmd domain.Command) error {
+	p, err := s.principal(ctx, domain.Trip{}, cmd)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.id == userID:
+		return nil
+	case p.admin():
+		s.audited(ctx, AuditOverride, domain.Trip{}, cmd, p, nil)
+		return nil
+	}
+	s.audited(ctx, AuditDenied, domain.Trip{}, cmd, p, domain.ErrNotTripParty)
+	return domain.ErrNotTripParty
+}
+
+// requestingRider returns the caller's user id; trips and quotes are always
+// for the caller.
+func (s *Service) requestingRider(ctx context.Context, cmd domain.Command) (uuid.UUID, error) {
+	p, err := s.principal(ctx, domain.Trip{}, cmd)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if p.id == uuid.Nil {
+		err = fmt.Errorf("%w: subject %q is not a user id", domain.ErrUnauthenticated, p.subject)
+		s.audited(ctx, AuditDenied, domain.Trip{}, cmd, p, err)
+		return uuid.Nil, err
+	}
+	return p.id, nil
+}
+
+// scopeSearch narrows filter to the caller's own trips: those they rode for
+// riders and those they drove for drivers. Admins search all trips.
+func (s *Service) scopeSearch(ctx context.Context, filter *domain.TripFilter) error {
+	p, err := s.principal(ctx, domain.Trip{}, CommandSearch)
+	if err != nil {
+		return err
+	}
+	if p.admin() {
+		return nil
+	}
+	party := &filter.RiderID
+	if p.role == auth.RoleDriver {
+		party = &filter.DriverID
+	}
+	if *party != nil && **party != p.id {
+		s.audited(ctx, AuditDenied, domain.Trip{}, CommandSearch, p, domain.ErrNotTripParty)
+		return domain.ErrNotTripParty
+	}
+	*party = &p.id
+	return nil
+}
+
+// ratingParties checks that the caller is the rider or the driver of trip
+// and returns a rating of trip from the caller to the other party.
+func (s *Service) ratingParties(ctx context.Context, trip domain.Trip) (domain.Rating, error) {
+	p, err := s.principal(ctx, trip, CommandRate)
+	if err != nil {
+		return domain.Rating{}, err
+	}
+	rating := domain.Rating{TripID: trip.ID, RaterID: p.id}
+	switch {
+	case p.riderOf(trip) && trip.DriverID != nil:
+		rating.RateeID, rating.RateeRole = *trip.DriverID, domain.PartyDriver
+		return rating, nil
+	case p.driverOf(trip):
+		rating.RateeID, rating.RateeRole = trip.RiderID, domain.PartyRider
+		return rating, nil
+	}
+	s.audited(ctx, AuditDenied, trip, CommandRate, p, domain.ErrNotTripParty)
+	return domain.Rating{}, domain.ErrNotTripParty
+}
+
+// authorizeAdjustment checks that the caller may make an adjustment of kind
+// to trip and returns the caller's user id: tips come from the trip's rider,
+// refunds and corrections from an admin.
+func (s *Service) authorizeAdjustment(ctx context.Context, trip domain.Trip, kind domain.AdjustmentKind) (uuid.UUID, error) {
+	p, err := s.principal(ctx, trip, CommandAdjustFare)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	switch {
+	case kind == domain.AdjustmentTip && !p.riderOf(trip):
+		err = domain.ErrNotTripParty
+	case kind != domain.AdjustmentTip && !p.admin():
+		err = domain.ErrSupportOnly
+	case p.id == uuid.Nil:
+		// Adjustments record their actor, so admins need a user id too.
+		err = fmt.Errorf("%w: subject %q is not a user id", domain.ErrUnauthenticated, p.subject)
+	}
+	if err != nil {
+		s.audited(ctx, AuditDenied, trip, CommandAdjustFare, p, err)
+		return uuid.Nil, err
+	}
+	return p.id, nil
+}
+
+// cancellingParty resolves whom the caller cancels trip for: its rider or
+// assigned driver cancels for themselves, and an admin for the party whose
+// reason is given, the rider by default.
+func (s *Service) cancellingParty(ctx context.Context, trip domain.Trip, reason domain.CancellationReason) (domain.TripStatus, error) {
+	// Denials are audited with the command matching the caller's role.
+	cmd := domain.CommandCancelByRider
+	if claims, ok := auth.ClaimsFromContext(ctx); ok && claims != nil && claims.Role == auth.RoleDriver {
+		cmd = domain.CommandCancelByDriver
+	}
+	p, err := s.principal(ctx, trip, cmd)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case p.riderOf(trip):
+		return domain.StatusCancelledRider, nil
+	case p.driverOf(trip):
+		return domain.StatusCancelledDriver, nil
+	case p.admin():
+		actor := domain.StatusCancelledRider
+		if slices.Contains(domain.CancellationReasons(domain.StatusCancelledDriver), reason) {
+			actor = domain.StatusCancelledDriver
+		}
+		s.audited(ctx, AuditOverride, trip, cancelCommand(actor), p, nil)
+		return actor, nil
+	}
+	s.audited(ctx, AuditDenied, trip, cmd, p, domain.ErrNotTripParty)
+	return "", domain.ErrNotTripParty
+}
+
+// cancelCommand is the command cancelling as actor.
+func cancelCommand(actor domain.TripStatus) domain.Command {
+	if actor == domain.StatusCancelledDriver {
+		return domain.CommandCancelByDriver
+	}
+	return domain.CommandCancelByRider
+}
+
+// principal reads the caller from the claims in ctx. Subjects that are not
+// user identifiers only pass for admins.
+func (s *Service) principal(ctx context.Context, trip domain.Trip, cmd domain.Command) (principal, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok || claims == nil {
+		s.audited(ctx, AuditDenied, trip, cmd, principal{}, domain.ErrUnauthenticated)
+		return principal{}, domain.ErrUnauthenticated
+	}
+	p := principal{subject: claims.Subject, role: claims.Role}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil && !p.admin() {
+		err = fmt.Errorf("%w: subject %q is not a user id", domain.ErrUnauthenticated, claims.Subject)
+		s.audited(ctx, AuditDenied, trip, cmd, p, err)
+		return principal{}, err
+	}
+	p.id = id
+	return p, nil
+}
+
+// audited adds an entry to the audit log, if any.
+func (s *Service) audited(ctx context.Context, decision AuditDecision, trip domain.Trip, cmd domain.Command, p principal, reason error) {
+	if s.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		At:       s.clock.Now(),
+		Decision: decision,
+		TripID:   trip.ID,
+		Command:  cmd,
+		UserID:   p.subject,
+		Role:     p.role,
+	}
+	if reason != nil {
+		entry.Reason = reason.Error()
+	}
+	s.audit.Record(ctx, entry)
+}
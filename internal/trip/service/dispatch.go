@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+const (
+	// expiryBatchSize bounds how many trips one ExpireAssignments or
+	// ExpireUnmatchedTrips pass inspects.
+	expiryBatchSize = 100
+	// maxBusyDriverRetries bounds how often assignDriver rematches after
+	// picking a driver who turned out to be on another trip.
+	maxBusyDriverRetries = 3
+)
+
+var (
+	// ErrDispatchQueueClosed is returned when dispatching after the queue
+	// stopped.
+	ErrDispatchQueueClosed = errors.New("dispatch queue closed")
+	// ErrDispatchQueueFull is returned when the queue has no room left.
+	ErrDispatchQueueFull = errors.New("dispatch queue full")
+)
+
+// Dispatcher hands REQUESTED trips to the matching pipeline.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, tripID uuid.UUID) error
+}
+
+// QueueDispatcher is an in-process Dispatcher backed by a bounded channel.
+// Run drains it with a fixed pool of workers.
+type QueueDispatcher struct {
+	queue chan uuid.UUID
+	done  chan struct{}
+}
+
+// NewQueueDispatcher constructs a dispatcher buffering up to size trips.
+func NewQueueDispatcher(size int) *QueueDispatcher {
+	if size <= 0 {
+		size = 1024
+	}
+	return &QueueDispatcher{queue: make(chan uuid.UUID, size), done: make(chan struct{})}
+}
+
+// Dispatch enqueues tripID without blocking the caller; a full queue fails
+// with ErrDispatchQueueFull and leaves the trip to RedispatchPendingTrips.
+func (d *QueueDispatcher) Dispatch(_ context.Context, tripID uuid.UUID) error {
+	select {
+	case <-d.done:
+		return ErrDispatchQueueClosed
+	default:
+	}
+	select {
+	case d.queue <- tripID:
+		return nil
+	default:
+		return ErrDispatchQueueFull
+	}
+}
+
+// Run processes queued trips with workers goroutines calling match until ctx
+// is cancelled. Failures are reported to onError.
+func (d *QueueDispatcher) Run(ctx context.Context, workers int, match func(context.Context, uuid.UUID) error, onError func(error)) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	defer close(d.done)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case tripID := <-d.queue:
+					if err := match(ctx, tripID); err != nil && onError != nil {
+						onError(fmt.Errorf("match trip %s: %w", tripID, err))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// MatchTrip runs matching for a REQUESTED trip. Trips that already left
+// REQUESTED, for example because the rider cancelled, are skipped, as are
+// trips changed while matching ran; a trip can be dispatched more than once.
+func (s *Service) MatchTrip(ctx context.Context, tripID uuid.UUID) error {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return err
+	}
+	if trip.Status != domain.StatusRequested || trip.DriverID != nil {
+		return nil
+	}
+	_, err = s.assignDriver(ctx, trip)
+	if errors.Is(err, domain.ErrVersionConflict) {
+		return nil
+	}
+	return err
+}
+
+// RedispatchPendingTrips dispatches REQUESTED trips that have no driver
+// again, picking up trips whose dispatch failed and retrying those nobody
+// was found for. It reports how many trips were dispatched. A trip that
+// fails does not hold up the others; the failures are returned joined.
+func (s *Service) RedispatchPendingTrips(ctx context.Context) (int, error) {
+	trips, err := s.repo.ListUnmatchedTrips(ctx, s.clock.Now(), s.config.ScheduleLeadTime, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list requested trips: %w", err)
+	}
+	dispatched := 0
+	var errs []error
+	for _, trip := range trips {
+		if trip.DriverID != nil {
+			continue
+		}
+		if err := s.dispatch(ctx, trip.ID); err != nil {
+			errs = append(errs, fmt.Errorf("dispatch trip %s: %w", trip.ID, err))
+			continue
+		}
+		dispatched++
+	}
+	return dispatched, errors.Join(errs...)
+}
+
+// dispatch schedules matching for tripID, running it inline when no
+// dispatcher is configured.
+func (s *Service) dispatch(ctx context.Context, tripID uuid.UUID) error {
+	if s.dispatcher == nil {
+		return s.MatchTrip(ctx, tripID)
+	}
+	return s.dispatcher.Dispatch(ctx, tripID)
+}
+
+// DeclineTrip lets the assigned driver, or an admin on their behalf, turn the
+// trip down. The caller is taken from the claims in ctx. The driver's
+// reservation is released and the trip is dispatched again, skipping everyone
+// who already declined. A failed dispatch does not undo the decline; the trip
+// waits for RedispatchPendingTrips.
+func (s *Service) DeclineTrip(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	var offered domain.Trip
+	declined, err := s.fireAsDriver(ctx, tripID, domain.CommandDecline, func(trip *domain.Trip, _ time.Time) (domain.EventPayload, error) {
+		offered = *trip
+		driverID := *trip.DriverID
+		withdrawOffer(trip, driverID)
+		return domain.DriverDeclinedPayload{DriverID: driverID}, nil
+	})
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	s.releaseSeats(ctx, *offered.DriverID, offered)
+	if err := s.dispatch(ctx, declined.ID); err != nil {
+		deferredDispatches.Inc()
+	}
+	return declined, nil
+}
+
+// ExpireAssignments returns assigned trips whose acceptance deadline has
+// passed to REQUESTED and dispatches them again. It reports how many
+// assignments expired. A trip that fails does not hold up the others; the
+// failures are returned joined.
+func (s *Service) ExpireAssignments(ctx context.Context) (int, error) {
+	trips, err := s.repo.ListTripsByStatus(ctx, domain.StatusDriverAssigned, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list assigned trips: %w", err)
+	}
+	now := s.clock.Now()
+	expired := 0
+	var errs []error
+	for _, trip := range trips {
+		if trip.DriverID == nil || trip.AcceptDeadline == nil || now.Before(*trip.AcceptDeadline) {
+			continue
+		}
+		driverID := *trip.DriverID
+		updated, err := s.transition(ctx, trip, domain.CommandExpire, domain.Input{}, func(trip *domain.Trip, _ time.Time) (domain.EventPayload, error) {
+			withdrawOffer(trip, driverID)
+			return domain.AssignmentExpiredPayload{DriverID: driverID}, nil
+		})
+		if errors.Is(err, domain.ErrVersionConflict) {
+			// The driver answered while we were sweeping.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire trip %s: %w", trip.ID, err))
+			continue
+		}
+		expired++
+		s.releaseSeats(ctx, driverID, trip)
+		if err := s.dispatch(ctx, updated.ID); err != nil {
+			errs = append(errs, fmt.Errorf("dispatch trip %s: %w", updated.ID, err))
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// ExpireUnmatchedTrips ends REQUESTED trips that found no driver within
+// Config.MatchTimeout as NO_DRIVER_FOUND, so riders stop waiting. It reports
+// how many trips expired. A trip that fails does not hold up the others; the
+// failures are returned joined.
+func (s *Service) ExpireUnmatchedTrips(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	trips, err := s.repo.ListUnmatchedTrips(ctx, now.Add(-s.config.MatchTimeout), s.config.ScheduleLeadTime, expiryBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list requested trips: %w", err)
+	}
+	expired := 0
+	var errs []error
+	for _, trip := range trips {
+		startedAt := trip.MatchingStartedAt(s.config.ScheduleLeadTime)
+		_, err := s.transition(ctx, trip, domain.CommandExpireRequest, domain.Input{}, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+			return domain.TripExpiredPayload{
+				WaitedSeconds: int64(now.Sub(startedAt) / time.Second),
+				DeclinedCount: len(trip.DeclinedDrivers),
+			}, nil
+		})
+		if errors.Is(err, domain.ErrVersionConflict) {
+			// A driver was assigned while we were sweeping.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire trip %s: %w", trip.ID, err))
+			continue
+		}
+		expired++
+		unmatchedTrips.WithLabelValues(tripArea(trip), trip.VehicleType).Inc()
+	}
+	return expired, errors.Join(errs...)
+}
+
+// assignDriver reserves a driver for a REQUESTED trip and starts the
+// acceptance countdown. Trips of shared products first try to join a driver
+// already on a pooled ride. When nobody can be reserved the trip stays
+// REQUESTED and a NoDriverFound event is recorded, once per number of
+// declined drivers so that retries do not flood its timeline. A driver found
+// to be on another active trip while assigning is skipped and matching runs
+// again.
+func (s *Service) assignDriver(ctx context.Context, trip domain.Trip) (domain.Trip, error) {
+	if s.matcher == nil {
+		return trip, nil
+	}
+	if pooled, ok, err := s.assignToPool(ctx, trip); err != nil || ok {
+		return pooled, err
+	}
+	// candidate only widens the matcher's skip list; busy drivers are not
+	// recorded as having declined.
+	candidate := trip
+	for attempt := 0; ; attempt++ {
+		driverID, err := s.matcher.ReserveDriver(ctx, candidate)
+		if err != nil && !errors.Is(err, domain.ErrNoDriverAvailable) {
+			return trip, fmt.Errorf("reserve driver: %w", err)
+		}
+		if driverID == nil {
+			return trip, s.noDriverFound(ctx, trip)
+		}
+		assigned, err := s.transition(ctx, trip, domain.CommandAssignDriver, domain.Input{DriverID: driverID}, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+			deadline := now.Add(s.config.AcceptTimeout)
+			trip.DriverID = driverID
+			trip.AcceptDeadline = &deadline
+			return domain.DriverAssignedPayload{DriverID: *driverID, AcceptDeadline: deadline}, nil
+		})
+		if err == nil {
+			return assigned, nil
+		}
+		s.releaseDriver(ctx, *driverID)
+		var busy *domain.ActiveTripError
+		if errors.As(err, &busy) && busy.Party == domain.PartyDriver && attempt < maxBusyDriverRetries {
+			candidate.DeclinedDrivers = append(slices.Clone(candidate.DeclinedDrivers), *driverID)
+			continue
+		}
+		return trip, fmt.Errorf("assign driver: %w", err)
+	}
+}
+
+// noDriverFound records a NoDriverFound event for trip unless the last one
+// recorded saw as many declined drivers.
+func (s *Service) noDriverFound(ctx context.Context, trip domain.Trip) error {
+	events, err := s.repo.ListTripEvents(ctx, trip.ID)
+	if err != nil {
+		return fmt.Errorf("list trip events: %w", err)
+	}
+	declined := len(trip.DeclinedDrivers)
+	for i := len(events) - 1; i >= 0; i-- {
+		if last, ok := events[i].Payload.(domain.NoDriverFoundPayload); ok {
+			if last.DeclinedCount == declined {
+				return nil
+			}
+			break
+		}
+	}
+	return s.record(ctx, trip, domain.TripEvent{
+		Type:    domain.EventNoDriverFound,
+		Payload: domain.NoDriverFoundPayload{DeclinedCount: declined},
+	})
+}
+
+// releaseDriver frees the driver's reservation. Failures are tolerated since
+// reservations also expire on their own TTL.
+func (s *Service) releaseDriver(ctx context.Context, driverID uuid.UUID) {
+	if s.matcher != nil {
+		_ = s.matcher.ReleaseDriver(ctx, driverID)
+	}
+}
+
+// withdrawOffer clears the current assignment, including a pool the trip
+// was about to join, and remembers the driver so the trip is not offered to
+// them again.
+func withdrawOffer(trip *domain.Trip, driverID uuid.UUID) {
+	trip.DriverID = nil
+	trip.AcceptDeadline = nil
+	trip.PoolID = nil
+	trip.DeclinedDrivers = append(append([]uuid.UUID(nil), trip.DeclinedDrivers...), driverID)
+}
+
+// RunPeriodically invokes pass every interval until ctx is cancelled. A failed
+// pass is reported to onError and retried on the next tick. A non-positive
+// interval is rejected.
+func RunPeriodically(ctx context.Context, interval time.Duration, pass func(context.Context) error, onError func(error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("run periodically: interval %s is not positive", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := pass(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
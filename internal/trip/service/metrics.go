@@ -0,0 +1,28 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/surge"
+)
+
+// areaPrecision is the geohash length of the areas metrics are grouped by;
+// 5 is roughly 4.9km x 4.9km, coarse enough to keep label cardinality low.
+const areaPrecision = 5
+
+var unmatchedTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "trips_no_driver_found_total",
+	Help: "Trips that expired without a driver, per pickup area geohash.",
+}, []string{"area", "vehicle_type"})
+
+var deferredDispatches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "trips_dispatch_deferred_total",
+	Help: "New or declined trips that could not be dispatched and wait for the redispatch sweep.",
+})
+
+// tripArea is the geohash cell of the trip's pickup.
+func tripArea(trip domain.Trip) string {
+	return surge.Geohash(trip.Pickup.Lat, trip.Pickup.Lng, areaPrecision)
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/catalog"
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// poolCandidateLimit bounds the drivers near the pickup inspected when
+// looking for one a pooled trip can join.
+const poolCandidateLimit = 50
+
+// WithPooling enables shared rides. Trips of shared products are first
+// offered to drivers already carrying riders of the same product, provided
+// the detour and pickup wait estimated with estimator stay within
+// Config.PoolMaxDetour and Config.PoolMaxPickupWait.
+// Shared routes are read from pools. Pooling also needs a matcher that
+// implements domain.SeatReserver.
+func WithPooling(estimator TripEstimator, pools domain.PoolRepository) Option {
+	return func(s *Service) {
+		s.poolETA = estimator
+		s.pools = pools
+	}
+}
+
+// PoolRoute is a driver's shared route as it currently stands.
+type PoolRoute struct {
+	ID          uuid.UUID         `json:"id"`
+	DriverID    uuid.UUID         `json:"driver_id"`
+	VehicleType string            `json:"vehicle_type"`
+	Visited     []domain.Waypoint `json:"visited"`
+	Remaining   []domain.Waypoint `json:"remaining"`
+}
+
+// PoolRoute returns the shared route id, named after its first trip.
+func (s *Service) PoolRoute(ctx context.Context, id uuid.UUID) (PoolRoute, error) {
+	if s.pools == nil {
+		return PoolRoute{}, domain.ErrPoolNotFound
+	}
+	pool, err := s.pools.GetPool(ctx, id)
+	if err != nil {
+		return PoolRoute{}, err
+	}
+	trips, err := s.poolTrips(ctx, pool)
+	if err != nil {
+		return PoolRoute{}, err
+	}
+	visited, remaining := pool.Progress(trips)
+	route := PoolRoute{ID: pool.ID, DriverID: pool.DriverID, VehicleType: pool.VehicleType, Visited: visited, Remaining: remaining}
+	if route.Visited == nil {
+		route.Visited = []domain.Waypoint{}
+	}
+	if route.Remaining == nil {
+		route.Remaining = []domain.Waypoint{}
+	}
+	return route, nil
+}
+
+// poolOffer is a driver who can take a trip on top of their current riders.
+type poolOffer struct {
+	driverID uuid.UUID
+	// pool holds the route extended by the trip.
+	pool  domain.Pool
+	added time.Duration
+}
+
+// assignToPool tries to seat a trip of a shared product with a driver already
+// on an in-progress trip of that product, cheapest detour first. It reports
+// false when pooling does not apply or no driver can take the trip, leaving
+// the caller to match it like any other trip.
+func (s *Service) assignToPool(ctx context.Context, trip domain.Trip) (domain.Trip, bool, error) {
+	reserver, ok := s.matcher.(domain.SeatReserver)
+	if !ok || s.poolETA == nil || s.pools == nil {
+		return trip, false, nil
+	}
+	product, err := s.product(trip.VehicleType)
+	if err != nil || !product.Shared {
+		return trip, false, err
+	}
+	offers, err := s.poolOffers(ctx, reserver, trip, product)
+	if err != nil {
+		return trip, false, err
+	}
+	for _, offer := range offers {
+		reserved, err := reserver.ReserveSeats(ctx, offer.driverID, trip, product.Seats)
+		if err != nil {
+			return trip, false, fmt.Errorf("reserve seats: %w", err)
+		}
+		if !reserved {
+			continue
+		}
+		assigned, err := s.assignPooled(ctx, trip, offer)
+		if err == nil {
+			return assigned, true, nil
+		}
+		_ = reserver.ReleaseSeats(ctx, offer.driverID, trip.ID)
+		// Another rider joined the pool or the driver's trips changed since
+		// the offer was planned.
+		if !errors.Is(err, domain.ErrVersionConflict) && !errors.Is(err, domain.ErrActiveTrip) {
+			return trip, false, fmt.Errorf("assign pooled driver: %w", err)
+		}
+	}
+	return trip, false, nil
+}
+
+// assignPooled assigns trip to the offer's driver and saves the extended
+// route with the assignment.
+func (s *Service) assignPooled(ctx context.Context, trip domain.Trip, offer poolOffer) (domain.Trip, error) {
+	driverID, poolID := offer.driverID, offer.pool.ID
+	return s.transitionWith(ctx, trip, domain.CommandAssignDriver, domain.Input{DriverID: &driverID}, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		deadline := now.Add(s.config.AcceptTimeout)
+		trip.DriverID = &driverID
+		trip.AcceptDeadline = &deadline
+		trip.PoolID = &poolID
+		return domain.DriverAssignedPayload{DriverID: driverID, AcceptDeadline: deadline, PoolID: &poolID}, nil
+	}, func(tx domain.Tx) error {
+		pool := offer.pool
+		pool.UpdatedAt = s.clock.Now()
+		_, err := tx.Pools().SavePool(ctx, pool)
+		return err
+	})
+}
+
+// poolOffers lists the drivers near trip's pickup who are on an in-progress
+// trip of its product and have room for it within the detour budget,
+// cheapest detour first.
+func (s *Service) poolOffers(ctx context.Context, reserver domain.SeatReserver, trip domain.Trip, product catalog.Product) ([]poolOffer, error) {
+	nearby, err := reserver.PoolCandidates(ctx, trip, poolCandidateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("find drivers to pool with: %w", err)
+	}
+	var offers []poolOffer
+	for _, driverID := range nearby {
+		if trip.HasDeclined(driverID) {
+			continue
+		}
+		offer, ok, err := s.planPool(ctx, driverID, trip, product)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			offers = append(offers, offer)
+		}
+	}
+	sort.SliceStable(offers, func(i, j int) bool { return offers[i].added < offers[j].added })
+	return offers, nil
+}
+
+// planPool checks that driverID is carrying riders of trip's product and has
+// seats left for it, and finds where its pickup and dropoff fit into the
+// driver's shared route.
+func (s *Service) planPool(ctx context.Context, driverID uuid.UUID, trip domain.Trip, product catalog.Product) (poolOffer, bool, error) {
+	active, err := s.repo.SearchTrips(ctx, domain.TripFilter{
+		DriverID: &driverID,
+		Statuses: domain.ActiveStatuses(),
+	}, nil, product.Seats+1)
+	if err != nil {
+		return poolOffer{}, false, fmt.Errorf("active trips of driver %s: %w", driverID, err)
+	}
+	if !ridingPool(active, trip.VehicleType) {
+		return poolOffer{}, false, nil
+	}
+	seats := trip.SeatCount()
+	for _, t := range active {
+		seats += t.SeatCount()
+	}
+	if seats > product.Seats {
+		return poolOffer{}, false, nil
+	}
+	pool, err := s.pools.GetPool(ctx, active[0].PoolKey())
+	if errors.Is(err, domain.ErrPoolNotFound) {
+		anchor, err := s.repo.GetTripByID(ctx, active[0].PoolKey())
+		if err != nil {
+			return poolOffer{}, false, err
+		}
+		pool = domain.NewPool(anchor)
+	} else if err != nil {
+		return poolOffer{}, false, fmt.Errorf("load pool %s: %w", active[0].PoolKey(), err)
+	}
+	trips, err := s.poolTrips(ctx, pool)
+	if err != nil {
+		return poolOffer{}, false, err
+	}
+	visited, remaining := pool.Progress(trips)
+	start, located, err := s.driverPosition(ctx, active)
+	if err != nil {
+		return poolOffer{}, false, err
+	}
+	if !located {
+		// Without breadcrumbs the driver is taken to be where they last
+		// picked up or dropped off a rider.
+		start = trips[pool.ID].Pickup
+		if len(visited) > 0 {
+			start = visited[len(visited)-1].Point
+		}
+	}
+	leg := func(from, to domain.GeoPoint) time.Duration {
+		return s.poolETA.EstimateTripETA(ctx, from, to)
+	}
+	insertion, ok := domain.PlanInsertion(start, remaining, trip, leg, domain.PoolLimits{
+		MaxDetour:     s.config.PoolMaxDetour,
+		MaxPickupWait: s.config.PoolMaxPickupWait,
+	})
+	if !ok {
+		return poolOffer{}, false, nil
+	}
+	pool.DriverID = driverID
+	pool.Waypoints = append(visited, insertion.Route...)
+	return poolOffer{driverID: driverID, pool: pool, added: insertion.Added}, true, nil
+}
+
+// ridingPool reports whether trips, a driver's active trips, are all of
+// vehicleType with at least one in progress.
+func ridingPool(trips []domain.Trip, vehicleType string) bool {
+	riding := false
+	for _, t := range trips {
+		if t.VehicleType != vehicleType {
+			return false
+		}
+		riding = riding || t.Status == domain.StatusInProgress
+	}
+	return riding
+}
+
+// driverPosition is the driver's latest breadcrumb on any of their
+// in-progress trips. It reports false when none is recorded.
+func (s *Service) driverPosition(ctx context.Context, active []domain.Trip) (domain.GeoPoint, bool, error) {
+	if s.crumbs == nil {
+		return domain.GeoPoint{}, false, nil
+	}
+	var latest *domain.Breadcrumb
+	for _, t := range active {
+		if t.Status != domain.StatusInProgress {
+			continue
+		}
+		crumbs, err := s.crumbs.ListBreadcrumbs(ctx, t.ID)
+		if err != nil {
+			return domain.GeoPoint{}, false, fmt.Errorf("breadcrumbs of trip %s: %w", t.ID, err)
+		}
+		if n := len(crumbs); n > 0 && (latest == nil || crumbs[n-1].RecordedAt.After(latest.RecordedAt)) {
+			latest = &crumbs[n-1]
+		}
+	}
+	if latest == nil {
+		return domain.GeoPoint{}, false, nil
+	}
+	return latest.Point, true, nil
+}
+
+// poolTrips loads every trip with a waypoint on pool's route.
+func (s *Service) poolTrips(ctx context.Context, pool domain.Pool) (map[uuid.UUID]domain.Trip, error) {
+	trips := make(map[uuid.UUID]domain.Trip)
+	for _, wp := range pool.Waypoints {
+		if _, ok := trips[wp.TripID]; ok {
+			continue
+		}
+		trip, err := s.repo.GetTripByID(ctx, wp.TripID)
+		if err != nil {
+			return nil, fmt.Errorf("load pooled trip %s: %w", wp.TripID, err)
+		}
+		trips[wp.TripID] = trip
+	}
+	return trips, nil
+}
+
+// releaseSeats frees what trip held of driverID's vehicle: only its own seats
+// when it rode a pool, so the other riders keep theirs.
+func (s *Service) releaseSeats(ctx context.Context, driverID uuid.UUID, trip domain.Trip) {
+	if reserver, ok := s.matcher.(domain.SeatReserver); ok && trip.PoolID != nil {
+		_ = reserver.ReleaseSeats(ctx, driverID, trip.ID)
+		return
+	}
+	s.releaseDriver(ctx, driverID)
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/pricing"
+	"github.com/example/ridellite/internal/trip/quote"
+)
+
+// TripEstimator predicts how long a ride from pickup through stops to
+// dropoff takes. It is satisfied by the ETA service.
+type TripEstimator interface {
+	EstimateTripETA(ctx context.Context, pickup, dropoff domain.GeoPoint, stops ...domain.GeoPoint) time.Duration
+}
+
+// SurgePricer reports the demand based multiplier applied to quotes at a
+// pickup point.
+type SurgePricer interface {
+	Multiplier(point domain.GeoPoint) float64
+}
+
+// The quoted range brackets the expected fare by assuming the ride takes
+// between these fractions of the estimated duration.
+const (
+	quoteLowDurationFactor  = 0.8
+	quoteHighDurationFactor = 1.3
+)
+
+// WithQuotes enables upfront quotes signed by signer and priced from the
+// durations reported by estimator.
+func WithQuotes(signer *quote.Signer, estimator TripEstimator) Option {
+	return func(s *Service) {
+		s.quotes = signer
+		s.estimator = estimator
+	}
+}
+
+// WithSurge applies multipliers from surge to upfront quotes.
+func WithSurge(surge SurgePricer) Option {
+	return func(s *Service) { s.surge = surge }
+}
+
+// QuoteRequest describes the ride the authenticated rider wants priced.
+type QuoteRequest struct {
+	Pickup      domain.GeoPoint
+	Dropoff     domain.GeoPoint
+	Stops       []domain.GeoPoint
+	VehicleType string
+}
+
+// QuoteResponse carries the upfront price and the token that locks it in.
+type QuoteResponse struct {
+	QuoteID         uuid.UUID `json:"quote_id"`
+	Token           string    `json:"quote_token"`
+	VehicleType     string    `json:"vehicle_type"`
+	PriceCents      int64     `json:"price_cents"`
+	PriceLowCents   int64     `json:"price_low_cents"`
+	PriceHighCents  int64     `json:"price_high_cents"`
+	DistanceKM      float64   `json:"distance_km"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	SurgeMultiplier float64   `json:"surge_multiplier"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// Quote prices a ride before it is requested. The returned token can be
+// passed to CreateTrip until it expires to lock in PriceCents.
+func (s *Service) Quote(ctx context.Context, req QuoteRequest) (QuoteResponse, error) {
+	if s.quotes == nil || s.estimator == nil {
+		return QuoteResponse{}, domain.ErrQuotesUnavailable
+	}
+	riderID, err := s.requestingRider(ctx, CommandQuote)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	product, err := s.product(req.VehicleType)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	if err := s.validateStops(req.Stops); err != nil {
+		return QuoteResponse{}, err
+	}
+	route := append(append([]domain.GeoPoint{req.Pickup}, req.Stops...), req.Dropoff)
+	ride := pricing.Ride{
+		VehicleType:     product.PricingKey,
+		DistanceKM:      routeKM(route),
+		Duration:        s.estimator.EstimateTripETA(ctx, req.Pickup, req.Dropoff, req.Stops...),
+		Stops:           len(req.Stops),
+		SurgeMultiplier: 1,
+	}
+	if s.surge != nil {
+		ride.SurgeMultiplier = s.surge.Multiplier(req.Pickup)
+	}
+	expected, err := s.pricing.Calculate(ride)
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	low, err := s.pricing.Calculate(scaleDuration(ride, quoteLowDurationFactor))
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	high, err := s.pricing.Calculate(scaleDuration(ride, quoteHighDurationFactor))
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	q, token, err := s.quotes.Issue(quote.Quote{
+		RiderID:     riderID,
+		VehicleType: req.VehicleType,
+		Pickup:      req.Pickup,
+		Dropoff:     req.Dropoff,
+		Stops:       req.Stops,
+		PriceCents:  expected.TotalCents,
+	})
+	if err != nil {
+		return QuoteResponse{}, err
+	}
+	return QuoteResponse{
+		QuoteID:         q.ID,
+		Token:           token,
+		VehicleType:     q.VehicleType,
+		PriceCents:      q.PriceCents,
+		PriceLowCents:   low.TotalCents,
+		PriceHighCents:  high.TotalCents,
+		DistanceKM:      ride.DistanceKM,
+		DurationSeconds: int64(ride.Duration.Seconds()),
+		SurgeMultiplier: ride.SurgeMultiplier,
+		ExpiresAt:       q.ExpiresAt,
+	}, nil
+}
+
+// redeemQuote verifies token and checks that it was issued to riderID for req.
+func (s *Service) redeemQuote(token string, riderID uuid.UUID, req CreateTripRequest) (quote.Quote, error) {
+	if s.quotes == nil {
+		return quote.Quote{}, domain.ErrQuotesUnavailable
+	}
+	q, err := s.quotes.Verify(token)
+	if err != nil {
+		return quote.Quote{}, err
+	}
+	if q.RiderID != riderID || q.VehicleType != req.VehicleType || q.Pickup != req.Pickup || q.Dropoff != req.Dropoff ||
+		!slices.Equal(q.Stops, req.Stops) {
+		return quote.Quote{}, fmt.Errorf("%w: quote was issued for a different ride", domain.ErrQuoteInvalid)
+	}
+	return q, nil
+}
+
+func scaleDuration(ride pricing.Ride, factor float64) pricing.Ride {
+	ride.Duration = time.Duration(float64(ride.Duration) * factor)
+	return ride
+}
+
+func routeKM(route []domain.GeoPoint) float64 {
+	return domain.RouteMeters(route...) / 1000
+}
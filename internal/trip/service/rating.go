@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// RateTripRequest is the feedback one party of a trip gives the other. The
+// rater is the caller named by the claims in the context.
+type RateTripRequest struct {
+	Stars   int
+	Tags    []string
+	Comment string
+}
+
+// RateTrip records the rating the trip's rider or driver gives the other
+// party and updates the ratee's averages. Only completed trips can be rated,
+// once per party and within Config.RatingWindow of completion. The rating
+// and its TripRated event are written in one unit of work.
+func (s *Service) RateTrip(ctx context.Context, tripID uuid.UUID, req RateTripRequest) (domain.Rating, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return domain.Rating{}, err
+	}
+	rating, err := s.ratingParties(ctx, trip)
+	if err != nil {
+		return domain.Rating{}, err
+	}
+	if trip.Status != domain.StatusCompleted {
+		return domain.Rating{}, fmt.Errorf("%w: cannot rate a %s trip", domain.ErrInvalidTransition, trip.Status)
+	}
+	now := s.clock.Now()
+	if trip.FinishedAt != nil && now.After(trip.FinishedAt.Add(*s.config.RatingWindow)) {
+		return domain.Rating{}, domain.ErrRatingWindowClosed
+	}
+	rating.Stars, rating.Tags, rating.Comment, rating.CreatedAt = req.Stars, req.Tags, req.Comment, now
+	if err := rating.Validate(); err != nil {
+		return domain.Rating{}, err
+	}
+	event := domain.TripEvent{
+		Type: domain.EventTripRated,
+		Payload: domain.TripRatedPayload{
+			RaterID:   rating.RaterID,
+			RateeID:   rating.RateeID,
+			RateeRole: rating.RateeRole,
+			Stars:     rating.Stars,
+			Tags:      rating.Tags,
+		},
+		CreatedAt: now,
+	}
+	_, err = s.commit(ctx, func(tx domain.Tx) (domain.Trip, error) {
+		return trip, tx.Ratings().CreateRating(ctx, rating, s.config.RatingSpan)
+	}, []domain.TripEvent{event})
+	if err != nil {
+		return domain.Rating{}, err
+	}
+	return rating, nil
+}
+
+// ListTripRatings returns the ratings given for a trip to its rider, its
+// driver or an admin, as named by the claims in ctx.
+func (s *Service) ListTripRatings(ctx context.Context, tripID uuid.UUID) ([]domain.Rating, error) {
+	if s.ratings == nil {
+		return nil, domain.ErrRatingsUnavailable
+	}
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeParty(ctx, trip, CommandViewRatings); err != nil {
+		return nil, err
+	}
+	ratings, err := s.ratings.ListTripRatings(ctx, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("list ratings of trip %s: %w", tripID, err)
+	}
+	if ratings == nil {
+		ratings = []domain.Rating{}
+	}
+	return ratings, nil
+}
+
+// RatingSummaries returns the averages of every role userID was rated in,
+// for matching and ops tooling. Only userID themselves and admins, as named
+// by the claims in ctx, may read them.
+func (s *Service) RatingSummaries(ctx context.Context, userID uuid.UUID) ([]domain.RatingSummary, error) {
+	if s.ratings == nil {
+		return nil, domain.ErrRatingsUnavailable
+	}
+	if err := s.authorizeUser(ctx, userID, CommandViewRatings); err != nil {
+		return nil, err
+	}
+	summaries, err := s.ratings.GetRatingSummaries(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("rating summaries of %s: %w", userID, err)
+	}
+	if summaries == nil {
+		summaries = []domain.RatingSummary{}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// tripsPerDriver bounds the in-progress trips a location update is recorded
+// for; pooled drivers carry several.
+const tripsPerDriver = 10
+
+// WithBreadcrumbs records driver locations reported by RecordLocation against
+// their in-progress trips in crumbs, so completed trips whose breadcrumbs
+// cover the ride are priced on the distance actually driven. Without it
+// TripRoute fails with domain.ErrRoutesUnavailable.
+func WithBreadcrumbs(crumbs domain.BreadcrumbRepository) Option {
+	return func(s *Service) { s.crumbs = crumbs }
+}
+
+// RecordLocation adds snap as a breadcrumb to every in-progress trip of its
+// driver, stamped with the time the position was reported rather than
+// received. Fixes less accurate than domain.MaxBreadcrumbAccuracyMeters are
+// dropped.
+func (s *Service) RecordLocation(ctx context.Context, snap domain.LocationSnapshot) error {
+	if s.crumbs == nil {
+		return nil
+	}
+	crumb := domain.Breadcrumb{Point: snap.Point, Speed: snap.Speed, Accuracy: snap.Accuracy, RecordedAt: snap.Updated}
+	if crumb.RecordedAt.IsZero() {
+		crumb.RecordedAt = s.clock.Now()
+	}
+	if !crumb.Usable() {
+		return nil
+	}
+	driverID := snap.DriverID
+	trips, err := s.repo.SearchTrips(ctx, domain.TripFilter{
+		DriverID: &driverID,
+		Statuses: []domain.TripStatus{domain.StatusInProgress},
+	}, nil, tripsPerDriver)
+	if err != nil {
+		return fmt.Errorf("in-progress trips of driver %s: %w", driverID, err)
+	}
+	for _, trip := range trips {
+		crumb.TripID = trip.ID
+		if err := s.crumbs.AppendBreadcrumb(ctx, crumb); err != nil {
+			return fmt.Errorf("record breadcrumb of trip %s: %w", trip.ID, err)
+		}
+	}
+	return nil
+}
+
+// TripRoute is the path a trip was driven, as GeoJSON and as an encoded
+// polyline.
+type TripRoute struct {
+	TripID          uuid.UUID    `json:"trip_id"`
+	DistanceMeters  float64      `json:"distance_meters"`
+	DurationSeconds int64        `json:"duration_seconds"`
+	Polyline        string       `json:"polyline"`
+	GeoJSON         RouteFeature `json:"geojson"`
+}
+
+// RouteFeature is a GeoJSON Feature holding a LineString.
+type RouteFeature struct {
+	Type       string         `json:"type"`
+	Geometry   RouteGeometry  `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// RouteGeometry is a GeoJSON LineString; positions are [longitude, latitude].
+type RouteGeometry struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+// TripRoute returns the route recorded for a trip so far to its rider, its
+// driver or an admin, as named by the claims in ctx.
+func (s *Service) TripRoute(ctx context.Context, tripID uuid.UUID) (TripRoute, error) {
+	if s.crumbs == nil {
+		return TripRoute{}, domain.ErrRoutesUnavailable
+	}
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return TripRoute{}, err
+	}
+	if err := s.authorizeParty(ctx, trip, CommandViewRoute); err != nil {
+		return TripRoute{}, err
+	}
+	driven, err := s.drivenRoute(ctx, tripID)
+	if err != nil {
+		return TripRoute{}, err
+	}
+	coordinates := make([][2]float64, len(driven.Points))
+	for i, p := range driven.Points {
+		coordinates[i] = [2]float64{p.Lng, p.Lat}
+	}
+	route := TripRoute{
+		TripID:          tripID,
+		DistanceMeters:  driven.DistanceMeters,
+		DurationSeconds: int64(driven.Duration.Seconds()),
+		Polyline:        domain.EncodePolyline(driven.Points),
+		GeoJSON: RouteFeature{
+			Type:     "Feature",
+			Geometry: RouteGeometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]any{
+				"trip_id":          tripID,
+				"distance_meters":  driven.DistanceMeters,
+				"duration_seconds": int64(driven.Duration.Seconds()),
+			},
+		},
+	}
+	return route, nil
+}
+
+// drivenRoute measures the breadcrumbs of tripID, returning an empty route
+// when none are recorded.
+func (s *Service) drivenRoute(ctx context.Context, tripID uuid.UUID) (domain.DrivenRoute, error) {
+	if s.crumbs == nil {
+		return domain.DrivenRoute{}, nil
+	}
+	crumbs, err := s.crumbs.ListBreadcrumbs(ctx, tripID)
+	if err != nil {
+		return domain.DrivenRoute{}, fmt.Errorf("breadcrumbs of trip %s: %w", tripID, err)
+	}
+	return domain.MeasureRoute(crumbs), nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// scheduleBatchSize bounds how many scheduled trips one ProcessScheduledTrips pass inspects.
+const scheduleBatchSize = 100
+
+// validatePickupAt checks that a ride booked at now for pickupAt leaves room
+// for the lead window and is not too far ahead.
+func (s *Service) validatePickupAt(pickupAt, now time.Time) error {
+	if pickupAt.Before(now.Add(s.config.ScheduleLeadTime)) {
+		return fmt.Errorf("%w: must be at least %s ahead", domain.ErrInvalidPickupTime, s.config.ScheduleLeadTime)
+	}
+	if pickupAt.After(now.Add(s.config.MaxScheduleAhead)) {
+		return fmt.Errorf("%w: must be at most %s ahead", domain.ErrInvalidPickupTime, s.config.MaxScheduleAhead)
+	}
+	return nil
+}
+
+// ProcessScheduledTrips emits due reminders for scheduled rides and releases
+// those whose lead window started to matching. Rides still not released
+// Config.PickupGracePeriod after their pickup time end as NO_DRIVER_FOUND
+// instead of being retried. It reports how many trips were released. A trip
+// that fails does not hold up the others; the failures are returned joined.
+func (s *Service) ProcessScheduledTrips(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	expired := now.Add(-s.config.PickupGracePeriod)
+	var errs []error
+	if err := s.expireMissedPickups(ctx, expired); err != nil {
+		errs = append(errs, err)
+	}
+	horizon := s.config.ScheduleLeadTime
+	if len(s.config.ReminderOffsets) > 0 && s.config.ReminderOffsets[0] > horizon {
+		horizon = s.config.ReminderOffsets[0]
+	}
+	trips, err := s.repo.ListScheduledTrips(ctx, expired, now.Add(horizon), scheduleBatchSize)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("list scheduled trips: %w", err))
+		return 0, errors.Join(errs...)
+	}
+	released := 0
+	for _, trip := range trips {
+		if s.machine.Can(trip.Status, domain.CommandRelease) && !now.Before(trip.PickupAt.Add(-s.config.ScheduleLeadTime)) {
+			updated, err := s.transition(ctx, trip, domain.CommandRelease, domain.Input{}, func(trip *domain.Trip, _ time.Time) (domain.EventPayload, error) {
+				return domain.TripReleasedPayload{PickupAt: *trip.PickupAt}, nil
+			})
+			if errors.Is(err, domain.ErrVersionConflict) {
+				// The rider cancelled while we were sweeping.
+				continue
+			}
+			if errors.Is(err, domain.ErrActiveTrip) {
+				// The rider is still on another trip; retry on the next pass
+				// until the pickup grace period ends.
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("release trip %s: %w", trip.ID, err))
+				continue
+			}
+			released++
+			if err := s.dispatch(ctx, updated.ID); err != nil {
+				errs = append(errs, fmt.Errorf("dispatch trip %s: %w", updated.ID, err))
+			}
+			continue
+		}
+		if err := s.remind(ctx, trip, now); err != nil && !errors.Is(err, domain.ErrVersionConflict) {
+			errs = append(errs, fmt.Errorf("remind trip %s: %w", trip.ID, err))
+		}
+	}
+	return released, errors.Join(errs...)
+}
+
+// expireMissedPickups ends scheduled rides picking up by pickupBefore, whose
+// grace period passed without them being released, as NO_DRIVER_FOUND.
+func (s *Service) expireMissedPickups(ctx context.Context, pickupBefore time.Time) error {
+	trips, err := s.repo.ListScheduledTrips(ctx, time.Time{}, pickupBefore, scheduleBatchSize)
+	if err != nil {
+		return fmt.Errorf("list missed scheduled trips: %w", err)
+	}
+	var errs []error
+	for _, trip := range trips {
+		startedAt := trip.MatchingStartedAt(s.config.ScheduleLeadTime)
+		_, err := s.transition(ctx, trip, domain.CommandExpireRequest, domain.Input{}, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+			return domain.TripExpiredPayload{WaitedSeconds: int64(now.Sub(startedAt) / time.Second)}, nil
+		})
+		if errors.Is(err, domain.ErrVersionConflict) {
+			// The rider cancelled while we were sweeping.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire trip %s: %w", trip.ID, err))
+			continue
+		}
+		unmatchedTrips.WithLabelValues(tripArea(trip), trip.VehicleType).Inc()
+	}
+	return errors.Join(errs...)
+}
+
+// remind emits one reminder for the closest offset that is due and not yet
+// sent. Reminders missed while the scheduler was down are skipped rather
+// than delivered in a burst.
+func (s *Service) remind(ctx context.Context, trip domain.Trip, now time.Time) error {
+	due := trip.RemindersSent
+	for due < len(s.config.ReminderOffsets) && !now.Before(trip.PickupAt.Add(-s.config.ReminderOffsets[due])) {
+		due++
+	}
+	if due == trip.RemindersSent {
+		return nil
+	}
+	trip.RemindersSent = due
+	_, err := s.update(ctx, trip, domain.TripEvent{
+		Type: domain.EventScheduleReminder,
+		Payload: domain.ScheduleReminderPayload{
+			RiderID:         trip.RiderID,
+			PickupAt:        *trip.PickupAt,
+			MinutesToPickup: int64(trip.PickupAt.Sub(now).Minutes()),
+			RemindersSent:   due,
+		},
+		CreatedAt: now,
+	})
+	return err
+}
+
+// sortedOffsets returns offsets ordered from furthest to closest to pickup.
+func sortedOffsets(offsets []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), offsets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	return sorted
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+const (
+	// defaultSearchLimit is the page size used when the caller sets none.
+	defaultSearchLimit = 20
+	// maxSearchLimit caps the page size a caller can ask for.
+	maxSearchLimit = 100
+)
+
+// SearchTripsRequest filters a trip listing. Cursor is the NextCursor of the
+// previous page, empty for the first one.
+type SearchTripsRequest struct {
+	Filter domain.TripFilter
+	Cursor string
+	Limit  int
+}
+
+// SearchTripsResponse holds one page of trips, newest request first.
+// NextCursor is empty on the last page.
+type SearchTripsResponse struct {
+	Trips      []domain.Trip `json:"trips"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// SearchTrips lists trips matching req.Filter with keyset pagination. The
+// caller is taken from the claims in ctx; anyone but an admin only finds
+// their own trips and gets ErrNotTripParty when filtering on someone else.
+func (s *Service) SearchTrips(ctx context.Context, req SearchTripsRequest) (SearchTripsResponse, error) {
+	if err := s.scopeSearch(ctx, &req.Filter); err != nil {
+		return SearchTripsResponse{}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	var after *domain.TripCursor
+	if req.Cursor != "" {
+		cursor, err := domain.ParseTripCursor(req.Cursor)
+		if err != nil {
+			return SearchTripsResponse{}, err
+		}
+		after = &cursor
+	}
+	// Fetch one extra trip to learn whether another page follows.
+	trips, err := s.repo.SearchTrips(ctx, req.Filter, after, limit+1)
+	if err != nil {
+		return SearchTripsResponse{}, fmt.Errorf("search trips: %w", err)
+	}
+	resp := SearchTripsResponse{Trips: trips}
+	if len(trips) > limit {
+		resp.Trips = trips[:limit]
+		resp.NextCursor = domain.CursorAfter(resp.Trips[limit-1]).Encode()
+	}
+	if resp.Trips == nil {
+		resp.Trips = []domain.Trip{}
+	}
+	return resp, nil
+}
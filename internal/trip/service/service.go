@@ -2,34 +2,232 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/example/ridellite/internal/trip/cancellation"
+	"github.com/example/ridellite/internal/trip/catalog"
 	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/pricing"
+	"github.com/example/ridellite/internal/trip/quote"
 )
 
 // Service coordinates trip operations between handlers and repositories.
 type Service struct {
 	repo       domain.Repository
-	events     domain.EventPublisher
+	uow        domain.UnitOfWork
 	matcher    domain.MatchingEngine
 	clock      domain.Clock
-	idempotent domain.IdempotencyRepository
+	machine    *domain.StateMachine
+	config     Config
+	dispatcher Dispatcher
+	catalog    *catalog.Catalog
+	pricing    *pricing.Engine
+	cancelling *cancellation.Engine
+	quotes     *quote.Signer
+	estimator  TripEstimator
+	surge      SurgePricer
+	ratings    domain.RatingRepository
+	adjusting  domain.FareAdjustmentRepository
+	poolETA    TripEstimator
+	pools      domain.PoolRepository
+	crumbs     domain.BreadcrumbRepository
+	audit      AuditLog
 }
 
-// New constructs a Service with the required collaborators.
-func New(repo domain.Repository, events domain.EventPublisher, matcher domain.MatchingEngine, clock domain.Clock, idem domain.IdempotencyRepository) *Service {
-	return &Service{repo: repo, events: events, matcher: matcher, clock: clock, idempotent: idem}
+// Config holds tunables of the trip lifecycle.
+type Config struct {
+	// FreeWaitingWindow is how long a driver waits at pickup before the rider
+	// can be marked as a no-show.
+	FreeWaitingWindow time.Duration
+	// NoShowFeeCents is charged to the rider when a no-show is recorded. Nil
+	// applies DefaultNoShowFeeCents; zero waives the fee.
+	NoShowFeeCents *int64
+	// AcceptTimeout is how long an assigned driver has to accept before the
+	// trip is dispatched to someone else.
+	AcceptTimeout time.Duration
+	// MatchTimeout is how long a trip looks for a driver before it ends as
+	// NO_DRIVER_FOUND.
+	MatchTimeout time.Duration
+	// ScheduleLeadTime is how long before a scheduled pickup matching starts.
+	// Riders cancel scheduled rides for free until then.
+	ScheduleLeadTime time.Duration
+	// MaxScheduleAhead bounds how far in advance rides can be booked.
+	MaxScheduleAhead time.Duration
+	// PickupGracePeriod is how long past its pickup time a scheduled ride
+	// that could not be released, for example because the rider is still on
+	// another trip, waits before it ends as NO_DRIVER_FOUND.
+	PickupGracePeriod time.Duration
+	// ReminderOffsets are the durations before pickup at which a scheduled
+	// ride reminder is emitted.
+	ReminderOffsets []time.Duration
+	// MaxStops bounds the intermediate stops of a trip. Nil applies
+	// DefaultMaxStops; zero allows none.
+	MaxStops *int
+	// RatingWindow is how long after completion either party can rate the
+	// trip. Nil applies domain.DefaultRatingWindow.
+	RatingWindow *time.Duration
+	// RatingSpan is the number of recent ratings a user's rolling average
+	// roughly covers.
+	RatingSpan int
+	// TipWindow is how long after completion the rider can add a tip. Nil
+	// applies domain.DefaultTipWindow.
+	TipWindow *time.Duration
+	// PoolMaxDetour bounds how much later a pooled rider arrives because
+	// another rider joins their driver.
+	PoolMaxDetour time.Duration
+	// PoolMaxPickupWait bounds how long a rider joining a pooled ride waits
+	// for the driver.
+	PoolMaxPickupWait time.Duration
 }
 
-// CreateTripRequest contains the request payload for creating a trip.
+const (
+	// DefaultNoShowFeeCents is charged when Config.NoShowFeeCents is nil.
+	DefaultNoShowFeeCents = 500
+	// DefaultAcceptTimeout applies when Config.AcceptTimeout is unset.
+	DefaultAcceptTimeout = 15 * time.Second
+	// DefaultMaxScheduleAhead applies when Config.MaxScheduleAhead is unset.
+	DefaultMaxScheduleAhead = 30 * 24 * time.Hour
+	// DefaultMaxStops applies when Config.MaxStops is nil.
+	DefaultMaxStops = 3
+)
+
+// DefaultReminderOffsets apply when Config.ReminderOffsets is unset.
+var DefaultReminderOffsets = []time.Duration{24 * time.Hour, time.Hour}
+
+// Option customises a Service.
+type Option func(*Service)
+
+// WithConfig overrides the default lifecycle configuration.
+func WithConfig(cfg Config) Option {
+	return func(s *Service) { s.config = cfg }
+}
+
+// WithDispatcher runs matching through d instead of inline in the caller.
+func WithDispatcher(d Dispatcher) Option {
+	return func(s *Service) { s.dispatcher = d }
+}
+
+// WithCatalog replaces the default product catalog.
+func WithCatalog(c *catalog.Catalog) Option {
+	return func(s *Service) { s.catalog = c }
+}
+
+// WithPricing replaces the default fare engine.
+func WithPricing(engine *pricing.Engine) Option {
+	return func(s *Service) { s.pricing = engine }
+}
+
+// WithCancellation replaces the default cancellation policies.
+func WithCancellation(engine *cancellation.Engine) Option {
+	return func(s *Service) { s.cancelling = engine }
+}
+
+// WithRatings serves rating reads from ratings. Ratings are always written
+// through the unit of work; without this option reads fail with
+// domain.ErrRatingsUnavailable.
+func WithRatings(ratings domain.RatingRepository) Option {
+	return func(s *Service) { s.ratings = ratings }
+}
+
+// WithFareAdjustments serves fare statements from adjustments. Adjustments
+// are always written through the unit of work; without this option
+// statements fail with domain.ErrAdjustmentsUnavailable.
+func WithFareAdjustments(adjustments domain.FareAdjustmentRepository) Option {
+	return func(s *Service) { s.adjusting = adjustments }
+}
+
+// New constructs a Service with the required collaborators. Reads go through
+// repo while every state change is written through uow together with its
+// trip event and outbox message.
+func New(repo domain.Repository, uow domain.UnitOfWork, matcher domain.MatchingEngine, clock domain.Clock, opts ...Option) *Service {
+	s := &Service{repo: repo, uow: uow, matcher: matcher, clock: clock}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.config.FreeWaitingWindow <= 0 {
+		s.config.FreeWaitingWindow = domain.DefaultFreeWaitingWindow
+	}
+	if s.config.NoShowFeeCents == nil {
+		fee := int64(DefaultNoShowFeeCents)
+		s.config.NoShowFeeCents = &fee
+	}
+	if s.config.AcceptTimeout <= 0 {
+		s.config.AcceptTimeout = DefaultAcceptTimeout
+	}
+	if s.config.ScheduleLeadTime <= 0 {
+		s.config.ScheduleLeadTime = domain.DefaultScheduleLeadTime
+	}
+	if s.config.MatchTimeout <= 0 {
+		s.config.MatchTimeout = domain.DefaultMatchTimeout
+	}
+	if s.config.MaxScheduleAhead <= 0 {
+		s.config.MaxScheduleAhead = DefaultMaxScheduleAhead
+	}
+	if s.config.PickupGracePeriod <= 0 {
+		s.config.PickupGracePeriod = domain.DefaultPickupGracePeriod
+	}
+	if s.config.MaxStops == nil {
+		stops := DefaultMaxStops
+		s.config.MaxStops = &stops
+	}
+	if s.config.RatingWindow == nil {
+		window := domain.DefaultRatingWindow
+		s.config.RatingWindow = &window
+	}
+	if s.config.RatingSpan <= 0 {
+		s.config.RatingSpan = domain.DefaultRatingSpan
+	}
+	if s.config.TipWindow == nil {
+		window := domain.DefaultTipWindow
+		s.config.TipWindow = &window
+	}
+	if s.config.PoolMaxDetour <= 0 {
+		s.config.PoolMaxDetour = domain.DefaultPoolMaxDetour
+	}
+	if s.config.PoolMaxPickupWait <= 0 {
+		s.config.PoolMaxPickupWait = domain.DefaultPoolMaxPickupWait
+	}
+	if s.config.ReminderOffsets == nil {
+		s.config.ReminderOffsets = DefaultReminderOffsets
+	}
+	s.config.ReminderOffsets = sortedOffsets(s.config.ReminderOffsets)
+	if s.catalog == nil {
+		s.catalog = catalog.Default()
+	}
+	if s.pricing == nil {
+		s.pricing = pricing.NewEngine(pricing.DefaultRateCards())
+	}
+	if s.cancelling == nil {
+		s.cancelling = cancellation.NewEngine(cancellation.DefaultPolicies())
+	}
+	s.machine = domain.TripStateMachine(domain.LifecycleConfig{
+		FreeWaitingWindow: s.config.FreeWaitingWindow,
+		ScheduleLeadTime:  s.config.ScheduleLeadTime,
+		MatchTimeout:      s.config.MatchTimeout,
+		PickupGracePeriod: s.config.PickupGracePeriod,
+	})
+	return s
+}
+
+// CreateTripRequest contains the request payload for creating a trip. The
+// trip is for the authenticated caller.
 type CreateTripRequest struct {
-	RiderID     uuid.UUID
-	Pickup      domain.GeoPoint
-	Dropoff     domain.GeoPoint
+	Pickup  domain.GeoPoint
+	Dropoff domain.GeoPoint
+	// Stops are visited in order between Pickup and Dropoff.
+	Stops       []domain.GeoPoint
 	VehicleType string
+	// QuoteToken optionally locks in the price of an earlier Quote.
+	QuoteToken string
+	// PickupAt books the ride in advance; nil requests an immediate pickup.
+	PickupAt *time.Time
+	// Seats is how many seats the rider books; zero books one.
+	Seats int
 }
 
 // CreateTripResponse returns the created trip identifier and status.
@@ -38,58 +236,122 @@ type CreateTripResponse struct {
 	Status domain.TripStatus `json:"status"`
 }
 
-// CreateTrip handles a new trip creation request ensuring idempotency and driver matching.
-func (s *Service) CreateTrip(ctx context.Context, key string, req CreateTripRequest) (CreateTripResponse, error) {
-	if key != "" && s.idempotent != nil {
-		if cached, ok, err := s.idempotent.GetResponse(ctx, key); err == nil && ok {
-			return decodeCreateTripResponse(cached)
-		}
+// CreateTrip stores a new REQUESTED trip and hands it to the dispatcher.
+// Matching happens asynchronously; clients poll GetTrip for the outcome. A
+// failed dispatch leaves matching pending rather than failing the request. A
+// quote token fixes the trip's price to the quoted one. Rides with a pickup
+// time are stored as SCHEDULED instead and dispatched by ProcessScheduledTrips.
+// A rider who already has an active trip gets an *domain.ActiveTripError.
+func (s *Service) CreateTrip(ctx context.Context, req CreateTripRequest) (CreateTripResponse, error) {
+	riderID, err := s.requestingRider(ctx, CommandRequest)
+	if err != nil {
+		return CreateTripResponse{}, err
+	}
+	product, err := s.product(req.VehicleType)
+	if err != nil {
+		return CreateTripResponse{}, err
+	}
+	if err := s.validateStops(req.Stops); err != nil {
+		return CreateTripResponse{}, err
+	}
+	if product.Shared && len(req.Stops) > 0 {
+		return CreateTripResponse{}, fmt.Errorf("%w: pooled rides take no stops", domain.ErrTooManyStops)
+	}
+	seats := max(req.Seats, 1)
+	if req.Seats < 0 || seats > product.Seats {
+		return CreateTripResponse{}, fmt.Errorf("%w: %s carries %d", domain.ErrInvalidSeats, product.Code, product.Seats)
+	}
+	card, err := s.pricing.RateCard(product.PricingKey)
+	if err != nil {
+		return CreateTripResponse{}, err
 	}
 
 	trip := domain.Trip{
 		ID:          uuid.New(),
-		RiderID:     req.RiderID,
+		RiderID:     riderID,
 		Pickup:      req.Pickup,
 		Dropoff:     req.Dropoff,
 		VehicleType: req.VehicleType,
-		Status:      domain.StatusRequested,
+		Status:      domain.InitialStatus,
 		RequestedAt: s.clock.Now(),
+		Seats:       seats,
+		RateCard:    &card,
 		Version:     1,
 	}
+	for _, point := range req.Stops {
+		trip.Stops = append(trip.Stops, domain.Stop{Point: point})
+	}
+	// The creation event carries every field set here so the trip can be
+	// rebuilt from its events alone.
+	requested := domain.TripRequestedPayload{
+		RiderID:     trip.RiderID,
+		Pickup:      trip.Pickup,
+		Dropoff:     trip.Dropoff,
+		VehicleType: trip.VehicleType,
+		Seats:       trip.Seats,
+		Stops:       req.Stops,
+		RateCard:    trip.RateCard,
+	}
+	if req.PickupAt == nil {
+		if err := s.checkRiderIdle(ctx, trip.RiderID); err != nil {
+			return CreateTripResponse{}, err
+		}
+	} else {
+		if err := s.validatePickupAt(*req.PickupAt, trip.RequestedAt); err != nil {
+			return CreateTripResponse{}, err
+		}
+		pickupAt := req.PickupAt.UTC()
+		trip.PickupAt = &pickupAt
+		trip.Status = domain.StatusScheduled
+	}
+	if req.QuoteToken != "" {
+		q, err := s.redeemQuote(req.QuoteToken, riderID, req)
+		if err != nil {
+			return CreateTripResponse{}, err
+		}
+		trip.QuoteID = &q.ID
+		trip.UpfrontPriceCents = q.PriceCents
+		requested.QuoteID = &q.ID
+		requested.UpfrontPriceCents = q.PriceCents
+	}
 
-	created, err := s.repo.CreateTrip(ctx, trip)
+	event := domain.TripEvent{Type: domain.EventTripRequested, Payload: requested, CreatedAt: trip.RequestedAt}
+	if trip.PickupAt != nil {
+		event.Type = domain.EventTripScheduled
+		event.Payload = domain.TripScheduledPayload{TripRequestedPayload: requested, PickupAt: *trip.PickupAt}
+	}
+	created, err := s.create(ctx, trip, event)
 	if err != nil {
 		return CreateTripResponse{}, fmt.Errorf("create trip: %w", err)
 	}
 
-	if s.matcher != nil {
-		if driverID, err := s.matcher.ReserveDriver(ctx, created); err == nil && driverID != nil {
-			created.DriverID = driverID
-			created.Status = domain.StatusDriverAssigned
-			if _, err = s.repo.UpdateTrip(ctx, created); err != nil {
-				return CreateTripResponse{}, fmt.Errorf("assign driver: %w", err)
-			}
-			_ = s.events.Publish(ctx, domain.TripEvent{
-				TripID:  created.ID,
-				Type:    domain.EventDriverAssigned,
-				Payload: map[string]any{"driver_id": driverID.String()},
-			})
+	// A trip that could not be dispatched stays REQUESTED until
+	// RedispatchPendingTrips hands it to matching again.
+	if created.Status == domain.StatusRequested {
+		if err := s.dispatch(ctx, created.ID); err != nil {
+			deferredDispatches.Inc()
 		}
 	}
 
-	event := domain.TripEvent{
-		TripID:  created.ID,
-		Type:    domain.EventTripRequested,
-		Payload: map[string]any{"rider_id": created.RiderID.String()},
-	}
-	_ = s.events.Publish(ctx, event)
+	return CreateTripResponse{TripID: created.ID, Status: created.Status}, nil
+}
 
-	resp := CreateTripResponse{TripID: created.ID, Status: created.Status}
-	if key != "" && s.idempotent != nil {
-		_ = s.idempotent.PutResponse(ctx, key, encodeCreateTripResponse(resp))
-	}
+// Products lists the ride options riders can request.
+func (s *Service) Products() []catalog.Product {
+	return s.catalog.Products()
+}
 
-	return resp, nil
+// product resolves vehicleType through the catalog and checks that its
+// pricing key has a rate card.
+func (s *Service) product(vehicleType string) (catalog.Product, error) {
+	product, err := s.catalog.Lookup(vehicleType)
+	if err != nil {
+		return catalog.Product{}, err
+	}
+	if !s.pricing.Supports(product.PricingKey) {
+		return catalog.Product{}, fmt.Errorf("%w: no rate card %q for %q", domain.ErrUnknownVehicleType, product.PricingKey, vehicleType)
+	}
+	return product, nil
 }
 
 // GetTrip retrieves a trip by identifier.
@@ -97,156 +359,368 @@ func (s *Service) GetTrip(ctx context.Context, id uuid.UUID) (domain.Trip, error
 	return s.repo.GetTripByID(ctx, id)
 }
 
-// AcceptTrip allows a driver to accept an assigned trip.
-func (s *Service) AcceptTrip(ctx context.Context, tripID, driverID uuid.UUID) (domain.Trip, error) {
-	trip, err := s.repo.GetTripByID(ctx, tripID)
+// ListTripEvents returns the timeline of a trip, oldest event first.
+func (s *Service) ListTripEvents(ctx context.Context, id uuid.UUID) ([]domain.TripEvent, error) {
+	if _, err := s.repo.GetTripByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListTripEvents(ctx, id)
+}
+
+// VerifyEventLog rebuilds a trip from its events and compares the result with
+// the stored trip, returning ErrEventLogDrift naming the fields that differ.
+func (s *Service) VerifyEventLog(ctx context.Context, id uuid.UUID) error {
+	stored, err := s.repo.GetTripByID(ctx, id)
 	if err != nil {
-		return domain.Trip{}, err
+		return err
+	}
+	events, err := s.repo.ListTripEvents(ctx, id)
+	if err != nil {
+		return err
+	}
+	rebuilt, err := domain.Rebuild(events)
+	if err != nil {
+		return fmt.Errorf("rebuild trip %s: %w", id, err)
 	}
+	diff, err := domain.DiffTrips(stored, rebuilt)
+	if err != nil {
+		return err
+	}
+	if len(diff) > 0 {
+		return fmt.Errorf("%w: trip %s fields %v", domain.ErrEventLogDrift, id, diff)
+	}
+	return nil
+}
+
+// StateMachine exposes the lifecycle the service enforces.
+func (s *Service) StateMachine() *domain.StateMachine {
+	return s.machine
+}
+
+// EventSchemas lists the JSON Schemas of all trip event payloads.
+func (s *Service) EventSchemas() []domain.EventSchema {
+	return domain.EventSchemas()
+}
 
-	if trip.DriverID == nil || *trip.DriverID != driverID {
-		return domain.Trip{}, errors.New("driver not assigned to trip")
+// EventSchema returns the JSON Schema of the payload of eventType.
+func (s *Service) EventSchema(eventType domain.TripEventType) (domain.EventSchema, error) {
+	for _, schema := range domain.EventSchemas() {
+		if schema.Type == eventType {
+			return schema, nil
+		}
 	}
+	return domain.EventSchema{}, fmt.Errorf("%w: %s", domain.ErrUnknownEventType, eventType)
+}
 
-	switch trip.Status {
-	case domain.StatusDriverAssigned:
-		now := s.clock.Now()
-		trip.Status = domain.StatusDriverAccepted
+// AcceptTrip lets the assigned driver, or an admin on their behalf, accept
+// the trip. The caller is taken from the claims in ctx.
+func (s *Service) AcceptTrip(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandAccept, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
 		trip.AcceptedAt = &now
-	default:
-		return domain.Trip{}, domain.ErrInvalidTransition
-	}
+		trip.AcceptDeadline = nil
+		return domain.DriverAcceptedPayload{DriverID: *trip.DriverID}, nil
+	})
+}
 
-	updated, err := s.repo.UpdateTrip(ctx, trip)
-	if err != nil {
-		return domain.Trip{}, err
-	}
+// DriverEnRoute records that the driver has set off towards the pickup point.
+// Only the assigned driver or an admin may report it.
+func (s *Service) DriverEnRoute(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandDepart, nil)
+}
 
-	_ = s.events.Publish(ctx, domain.TripEvent{
-		TripID:  updated.ID,
-		Type:    domain.EventDriverAccepted,
-		Payload: map[string]any{"driver_id": driverID.String()},
+// DriverArrived records that the driver is waiting at the pickup point and
+// starts the rider's free waiting window. Only the assigned driver or an
+// admin may report it.
+func (s *Service) DriverArrived(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandArrive, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		trip.ArrivedAt = &now
+		return nil, nil
 	})
+}
 
-	return updated, nil
+// RiderNoShow lets the driver cancel once the free waiting window has elapsed
+// without the rider showing up. The rider is charged the no-show fee. Only the
+// assigned driver or an admin may record it.
+func (s *Service) RiderNoShow(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandRiderNoShow, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		by := domain.StatusCancelledDriver
+		trip.CancelledAt = &now
+		trip.CancelledBy = &by
+		trip.CancelReason = domain.ReasonRiderNoShow
+		trip.CancellationFeeCents = *s.config.NoShowFeeCents
+		return domain.TripCancelledPayload{
+			Status:   by,
+			Reason:   domain.ReasonRiderNoShow,
+			FeeCents: trip.CancellationFeeCents,
+		}, nil
+	})
 }
 
-// CancelTrip handles rider initiated cancellations prior to start.
-func (s *Service) CancelTrip(ctx context.Context, tripID uuid.UUID, actor domain.TripStatus) (domain.Trip, error) {
+// CancelTrip handles rider or driver initiated cancellations prior to start.
+// The caller, taken from the claims in ctx, must be the trip's rider or
+// assigned driver and cancels as that party; admins cancel for the party
+// whose reason they give, the rider by default. reason must be one of
+// domain.CancellationReasons(actor); an empty reason defaults to the actor's
+// catch-all. The vehicle type's cancellation policy decides whether the
+// rider pays a fee or the driver a penalty.
+func (s *Service) CancelTrip(ctx context.Context, tripID uuid.UUID, reason domain.CancellationReason) (domain.Trip, error) {
 	trip, err := s.repo.GetTripByID(ctx, tripID)
 	if err != nil {
 		return domain.Trip{}, err
 	}
-
-	switch trip.Status {
-	case domain.StatusRequested, domain.StatusDriverAssigned, domain.StatusDriverAccepted, domain.StatusPickupEnRoute:
-		now := s.clock.Now()
-		trip.Status = actor
+	actor, err := s.cancellingParty(ctx, trip, reason)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	cmd := cancelCommand(actor)
+	reasons := domain.CancellationReasons(actor)
+	if reason == "" {
+		reason = reasons[0]
+	}
+	if !slices.Contains(reasons, reason) {
+		return domain.Trip{}, fmt.Errorf("%w: %q", domain.ErrInvalidCancelReason, reason)
+	}
+	cancelled, err := s.transition(ctx, trip, cmd, domain.Input{}, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		charge := s.cancelling.Decide(*trip, actor, reason, now)
 		trip.CancelledAt = &now
 		trip.CancelledBy = &actor
-	default:
-		return domain.Trip{}, domain.ErrInvalidTransition
-	}
-
-	updated, err := s.repo.UpdateTrip(ctx, trip)
+		trip.CancelReason = reason
+		trip.CancellationFeeCents = charge.FeeCents
+		trip.DriverPenaltyCents = charge.PenaltyCents
+		return domain.TripCancelledPayload{
+			Status:       actor,
+			Reason:       reason,
+			FeeCents:     charge.FeeCents,
+			PenaltyCents: charge.PenaltyCents,
+		}, nil
+	})
 	if err != nil {
 		return domain.Trip{}, err
 	}
+	if cancelled.DriverID != nil {
+		s.releaseSeats(ctx, *cancelled.DriverID, cancelled)
+	}
+	return cancelled, nil
+}
 
-	_ = s.events.Publish(ctx, domain.TripEvent{
-		TripID:  updated.ID,
-		Type:    domain.EventTripCancelled,
-		Payload: map[string]any{"status": string(actor)},
+// StartTrip transitions to IN_PROGRESS when the driver begins the ride. Only
+// the assigned driver or an admin may start it.
+func (s *Service) StartTrip(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandStart, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		trip.StartedAt = &now
+		return nil, nil
 	})
+}
 
-	return updated, nil
+// ReachStop records arrival at the trip's next stop. A driver still waiting
+// at the previous stop implicitly departs it. Only the assigned driver or an
+// admin may report it.
+func (s *Service) ReachStop(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandReachStop, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		// Copy before writing so the loaded trip's stops stay untouched.
+		trip.Stops = slices.Clone(trip.Stops)
+		if current := trip.CurrentStop(); current >= 0 {
+			trip.Stops[current].DepartedAt = &now
+		}
+		next := trip.NextStop()
+		trip.Stops[next].ArrivedAt = &now
+		return domain.StopReachedPayload{StopIndex: next, Point: trip.Stops[next].Point}, nil
+	})
 }
 
-// StartTrip transitions to IN_PROGRESS when the driver begins the ride.
-func (s *Service) StartTrip(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
-	trip, err := s.repo.GetTripByID(ctx, tripID)
-	if err != nil {
-		return domain.Trip{}, err
-	}
+// LeaveStop records departure from the stop the driver is waiting at. Only the
+// assigned driver or an admin may report it.
+func (s *Service) LeaveStop(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandLeaveStop, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		trip.Stops = slices.Clone(trip.Stops)
+		current := trip.CurrentStop()
+		trip.Stops[current].DepartedAt = &now
+		return domain.StopDepartedPayload{StopIndex: current}, nil
+	})
+}
 
-	if trip.Status != domain.StatusPickupEnRoute && trip.Status != domain.StatusDriverAccepted {
-		return domain.Trip{}, domain.ErrInvalidTransition
+// CompleteTrip marks the trip as completed and prices it with the rate card
+// recorded when the trip was requested, using the distance driven, the time
+// spent in progress and the number of stops. The distance is measured from
+// the recorded breadcrumbs, falling back to the straight-line distance of
+// every leg when there are none. Trips booked from a quote are charged the
+// upfront price instead; the breakdown then records the difference to the
+// metered fare. Only the assigned driver or an admin may complete the trip.
+func (s *Service) CompleteTrip(ctx context.Context, tripID uuid.UUID) (domain.Trip, error) {
+	return s.fireAsDriver(ctx, tripID, domain.CommandComplete, func(trip *domain.Trip, now time.Time) (domain.EventPayload, error) {
+		ride := pricing.Ride{
+			VehicleType: trip.VehicleType,
+			DistanceKM:  routeKM(trip.Route()),
+			Stops:       len(trip.Stops),
+			RateCard:    trip.RateCard,
+		}
+		if ride.RateCard == nil {
+			product, err := s.product(trip.VehicleType)
+			if err != nil {
+				return nil, err
+			}
+			ride.VehicleType = product.PricingKey
+		}
+		driven, err := s.drivenRoute(ctx, trip.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(driven.Points) > 1 {
+			trip.DrivenMeters = int64(math.Round(driven.DistanceMeters))
+		}
+		// Breadcrumbs that miss the start or end of the ride would undercharge
+		// it, so those rides are priced on the planned route.
+		if driven.Covers(trip.Pickup, trip.Dropoff) {
+			ride.DistanceKM = driven.DistanceMeters / 1000
+		}
+		if trip.StartedAt != nil {
+			ride.Duration = now.Sub(*trip.StartedAt)
+		}
+		fare, err := s.pricing.Calculate(ride)
+		if err != nil {
+			return nil, fmt.Errorf("price trip %s: %w", trip.ID, err)
+		}
+		if trip.UpfrontPriceCents > 0 {
+			fare = fare.Lock(trip.UpfrontPriceCents)
+		}
+		trip.FinishedAt = &now
+		trip.PriceCents = fare.TotalCents
+		trip.FareBreakdown = fare.Lines
+		return domain.TripFinishedPayload{
+			PriceCents:      fare.TotalCents,
+			DistanceKM:      ride.DistanceKM,
+			DurationSeconds: int64(ride.Duration.Seconds()),
+			FareBreakdown:   fare.Lines,
+			DrivenMeters:    trip.DrivenMeters,
+		}, nil
+	})
+}
+
+func (s *Service) validateStops(stops []domain.GeoPoint) error {
+	if len(stops) > *s.config.MaxStops {
+		return fmt.Errorf("%w: at most %d allowed", domain.ErrTooManyStops, *s.config.MaxStops)
 	}
+	return nil
+}
 
-	now := s.clock.Now()
-	trip.Status = domain.StatusInProgress
-	trip.StartedAt = &now
+// effect applies command specific changes to a trip that has already moved
+// to its new status and returns the payload of the emitted event. A nil
+// payload stands for the zero payload of the event.
+type effect func(trip *domain.Trip, now time.Time) (domain.EventPayload, error)
 
-	updated, err := s.repo.UpdateTrip(ctx, trip)
+// fireAsDriver loads the trip, checks that the caller is its assigned driver
+// or an admin and runs cmd through the state machine.
+func (s *Service) fireAsDriver(ctx context.Context, tripID uuid.UUID, cmd domain.Command, apply effect) (domain.Trip, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
 	if err != nil {
 		return domain.Trip{}, err
 	}
+	if err := s.authorizeDriver(ctx, trip, cmd); err != nil {
+		return domain.Trip{}, err
+	}
+	return s.transition(ctx, trip, cmd, domain.Input{DriverID: trip.DriverID}, apply)
+}
 
-	_ = s.events.Publish(ctx, domain.TripEvent{
-		TripID: updated.ID,
-		Type:   domain.EventTripStarted,
-	})
-
-	return updated, nil
+// transition validates cmd against the state machine and persists the
+// resulting trip together with the transition's event.
+func (s *Service) transition(ctx context.Context, trip domain.Trip, cmd domain.Command, in domain.Input, apply effect) (domain.Trip, error) {
+	return s.transitionWith(ctx, trip, cmd, in, apply, nil)
 }
 
-// CompleteTrip marks the trip as completed.
-func (s *Service) CompleteTrip(ctx context.Context, tripID uuid.UUID, priceCents int64) (domain.Trip, error) {
-	trip, err := s.repo.GetTripByID(ctx, tripID)
+// transitionWith is transition with an extra write committed in the same
+// unit of work. write may be nil.
+func (s *Service) transitionWith(ctx context.Context, trip domain.Trip, cmd domain.Command, in domain.Input, apply effect, write func(tx domain.Tx) error) (domain.Trip, error) {
+	now := s.clock.Now()
+	in.Now = now
+	t, err := s.machine.Fire(&trip, cmd, in)
 	if err != nil {
 		return domain.Trip{}, err
 	}
-
-	if trip.Status != domain.StatusInProgress {
-		return domain.Trip{}, domain.ErrInvalidTransition
+	var payload domain.EventPayload
+	if apply != nil {
+		if payload, err = apply(&trip, now); err != nil {
+			return domain.Trip{}, err
+		}
 	}
+	if payload == nil {
+		if payload, err = domain.NewEventPayload(t.Event); err != nil {
+			return domain.Trip{}, err
+		}
+	}
+	return s.updateWith(ctx, trip, write, domain.TripEvent{Type: t.Event, Payload: payload, CreatedAt: now})
+}
 
-	now := s.clock.Now()
-	trip.Status = domain.StatusCompleted
-	trip.FinishedAt = &now
-	trip.PriceCents = priceCents
-
-	updated, err := s.repo.UpdateTrip(ctx, trip)
+// create inserts a new trip and its events in one unit of work.
+func (s *Service) create(ctx context.Context, trip domain.Trip, events ...domain.TripEvent) (domain.Trip, error) {
+	created, err := s.commit(ctx, func(tx domain.Tx) (domain.Trip, error) {
+		return tx.Trips().CreateTrip(ctx, trip)
+	}, events)
 	if err != nil {
-		return domain.Trip{}, err
+		return domain.Trip{}, s.resolveActiveTrip(ctx, err, trip)
 	}
+	return created, nil
+}
 
-	_ = s.events.Publish(ctx, domain.TripEvent{
-		TripID:  updated.ID,
-		Type:    domain.EventTripFinished,
-		Payload: map[string]any{"price_cents": priceCents},
-	})
+// update persists a transition of trip and its events in one unit of work.
+func (s *Service) update(ctx context.Context, trip domain.Trip, events ...domain.TripEvent) (domain.Trip, error) {
+	return s.updateWith(ctx, trip, nil, events...)
+}
 
+// updateWith is update with an extra write committed in the same unit of
+// work. write may be nil.
+func (s *Service) updateWith(ctx context.Context, trip domain.Trip, write func(tx domain.Tx) error, events ...domain.TripEvent) (domain.Trip, error) {
+	updated, err := s.commit(ctx, func(tx domain.Tx) (domain.Trip, error) {
+		if write != nil {
+			if err := write(tx); err != nil {
+				return domain.Trip{}, err
+			}
+		}
+		return tx.Trips().UpdateTrip(ctx, trip)
+	}, events)
+	if err != nil {
+		return domain.Trip{}, s.resolveActiveTrip(ctx, err, trip)
+	}
 	return updated, nil
 }
 
-func encodeCreateTripResponse(resp CreateTripResponse) []byte {
-	return []byte(resp.TripID.String() + ":" + string(resp.Status))
+// record emits events about trip without changing the trip itself.
+func (s *Service) record(ctx context.Context, trip domain.Trip, events ...domain.TripEvent) error {
+	_, err := s.commit(ctx, func(domain.Tx) (domain.Trip, error) {
+		return trip, nil
+	}, events)
+	return err
 }
 
-func decodeCreateTripResponse(b []byte) (CreateTripResponse, error) {
-	parts := string(b)
-	var resp CreateTripResponse
-	if len(parts) == 0 {
-		return resp, errors.New("empty payload")
-	}
-	// simple split without strings to avoid allocations.
-	var idStr string
-	var statusStr string
-	for i := range parts {
-		if parts[i] == ':' {
-			idStr = parts[:i]
-			if i+1 < len(parts) {
-				statusStr = parts[i+1:]
+// commit runs write and then stores events for the trip it returns, all in
+// one unit of work.
+func (s *Service) commit(ctx context.Context, write func(tx domain.Tx) (domain.Trip, error), events []domain.TripEvent) (domain.Trip, error) {
+	var saved domain.Trip
+	err := s.uow.Do(ctx, func(tx domain.Tx) error {
+		var err error
+		saved, err = write(tx)
+		if err != nil {
+			return err
+		}
+		now := s.clock.Now()
+		for _, event := range events {
+			if event.Payload == nil || event.Payload.EventType() != event.Type {
+				return fmt.Errorf("%s event without a matching payload", event.Type)
+			}
+			event.TripID = saved.ID
+			if event.CreatedAt.IsZero() {
+				event.CreatedAt = now
+			}
+			if err := tx.Trips().CreateTripEvent(ctx, event); err != nil {
+				return fmt.Errorf("record %s: %w", event.Type, err)
+			}
+			if err := tx.Outbox().Publish(ctx, event); err != nil {
+				return fmt.Errorf("enqueue %s: %w", event.Type, err)
 			}
-			break
 		}
-	}
-	id, err := uuid.Parse(idStr)
+		return nil
+	})
 	if err != nil {
-		return resp, err
+		return domain.Trip{}, err
 	}
-	resp.TripID = id
-	resp.Status = domain.TripStatus(statusStr)
-	return resp, nil
+	return saved, nil
 }
@@ -2,14 +2,25 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 
+	"github.com/example/ridellite/internal/auth"
+	"github.com/example/ridellite/internal/trip/cancellation"
+	"github.com/example/ridellite/internal/trip/catalog"
 	"github.com/example/ridellite/internal/trip/domain"
 	"github.com/example/ridellite/internal/trip/matching"
+	"github.com/example/ridellite/internal/trip/pricing"
+	"github.com/example/ridellite/internal/trip/quote"
 	"github.com/example/ridellite/internal/trip/repository"
 	"github.com/example/ridellite/internal/trip/service"
 )
@@ -27,63 +38,1619 @@ func (s *stubPublisher) Publish(_ context.Context, event domain.TripEvent) error
 
 func (s stubClock) Now() time.Time { return s.t }
 
+type mutableClock struct{ t time.Time }
+
+func (c *mutableClock) Now() time.Time { return c.t }
+
 func (s *stubMatcher) ReserveDriver(context.Context, domain.Trip) (*uuid.UUID, error) {
 	return s.id, nil
 }
 
+func (s *stubMatcher) ReleaseDriver(context.Context, uuid.UUID) error { return nil }
+
+// actingAs authenticates ctx as the user id in role.
+func actingAs(ctx context.Context, role string, id uuid.UUID) context.Context {
+	return auth.ContextWithClaims(ctx, &auth.Claims{Role: role, RegisteredClaims: jwt.RegisteredClaims{Subject: id.String()}})
+}
+
+// ptr returns a pointer to v for optional Config fields.
+func ptr[T any](v T) *T { return &v }
+
 func TestCreateTripAssignsDriverAndPublishesEvents(t *testing.T) {
 	repo := repository.NewMemoryRepository()
-	idem := repository.NewMemoryIdempotencyRepo()
 	driverID := uuid.New()
 	matcher := &stubMatcher{id: &driverID}
 	publisher := &stubPublisher{}
 	clock := stubClock{t: time.Unix(0, 0).UTC()}
 
-	svc := service.New(repo, publisher, matcher, clock, idem)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, clock)
 	riderID := uuid.New()
-	resp, err := svc.CreateTrip(context.Background(), "key-1", service.CreateTripRequest{
-		RiderID:     riderID,
+	resp, err := svc.CreateTrip(actingAs(context.Background(), auth.RoleRider, riderID), service.CreateTripRequest{
 		Pickup:      domain.GeoPoint{Lat: 35.7, Lng: 51.4},
 		Dropoff:     domain.GeoPoint{Lat: 35.75, Lng: 51.5},
-		VehicleType: "sedan",
+		VehicleType: "economy",
 	})
 	require.NoError(t, err)
-	require.Equal(t, domain.StatusDriverAssigned, resp.Status)
+	require.Equal(t, domain.StatusRequested, resp.Status, "matching runs after the response is built")
 
-	// idempotent re-call returns cached response
-	cached, err := svc.CreateTrip(context.Background(), "key-1", service.CreateTripRequest{RiderID: riderID})
+	trip, err := svc.GetTrip(context.Background(), resp.TripID)
 	require.NoError(t, err)
-	require.Equal(t, resp.TripID, cached.TripID)
+	require.Equal(t, domain.StatusDriverAssigned, trip.Status)
+	require.Equal(t, driverID, *trip.DriverID)
 
 	require.Len(t, publisher.events, 2)
-	require.Equal(t, domain.EventDriverAssigned, publisher.events[0].Type)
-	require.Equal(t, domain.EventTripRequested, publisher.events[1].Type)
+	require.Equal(t, domain.EventTripRequested, publisher.events[0].Type)
+	require.Equal(t, domain.EventDriverAssigned, publisher.events[1].Type)
+	require.Len(t, repo.Events(), 2, "every outbox message has a matching trip_events row")
 }
 
 func TestCancelTripByRider(t *testing.T) {
 	repo := repository.NewMemoryRepository()
 	publisher := &stubPublisher{}
 	clock := stubClock{t: time.Unix(0, 0).UTC()}
-	svc := service.New(repo, publisher, nil, clock, repository.NewMemoryIdempotencyRepo())
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), nil, clock)
 	riderID := uuid.New()
 	trip, err := repo.CreateTrip(context.Background(), domain.Trip{
 		ID:          uuid.New(),
 		RiderID:     riderID,
 		Pickup:      domain.GeoPoint{Lat: 35.7, Lng: 51.4},
 		Dropoff:     domain.GeoPoint{Lat: 35.75, Lng: 51.5},
-		VehicleType: "sedan",
+		VehicleType: "economy",
 		Status:      domain.StatusDriverAssigned,
 		RequestedAt: clock.Now(),
 	})
 	require.NoError(t, err)
 
-	updated, err := svc.CancelTrip(context.Background(), trip.ID, domain.StatusCancelledRider)
+	updated, err := svc.CancelTrip(actingAs(context.Background(), auth.RoleRider, riderID), trip.ID, domain.ReasonRiderChangedPlans)
 	require.NoError(t, err)
 	require.Equal(t, domain.StatusCancelledRider, updated.Status)
 }
 
+func TestOnlyTripPartiesActOnTrips(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	driverID := uuid.New()
+	var audited []service.AuditEntry
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), &stubMatcher{id: &driverID}, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithAuditLog(service.AuditLogFunc(func(_ context.Context, entry service.AuditEntry) {
+			audited = append(audited, entry)
+		})))
+	riderID, strangerID, adminID := uuid.New(), uuid.New(), uuid.New()
+	rider, driver := actingAs(ctx, auth.RoleRider, riderID), actingAs(ctx, auth.RoleDriver, driverID)
+	stranger, admin := actingAs(ctx, auth.RoleDriver, strangerID), actingAs(ctx, auth.RoleAdmin, adminID)
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	id := resp.TripID
+
+	_, err = svc.AcceptTrip(ctx, id)
+	require.ErrorIs(t, err, domain.ErrUnauthenticated)
+	_, err = svc.AcceptTrip(stranger, id)
+	require.ErrorIs(t, err, domain.ErrDriverNotAssigned)
+	_, err = svc.AcceptTrip(rider, id)
+	require.ErrorIs(t, err, domain.ErrDriverNotAssigned)
+	_, err = svc.CancelTrip(stranger, id, "")
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+
+	_, err = svc.AcceptTrip(driver, id)
+	require.NoError(t, err)
+	_, err = svc.DriverEnRoute(driver, id)
+	require.NoError(t, err)
+	_, err = svc.DriverArrived(driver, id)
+	require.NoError(t, err)
+	_, err = svc.StartTrip(stranger, id)
+	require.ErrorIs(t, err, domain.ErrDriverNotAssigned)
+	_, err = svc.StartTrip(admin, id)
+	require.NoError(t, err)
+	_, err = svc.CompleteTrip(rider, id)
+	require.ErrorIs(t, err, domain.ErrDriverNotAssigned)
+	trip, err := svc.CompleteTrip(driver, id)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCompleted, trip.Status)
+
+	// Admins cancel for the party whose reason they give.
+	resp, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	trip, err = svc.CancelTrip(admin, resp.TripID, domain.ReasonDriverVehicleIssue)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCancelledDriver, trip.Status)
+
+	var decisions []service.AuditDecision
+	for _, entry := range audited {
+		decisions = append(decisions, entry.Decision)
+	}
+	require.Equal(t, []service.AuditDecision{
+		service.AuditDenied, service.AuditDenied, service.AuditDenied, service.AuditDenied,
+		service.AuditDenied, service.AuditOverride, service.AuditDenied, service.AuditOverride,
+	}, decisions)
+	require.Equal(t, service.AuditEntry{
+		Decision: service.AuditDenied,
+		TripID:   id,
+		Command:  domain.CommandAccept,
+		UserID:   strangerID.String(),
+		Role:     auth.RoleDriver,
+		Reason:   domain.ErrDriverNotAssigned.Error(),
+		At:       time.Unix(0, 0).UTC(),
+	}, audited[1])
+	require.Equal(t, domain.CommandCancelByDriver, audited[len(audited)-1].Command)
+}
+
 func TestMatcherNoDriver(t *testing.T) {
 	matcher := matching.NewSimpleMatcher(matching.NewMemorySource(), matching.NewMemoryReservationStore(), 3)
 	_, err := matcher.ReserveDriver(context.Background(), domain.Trip{Pickup: domain.GeoPoint{}, VehicleType: "sedan"})
 	require.Error(t, err)
 }
+
+func TestRiderNoShowAfterFreeWaitingWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), nil, clock, service.WithConfig(service.Config{
+		FreeWaitingWindow: 5 * time.Minute,
+		NoShowFeeCents:    ptr(int64(700)),
+	}))
+	driverID := uuid.New()
+	trip, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:          uuid.New(),
+		RiderID:     uuid.New(),
+		DriverID:    &driverID,
+		Status:      domain.StatusDriverAccepted,
+		RequestedAt: clock.Now(),
+	})
+	require.NoError(t, err)
+
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	arrived, err := svc.DriverArrived(driver, trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusArrived, arrived.Status)
+	require.Equal(t, clock.Now(), *arrived.ArrivedAt)
+
+	clock.t = clock.t.Add(4 * time.Minute)
+	_, err = svc.RiderNoShow(driver, trip.ID)
+	require.ErrorIs(t, err, domain.ErrWaitingWindowOpen)
+
+	clock.t = clock.t.Add(time.Minute)
+	cancelled, err := svc.RiderNoShow(driver, trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCancelledDriver, cancelled.Status)
+	require.Equal(t, domain.ReasonRiderNoShow, cancelled.CancelReason)
+	require.Equal(t, int64(700), cancelled.CancellationFeeCents)
+
+	require.Len(t, publisher.events, 2)
+	require.Equal(t, domain.EventDriverArrived, publisher.events[0].Type)
+	require.Equal(t, domain.EventTripCancelled, publisher.events[1].Type)
+	require.Equal(t, int64(700), publisher.events[1].Payload.(domain.TripCancelledPayload).FeeCents)
+}
+
+func TestZeroConfigValuesAreKept(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := stubClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock, service.WithConfig(service.Config{
+		FreeWaitingWindow: time.Minute,
+		NoShowFeeCents:    ptr(int64(0)),
+		MaxStops:          ptr(0),
+	}))
+
+	_, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: catalog.Economy, Stops: []domain.GeoPoint{{Lat: 1, Lng: 1}}})
+	require.ErrorIs(t, err, domain.ErrTooManyStops)
+
+	driverID := uuid.New()
+	arrivedAt := clock.Now().Add(-time.Minute)
+	trip, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:          uuid.New(),
+		RiderID:     uuid.New(),
+		DriverID:    &driverID,
+		Status:      domain.StatusArrived,
+		RequestedAt: arrivedAt,
+		ArrivedAt:   &arrivedAt,
+	})
+	require.NoError(t, err)
+	cancelled, err := svc.RiderNoShow(actingAs(ctx, auth.RoleDriver, driverID), trip.ID)
+	require.NoError(t, err)
+	require.Zero(t, cancelled.CancellationFeeCents)
+}
+
+func TestDeclineAndTimeoutRedispatchToRemainingDrivers(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	source := matching.NewMemorySource()
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{first, second, third} {
+		source.UpsertDriver(ctx, id, "economy")
+	}
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, clock, service.WithConfig(service.Config{
+		AcceptTimeout: 10 * time.Second,
+	}))
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	trip, err := svc.GetTrip(ctx, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, first, *trip.DriverID)
+	require.Equal(t, clock.Now().Add(10*time.Second), *trip.AcceptDeadline)
+
+	trip, err = svc.DeclineTrip(actingAs(ctx, auth.RoleDriver, first), trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusRequested, trip.Status)
+	trip, err = svc.GetTrip(ctx, trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusDriverAssigned, trip.Status)
+	require.Equal(t, second, *trip.DriverID)
+
+	clock.t = clock.t.Add(9 * time.Second)
+	expired, err := svc.ExpireAssignments(ctx)
+	require.NoError(t, err)
+	require.Zero(t, expired)
+
+	clock.t = clock.t.Add(time.Second)
+	expired, err = svc.ExpireAssignments(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+
+	trip, err = svc.GetTrip(ctx, trip.ID)
+	require.NoError(t, err)
+	require.Equal(t, third, *trip.DriverID)
+	require.Equal(t, []uuid.UUID{first, second}, trip.DeclinedDrivers)
+
+	var types []domain.TripEventType
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []domain.TripEventType{
+		domain.EventTripRequested,
+		domain.EventDriverAssigned,
+		domain.EventDriverDeclined,
+		domain.EventDriverAssigned,
+		domain.EventAssignmentExpired,
+		domain.EventDriverAssigned,
+	}, types)
+}
+
+// failingDispatcher fails to dispatch the trips in fail and records the rest.
+type failingDispatcher struct {
+	fail       map[uuid.UUID]bool
+	dispatched []uuid.UUID
+}
+
+var errDispatch = errors.New("dispatch failed")
+
+func (d *failingDispatcher) Dispatch(_ context.Context, tripID uuid.UUID) error {
+	if d.fail[tripID] {
+		return errDispatch
+	}
+	d.dispatched = append(d.dispatched, tripID)
+	return nil
+}
+
+func TestExpireAssignmentsContinuesPastFailingTrips(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := stubClock{t: time.Unix(60, 0).UTC()}
+	deadline := time.Unix(0, 0).UTC()
+	var ids []uuid.UUID
+	for range 2 {
+		driverID := uuid.New()
+		trip, err := repo.CreateTrip(ctx, domain.Trip{
+			ID:             uuid.New(),
+			RiderID:        uuid.New(),
+			DriverID:       &driverID,
+			AcceptDeadline: &deadline,
+			Status:         domain.StatusDriverAssigned,
+			VehicleType:    "economy",
+			RequestedAt:    deadline,
+		})
+		require.NoError(t, err)
+		ids = append(ids, trip.ID)
+	}
+	dispatcher := &failingDispatcher{fail: map[uuid.UUID]bool{ids[0]: true}}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock, service.WithDispatcher(dispatcher))
+
+	expired, err := svc.ExpireAssignments(ctx)
+	require.ErrorIs(t, err, errDispatch)
+	require.Equal(t, 2, expired)
+	require.Equal(t, []uuid.UUID{ids[1]}, dispatcher.dispatched)
+
+	err = service.RunPeriodically(ctx, 0, func(context.Context) error { return nil }, nil)
+	require.Error(t, err, "a zero interval would make the ticker panic")
+}
+
+func TestDeclineSucceedsWhenDispatchFails(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	driverID := uuid.New()
+	deadline := time.Unix(60, 0).UTC()
+	trip, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:             uuid.New(),
+		RiderID:        uuid.New(),
+		DriverID:       &driverID,
+		AcceptDeadline: &deadline,
+		Status:         domain.StatusDriverAssigned,
+		VehicleType:    "economy",
+		RequestedAt:    time.Unix(0, 0).UTC(),
+	})
+	require.NoError(t, err)
+	dispatcher := &failingDispatcher{fail: map[uuid.UUID]bool{trip.ID: true}}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithDispatcher(dispatcher))
+
+	declined, err := svc.DeclineTrip(actingAs(ctx, auth.RoleDriver, driverID), trip.ID)
+	require.NoError(t, err, "the decline is committed; the sweep dispatches the trip later")
+	require.Equal(t, domain.StatusRequested, declined.Status)
+	require.Nil(t, declined.DriverID)
+
+	delete(dispatcher.fail, trip.ID)
+	dispatched, err := svc.RedispatchPendingTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, dispatched)
+	require.Equal(t, []uuid.UUID{trip.ID}, dispatcher.dispatched)
+}
+
+func TestRedispatchContinuesPastFailingTrips(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	var ids []uuid.UUID
+	for range 2 {
+		trip, err := repo.CreateTrip(ctx, domain.Trip{
+			ID:          uuid.New(),
+			RiderID:     uuid.New(),
+			Status:      domain.StatusRequested,
+			VehicleType: "economy",
+			RequestedAt: time.Unix(0, 0).UTC(),
+		})
+		require.NoError(t, err)
+		ids = append(ids, trip.ID)
+	}
+	dispatcher := &failingDispatcher{fail: map[uuid.UUID]bool{ids[0]: true}}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, stubClock{t: time.Unix(60, 0).UTC()},
+		service.WithDispatcher(dispatcher))
+
+	dispatched, err := svc.RedispatchPendingTrips(ctx)
+	require.ErrorIs(t, err, errDispatch)
+	require.Equal(t, 1, dispatched)
+	require.Equal(t, []uuid.UUID{ids[1]}, dispatcher.dispatched)
+}
+
+func TestRetriedMatchingRecordsNoDriverFoundOncePerDecline(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	source := matching.NewMemorySource()
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, stubClock{t: time.Unix(0, 0).UTC()})
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	for range 3 {
+		_, err = svc.RedispatchPendingTrips(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, countEvents(t, svc, resp.TripID, domain.EventNoDriverFound), "retries do not repeat the event")
+
+	driverID := uuid.New()
+	source.UpsertDriver(ctx, driverID, "economy")
+	_, err = svc.RedispatchPendingTrips(ctx)
+	require.NoError(t, err)
+	_, err = svc.DeclineTrip(actingAs(ctx, auth.RoleDriver, driverID), resp.TripID)
+	require.NoError(t, err)
+	_, err = svc.RedispatchPendingTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, countEvents(t, svc, resp.TripID, domain.EventNoDriverFound), "a decline starts a new round")
+}
+
+func countEvents(t *testing.T, svc *service.Service, tripID uuid.UUID, eventType domain.TripEventType) int {
+	t.Helper()
+	events, err := svc.ListTripEvents(context.Background(), tripID)
+	require.NoError(t, err)
+	n := 0
+	for _, event := range events {
+		if event.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUnmatchedTripsEndAsNoDriverFound(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	matcher := matching.NewSimpleMatcher(matching.NewMemorySource(), matching.NewMemoryReservationStore(), 3)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, clock, service.WithConfig(service.Config{
+		MatchTimeout: 2 * time.Minute,
+	}))
+	pickup := domain.GeoPoint{Lat: 35.7, Lng: 51.4}
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{Pickup: pickup, VehicleType: "economy"})
+	require.NoError(t, err)
+
+	clock.t = clock.t.Add(2*time.Minute - time.Second)
+	expired, err := svc.ExpireUnmatchedTrips(ctx)
+	require.NoError(t, err)
+	require.Zero(t, expired)
+
+	clock.t = clock.t.Add(time.Second)
+	before := unmatchedCount(t, "tnke1")
+	expired, err = svc.ExpireUnmatchedTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+	require.Equal(t, before+1, unmatchedCount(t, "tnke1"), "expiries are counted per pickup area")
+
+	trip, err := svc.GetTrip(ctx, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusNoDriverFound, trip.Status)
+	require.False(t, trip.Active(), "the rider can request again")
+
+	last := publisher.events[len(publisher.events)-1]
+	require.Equal(t, domain.EventTripExpired, last.Type)
+	require.Equal(t, int64(120), last.Payload.(domain.TripExpiredPayload).WaitedSeconds)
+
+	events, err := svc.ListTripEvents(ctx, trip.ID)
+	require.NoError(t, err)
+	rebuilt, err := domain.Rebuild(events)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusNoDriverFound, rebuilt.Status)
+
+	_, err = svc.CancelTrip(actingAs(ctx, auth.RoleRider, trip.RiderID), trip.ID, domain.ReasonRiderChangedPlans)
+	require.ErrorIs(t, err, domain.ErrInvalidTransition)
+}
+
+func TestScheduledRidesDoNotStarveExpiry(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := stubClock{t: time.Unix(0, 0).UTC().Add(24 * time.Hour)}
+	booked := clock.t.Add(-12 * time.Hour)
+	pickupAt := clock.t.Add(time.Hour)
+	// A full batch of rides booked hours ago whose matching has not started.
+	for range 100 {
+		_, err := repo.CreateTrip(ctx, domain.Trip{
+			ID:          uuid.New(),
+			RiderID:     uuid.New(),
+			Status:      domain.StatusRequested,
+			VehicleType: "economy",
+			RequestedAt: booked,
+			PickupAt:    &pickupAt,
+		})
+		require.NoError(t, err)
+	}
+	onDemand, err := repo.CreateTrip(ctx, domain.Trip{
+		ID:          uuid.New(),
+		RiderID:     uuid.New(),
+		Status:      domain.StatusRequested,
+		VehicleType: "economy",
+		RequestedAt: clock.t.Add(-5 * time.Minute),
+	})
+	require.NoError(t, err)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock, service.WithConfig(service.Config{
+		MatchTimeout:     2 * time.Minute,
+		ScheduleLeadTime: 15 * time.Minute,
+	}))
+
+	expired, err := svc.ExpireUnmatchedTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+	trip, err := svc.GetTrip(ctx, onDemand.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusNoDriverFound, trip.Status)
+}
+
+// unmatchedCount reads the NO_DRIVER_FOUND counter of an economy pickup area.
+func unmatchedCount(t *testing.T, area string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "trips_no_driver_found_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["area"] == area && labels["vehicle_type"] == "economy" {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestQueueDispatcherMatchesInBackground(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repository.NewMemoryRepository()
+	publisher := &syncPublisher{}
+	source := matching.NewMemorySource()
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3)
+	dispatcher := service.NewQueueDispatcher(8)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithDispatcher(dispatcher))
+	go func() { _ = dispatcher.Run(ctx, 2, svc.MatchTrip, func(err error) { t.Error(err) }) }()
+
+	unmatched, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusRequested, unmatched.Status)
+	require.Eventually(t, func() bool {
+		return publisher.has(unmatched.TripID, domain.EventNoDriverFound)
+	}, time.Second, 5*time.Millisecond)
+	trip, err := svc.GetTrip(ctx, unmatched.TripID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusRequested, trip.Status)
+
+	driverID := uuid.New()
+	source.UpsertDriver(ctx, driverID, "economy")
+	matched, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		trip, err := svc.GetTrip(ctx, matched.TripID)
+		return err == nil && trip.Status == domain.StatusDriverAssigned && *trip.DriverID == driverID
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestFullDispatchQueueLeavesMatchingPending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repository.NewMemoryRepository()
+	publisher := &syncPublisher{}
+	source := matching.NewMemorySource()
+	first, second := uuid.New(), uuid.New()
+	source.UpsertDriver(ctx, first, "economy")
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3)
+	dispatcher := service.NewQueueDispatcher(1)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), matcher, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithDispatcher(dispatcher))
+
+	queued, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	deferred, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err, "a full queue does not fail the request")
+	require.Equal(t, domain.StatusRequested, deferred.Status)
+	require.ErrorIs(t, dispatcher.Dispatch(ctx, deferred.TripID), service.ErrDispatchQueueFull)
+
+	go func() { _ = dispatcher.Run(ctx, 1, svc.MatchTrip, func(err error) { t.Error(err) }) }()
+	require.Eventually(t, func() bool {
+		trip, err := svc.GetTrip(ctx, queued.TripID)
+		return err == nil && trip.Status == domain.StatusDriverAssigned
+	}, time.Second, 5*time.Millisecond)
+
+	source.UpsertDriver(ctx, second, "economy")
+	dispatched, err := svc.RedispatchPendingTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, dispatched)
+	require.Eventually(t, func() bool {
+		trip, err := svc.GetTrip(ctx, deferred.TripID)
+		return err == nil && trip.Status == domain.StatusDriverAssigned && *trip.DriverID == second
+	}, time.Second, 5*time.Millisecond)
+}
+
+type syncPublisher struct {
+	mu     sync.Mutex
+	events []domain.TripEvent
+}
+
+func (s *syncPublisher) Publish(_ context.Context, event domain.TripEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *syncPublisher) has(tripID uuid.UUID, eventType domain.TripEventType) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.events {
+		if event.TripID == tripID && event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type fixedEstimator time.Duration
+
+func (e fixedEstimator) EstimateTripETA(context.Context, domain.GeoPoint, domain.GeoPoint, ...domain.GeoPoint) time.Duration {
+	return time.Duration(e)
+}
+
+func TestQuotedTripIsChargedUpfrontPrice(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	signer := quote.NewSigner([]byte("secret"), time.Minute, clock.Now)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), &stubMatcher{id: &driverID}, clock,
+		service.WithQuotes(signer, fixedEstimator(10*time.Minute)))
+
+	rider := actingAs(ctx, auth.RoleRider, uuid.New())
+	req := service.CreateTripRequest{
+		Pickup:      domain.GeoPoint{Lat: 52.52, Lng: 13.40},
+		Dropoff:     domain.GeoPoint{Lat: 52.50, Lng: 13.45},
+		VehicleType: "economy",
+	}
+	_, err := svc.Quote(ctx, service.QuoteRequest{Pickup: req.Pickup, Dropoff: req.Dropoff, VehicleType: req.VehicleType})
+	require.ErrorIs(t, err, domain.ErrUnauthenticated)
+	quoted, err := svc.Quote(rider, service.QuoteRequest{Pickup: req.Pickup, Dropoff: req.Dropoff, VehicleType: req.VehicleType})
+	require.NoError(t, err)
+	require.LessOrEqual(t, quoted.PriceLowCents, quoted.PriceCents)
+	require.GreaterOrEqual(t, quoted.PriceHighCents, quoted.PriceCents)
+
+	other := req
+	other.Dropoff = domain.GeoPoint{Lat: 48.85, Lng: 2.35}
+	other.QuoteToken = quoted.Token
+	_, err = svc.CreateTrip(rider, other)
+	require.ErrorIs(t, err, domain.ErrQuoteInvalid)
+
+	req.QuoteToken = quoted.Token
+	_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), req)
+	require.ErrorIs(t, err, domain.ErrQuoteInvalid, "the quote was issued to another rider")
+	resp, err := svc.CreateTrip(rider, req)
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){
+		svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip,
+	} {
+		_, err := step(driver, resp.TripID)
+		require.NoError(t, err)
+	}
+
+	// A slow ride still costs what was quoted.
+	clock.t = clock.t.Add(45 * time.Minute)
+	completed, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, quoted.QuoteID, *completed.QuoteID)
+	require.Equal(t, quoted.PriceCents, completed.PriceCents)
+	last := completed.FareBreakdown[len(completed.FareBreakdown)-1]
+	require.Equal(t, pricing.LineUpfrontAdjustment, last.Code)
+	require.Negative(t, last.AmountCents)
+}
+
+func TestMeteredTripIsPricedFromTheRateCard(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock)
+
+	pickup, dropoff := domain.GeoPoint{Lat: 52.50, Lng: 13.40}, domain.GeoPoint{Lat: 52.59, Lng: 13.40}
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{Pickup: pickup, Dropoff: dropoff, VehicleType: catalog.Economy})
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){
+		svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip,
+	} {
+		_, err := step(driver, resp.TripID)
+		require.NoError(t, err)
+	}
+
+	clock.t = clock.t.Add(20 * time.Minute)
+	completed, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+
+	card := pricing.DefaultRateCards()[catalog.Economy]
+	km := domain.RouteMeters(pickup, dropoff) / 1000
+	want := []domain.FareLine{
+		{Code: pricing.LineBase, AmountCents: card.BaseFareCents},
+		{Code: pricing.LineDistance, AmountCents: int64(math.Round(km * float64(card.PerKMCents)))},
+		{Code: pricing.LineTime, AmountCents: 20 * card.PerMinuteCents},
+	}
+	require.Equal(t, want, completed.FareBreakdown)
+	require.Equal(t, want[0].AmountCents+want[1].AmountCents+want[2].AmountCents, completed.PriceCents)
+	require.Nil(t, completed.QuoteID)
+
+	finished := publisher.events[len(publisher.events)-1].Payload.(domain.TripFinishedPayload)
+	require.Equal(t, completed.PriceCents, finished.PriceCents)
+	require.Equal(t, want, finished.FareBreakdown)
+	require.InDelta(t, km, finished.DistanceKM, 1e-9)
+	require.EqualValues(t, 20*60, finished.DurationSeconds)
+}
+
+func TestScheduledTripRemindsThenReleasesAtLeadTime(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithConfig(service.Config{ScheduleLeadTime: 15 * time.Minute, ReminderOffsets: []time.Duration{time.Hour}}))
+
+	tooSoon := clock.Now().Add(10 * time.Minute)
+	_, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy", PickupAt: &tooSoon})
+	require.ErrorIs(t, err, domain.ErrInvalidPickupTime)
+
+	pickupAt := clock.Now().Add(2 * time.Hour)
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy", PickupAt: &pickupAt})
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusScheduled, resp.Status)
+
+	clock.t = clock.t.Add(30 * time.Minute)
+	released, err := svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	require.Zero(t, released)
+
+	clock.t = clock.t.Add(35 * time.Minute)
+	_, err = svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	_, err = svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+
+	clock.t = pickupAt.Add(-15 * time.Minute)
+	released, err = svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, released)
+
+	trip, err := svc.GetTrip(ctx, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusDriverAssigned, trip.Status)
+
+	var types []domain.TripEventType
+	for _, event := range publisher.events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []domain.TripEventType{
+		domain.EventTripScheduled,
+		domain.EventScheduleReminder,
+		domain.EventTripReleased,
+		domain.EventDriverAssigned,
+	}, types)
+}
+
+func TestProcessScheduledTripsContinuesPastFailingTrips(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	dispatcher := &failingDispatcher{fail: make(map[uuid.UUID]bool)}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock,
+		service.WithDispatcher(dispatcher), service.WithConfig(service.Config{ScheduleLeadTime: 15 * time.Minute}))
+
+	pickupAt := clock.Now().Add(time.Hour)
+	var ids []uuid.UUID
+	for range 2 {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy", PickupAt: &pickupAt})
+		require.NoError(t, err)
+		ids = append(ids, resp.TripID)
+	}
+	dispatcher.fail[ids[0]] = true
+
+	clock.t = pickupAt.Add(-15 * time.Minute)
+	released, err := svc.ProcessScheduledTrips(ctx)
+	require.ErrorIs(t, err, errDispatch)
+	require.Equal(t, 2, released)
+	require.Equal(t, []uuid.UUID{ids[1]}, dispatcher.dispatched)
+}
+
+func TestScheduledTripExpiresWhenNeverReleased(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), nil, clock,
+		service.WithConfig(service.Config{ScheduleLeadTime: 15 * time.Minute, PickupGracePeriod: 30 * time.Minute}))
+
+	rider := actingAs(ctx, auth.RoleRider, uuid.New())
+	pickupAt := clock.Now().Add(time.Hour)
+	scheduled, err := svc.CreateTrip(rider, service.CreateTripRequest{VehicleType: "economy", PickupAt: &pickupAt})
+	require.NoError(t, err)
+	// The rider is still waiting for an earlier ride when the lead window
+	// starts, so the scheduled one cannot be released.
+	_, err = svc.CreateTrip(rider, service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+
+	clock.t = pickupAt.Add(-15 * time.Minute)
+	released, err := svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	require.Zero(t, released)
+	clock.t = pickupAt.Add(30*time.Minute - time.Second)
+	_, err = svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	trip, err := svc.GetTrip(ctx, scheduled.TripID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusScheduled, trip.Status)
+
+	clock.t = clock.t.Add(time.Second)
+	released, err = svc.ProcessScheduledTrips(ctx)
+	require.NoError(t, err)
+	require.Zero(t, released)
+	trip, err = svc.GetTrip(ctx, scheduled.TripID)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusNoDriverFound, trip.Status)
+	last := publisher.events[len(publisher.events)-1]
+	require.Equal(t, domain.EventTripExpired, last.Type)
+	require.EqualValues(t, 45*60, last.Payload.(domain.TripExpiredPayload).WaitedSeconds)
+	require.NoError(t, svc.VerifyEventLog(ctx, trip.ID))
+}
+
+func TestRiderCancelsScheduledTripForFree(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock)
+
+	riderID := uuid.New()
+	pickupAt := clock.Now().Add(3 * time.Hour)
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy", PickupAt: &pickupAt})
+	require.NoError(t, err)
+
+	cancelled, err := svc.CancelTrip(actingAs(ctx, auth.RoleRider, riderID), resp.TripID, domain.ReasonRiderChangedPlans)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusCancelledRider, cancelled.Status)
+	require.Zero(t, cancelled.CancellationFeeCents)
+}
+
+func TestMultiStopTripRecordsStopsAndPricesEveryLeg(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock)
+
+	rider := actingAs(ctx, auth.RoleRider, uuid.New())
+	req := service.CreateTripRequest{
+		Pickup:      domain.GeoPoint{Lat: 52.50, Lng: 13.40},
+		Stops:       []domain.GeoPoint{{Lat: 52.52, Lng: 13.40}, {Lat: 52.52, Lng: 13.43}},
+		Dropoff:     domain.GeoPoint{Lat: 52.50, Lng: 13.43},
+		VehicleType: "economy",
+	}
+	tooMany := req
+	tooMany.Stops = make([]domain.GeoPoint, service.DefaultMaxStops+1)
+	_, err := svc.CreateTrip(rider, tooMany)
+	require.ErrorIs(t, err, domain.ErrTooManyStops)
+
+	resp, err := svc.CreateTrip(rider, req)
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	_, err = svc.AcceptTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	_, err = svc.StartTrip(driver, resp.TripID)
+	require.NoError(t, err)
+
+	_, err = svc.LeaveStop(driver, resp.TripID)
+	require.ErrorIs(t, err, domain.ErrNotAtStop)
+
+	clock.t = clock.t.Add(5 * time.Minute)
+	trip, err := svc.ReachStop(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, 0, trip.CurrentStop())
+
+	// Reaching the next stop departs the one the driver was waiting at.
+	clock.t = clock.t.Add(5 * time.Minute)
+	trip, err = svc.ReachStop(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, clock.Now(), *trip.Stops[0].DepartedAt)
+	require.Equal(t, 1, trip.CurrentStop())
+
+	trip, err = svc.LeaveStop(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, -1, trip.CurrentStop())
+	_, err = svc.ReachStop(driver, resp.TripID)
+	require.ErrorIs(t, err, domain.ErrNoPendingStop)
+
+	completed, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Contains(t, completed.FareBreakdown, domain.FareLine{Code: pricing.LineStops, AmountCents: 2 * pricing.DefaultRateCards()["economy"].PerStopCents})
+	finished := publisher.events[len(publisher.events)-1].Payload.(domain.TripFinishedPayload)
+	require.Greater(t, finished.DistanceKM, domain.HaversineMeters(req.Pickup, req.Dropoff)/1000)
+}
+
+func TestEventLogRebuildsTripAndDetectsDrift(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	first, second := uuid.New(), uuid.New()
+	matcher := &stubMatcher{id: &first}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), matcher, clock)
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+		Pickup:      domain.GeoPoint{Lat: 52.50, Lng: 13.40},
+		Stops:       []domain.GeoPoint{{Lat: 52.51, Lng: 13.41}},
+		Dropoff:     domain.GeoPoint{Lat: 52.52, Lng: 13.42},
+		VehicleType: "economy",
+	})
+	require.NoError(t, err)
+	id := resp.TripID
+
+	matcher.id = &second
+	clock.t = clock.t.Add(time.Minute)
+	_, err = svc.DeclineTrip(actingAs(ctx, auth.RoleDriver, first), id)
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, second)
+	steps := []func() (domain.Trip, error){
+		func() (domain.Trip, error) { return svc.AcceptTrip(driver, id) },
+		func() (domain.Trip, error) { return svc.DriverArrived(driver, id) },
+		func() (domain.Trip, error) { return svc.StartTrip(driver, id) },
+		func() (domain.Trip, error) { return svc.ReachStop(driver, id) },
+		func() (domain.Trip, error) { return svc.LeaveStop(driver, id) },
+		func() (domain.Trip, error) { return svc.CompleteTrip(driver, id) },
+	}
+	for _, step := range steps {
+		clock.t = clock.t.Add(3 * time.Minute)
+		_, err := step()
+		require.NoError(t, err)
+	}
+	require.NoError(t, svc.VerifyEventLog(ctx, id))
+
+	// Events read back from trip_events carry JSON decoded payloads.
+	events, err := svc.ListTripEvents(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, domain.EventTripRequested, events[0].Type)
+	require.Equal(t, domain.EventTripFinished, events[len(events)-1].Type)
+	raw, err := json.Marshal(events)
+	require.NoError(t, err)
+	var decoded []domain.TripEvent
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	rebuilt, err := domain.Rebuild(decoded)
+	require.NoError(t, err)
+	stored, err := svc.GetTrip(ctx, id)
+	require.NoError(t, err)
+	diff, err := domain.DiffTrips(stored, rebuilt)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	// A write that bypasses the service leaves no event behind.
+	stored.PriceCents++
+	_, err = repo.UpdateTrip(ctx, stored)
+	require.NoError(t, err)
+	err = svc.VerifyEventLog(ctx, id)
+	require.ErrorIs(t, err, domain.ErrEventLogDrift)
+	require.ErrorContains(t, err, "PriceCents")
+}
+
+func TestSearchTripsPagesNewestFirstWithStableCursor(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, clock)
+
+	rider, other := uuid.New(), uuid.New()
+	// book leaves the trip cancelled so the rider can book again.
+	book := func(riderID uuid.UUID) uuid.UUID {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+		require.NoError(t, err)
+		_, err = svc.CancelTrip(actingAs(ctx, auth.RoleRider, riderID), resp.TripID, domain.ReasonRiderChangedPlans)
+		require.NoError(t, err)
+		return resp.TripID
+	}
+	var want []uuid.UUID
+	for i := 0; i < 5; i++ {
+		// Two trips share each timestamp so the id breaks ties.
+		clock.t = time.Unix(int64(i/2*60), 0).UTC()
+		want = append(want, book(rider))
+		book(other)
+	}
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, rider), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	want = append(want, resp.TripID)
+
+	filter := domain.TripFilter{RiderID: &rider}
+	admin := actingAs(ctx, auth.RoleAdmin, uuid.New())
+	var got []domain.Trip
+	cursor := ""
+	for {
+		page, err := svc.SearchTrips(admin, service.SearchTripsRequest{Filter: filter, Cursor: cursor, Limit: 2})
+		require.NoError(t, err)
+		got = append(got, page.Trips...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+		// A ride booked while paging must not shift later pages. Scheduled
+		// rides do not count as active, so the rider may book one.
+		clock.t = clock.t.Add(time.Hour)
+		pickupAt := clock.t.Add(time.Hour)
+		_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, rider), service.CreateTripRequest{VehicleType: "economy", PickupAt: &pickupAt})
+		require.NoError(t, err)
+	}
+	require.Len(t, got, 6)
+	var ids []uuid.UUID
+	for i, trip := range got {
+		require.Equal(t, rider, trip.RiderID)
+		if i > 0 {
+			require.False(t, trip.RequestedAt.After(got[i-1].RequestedAt))
+		}
+		ids = append(ids, trip.ID)
+	}
+	require.ElementsMatch(t, want, ids)
+
+	// Riders only see their own trips, whatever they filter on.
+	requested, err := svc.SearchTrips(actingAs(ctx, auth.RoleRider, rider), service.SearchTripsRequest{Filter: domain.TripFilter{
+		Statuses: []domain.TripStatus{domain.StatusRequested},
+	}})
+	require.NoError(t, err)
+	require.Len(t, requested.Trips, 1)
+	require.Equal(t, resp.TripID, requested.Trips[0].ID)
+	require.Empty(t, requested.NextCursor)
+
+	_, err = svc.SearchTrips(actingAs(ctx, auth.RoleRider, other), service.SearchTripsRequest{Filter: filter})
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+	driven, err := svc.SearchTrips(actingAs(ctx, auth.RoleDriver, uuid.New()), service.SearchTripsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, driven.Trips)
+	_, err = svc.SearchTrips(ctx, service.SearchTripsRequest{})
+	require.ErrorIs(t, err, domain.ErrUnauthenticated)
+
+	_, err = svc.SearchTrips(admin, service.SearchTripsRequest{Cursor: "not-a-cursor"})
+	require.ErrorIs(t, err, domain.ErrInvalidCursor)
+}
+
+func TestRiderCannotHoldTwoActiveTripsUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), nil, stubClock{t: time.Unix(0, 0).UTC()})
+
+	riderID := uuid.New()
+	const attempts = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		created   []uuid.UUID
+		conflicts []*domain.ActiveTripError
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				created = append(created, resp.TripID)
+				return
+			}
+			var conflict *domain.ActiveTripError
+			require.ErrorAs(t, err, &conflict)
+			conflicts = append(conflicts, conflict)
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, created, 1)
+	require.Len(t, conflicts, attempts-1)
+	for _, conflict := range conflicts {
+		require.ErrorIs(t, conflict, domain.ErrActiveTrip)
+		require.Equal(t, domain.PartyRider, conflict.Party)
+		require.Equal(t, created[0], conflict.TripID)
+	}
+
+	// Once the trip ends the rider can book again.
+	_, err := svc.CancelTrip(actingAs(ctx, auth.RoleRider, riderID), created[0], domain.ReasonRiderChangedPlans)
+	require.NoError(t, err)
+	_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+}
+
+func TestDriverOnActiveTripIsNotAssignedAgain(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	source := matching.NewMemorySource()
+	busy, idle := uuid.New(), uuid.New()
+	source.UpsertDriver(ctx, busy, "economy")
+	source.UpsertDriver(ctx, idle, "economy")
+	store := matching.NewMemoryReservationStore()
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), matching.NewSimpleMatcher(source, store, 3), stubClock{t: time.Unix(0, 0).UTC()})
+
+	first, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	_, err = svc.AcceptTrip(actingAs(ctx, auth.RoleDriver, busy), first.TripID)
+	require.NoError(t, err)
+	// The reservation TTL ran out while the driver is still on the trip.
+	require.NoError(t, store.Release(ctx, busy))
+
+	// The matcher alone still offers the busy driver; the repository refuses
+	// the assignment and matching moves on.
+	second, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "economy"})
+	require.NoError(t, err)
+	trip, err := svc.GetTrip(ctx, second.TripID)
+	require.NoError(t, err)
+	require.Equal(t, idle, *trip.DriverID)
+	require.Empty(t, trip.DeclinedDrivers)
+
+	// With active trips wired in, the matcher skips drivers on a trip itself,
+	// whatever their reservations say.
+	require.NoError(t, store.Release(ctx, idle))
+	matcher := matching.NewSimpleMatcher(source, store, 3, matching.WithActiveTrips(repo))
+	_, err = matcher.ReserveDriver(ctx, domain.Trip{ID: uuid.New()})
+	require.ErrorIs(t, err, domain.ErrNoDriverAvailable)
+	fresh := uuid.New()
+	source.UpsertDriver(ctx, fresh, "economy")
+	driverID, err := matcher.ReserveDriver(ctx, domain.Trip{ID: uuid.New()})
+	require.NoError(t, err)
+	require.Equal(t, fresh, *driverID)
+}
+
+func TestLateCancellationsChargeRiderOrPenalizeDriver(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	driverID := uuid.New()
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithCancellation(cancellation.NewEngine(map[string]cancellation.Policy{
+			"economy": {RiderGraceSeconds: 120, RiderFeeCents: 500, DriverGraceSeconds: 60, DriverPenaltyCents: 300},
+		})))
+
+	riderID := uuid.New()
+	rider, driver := actingAs(ctx, auth.RoleRider, riderID), actingAs(ctx, auth.RoleDriver, driverID)
+	accepted := func() uuid.UUID {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{VehicleType: "economy"})
+		require.NoError(t, err)
+		_, err = svc.AcceptTrip(driver, resp.TripID)
+		require.NoError(t, err)
+		return resp.TripID
+	}
+
+	tripID := accepted()
+	_, err := svc.CancelTrip(rider, tripID, "no_reason_at_all")
+	require.ErrorIs(t, err, domain.ErrInvalidCancelReason)
+	_, err = svc.CancelTrip(rider, tripID, domain.ReasonDriverVehicleIssue)
+	require.ErrorIs(t, err, domain.ErrInvalidCancelReason)
+
+	clock.t = clock.t.Add(3 * time.Minute)
+	trip, err := svc.CancelTrip(rider, tripID, domain.ReasonRiderChangedPlans)
+	require.NoError(t, err)
+	require.Equal(t, domain.ReasonRiderChangedPlans, trip.CancelReason)
+	require.EqualValues(t, 500, trip.CancellationFeeCents)
+	require.Zero(t, trip.DriverPenaltyCents)
+	last := publisher.events[len(publisher.events)-1]
+	require.Equal(t, domain.EventTripCancelled, last.Type)
+	require.Equal(t, domain.TripCancelledPayload{
+		Status:   domain.StatusCancelledRider,
+		Reason:   domain.ReasonRiderChangedPlans,
+		FeeCents: 500,
+	}, last.Payload)
+
+	tripID = accepted()
+	clock.t = clock.t.Add(30 * time.Second)
+	trip, err = svc.CancelTrip(driver, tripID, "")
+	require.NoError(t, err)
+	require.Equal(t, domain.ReasonDriverOther, trip.CancelReason)
+	require.Zero(t, trip.DriverPenaltyCents)
+
+	tripID = accepted()
+	clock.t = clock.t.Add(time.Minute)
+	trip, err = svc.CancelTrip(driver, tripID, domain.ReasonDriverVehicleIssue)
+	require.NoError(t, err)
+	require.Zero(t, trip.CancellationFeeCents)
+	require.EqualValues(t, 300, trip.DriverPenaltyCents)
+	require.NoError(t, svc.VerifyEventLog(ctx, tripID))
+}
+
+func TestTripsAreMatchedToDriversOfTheirProduct(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	source := matching.NewMemorySource()
+	xl, economy := uuid.New(), uuid.New()
+	source.UpsertDriver(ctx, xl, catalog.XL)
+	source.UpsertDriver(ctx, economy, catalog.Economy)
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3)
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), matcher, stubClock{t: time.Unix(0, 0).UTC()})
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: catalog.Economy})
+	require.NoError(t, err)
+	trip, err := svc.GetTrip(ctx, resp.TripID)
+	require.NoError(t, err)
+	require.Equal(t, economy, *trip.DriverID)
+
+	// The only comfort driver would be the XL one, which is not offered.
+	resp, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: catalog.Comfort})
+	require.NoError(t, err)
+	trip, err = svc.GetTrip(ctx, resp.TripID)
+	require.NoError(t, err)
+	require.Nil(t, trip.DriverID)
+
+	_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: "spaceship"})
+	require.ErrorIs(t, err, domain.ErrUnknownVehicleType)
+}
+
+func TestTripsArePricedWithTheirRequestedRateCard(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	uow := repository.NewMemoryUnitOfWork(repo, &stubPublisher{})
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	driverID := uuid.New()
+	svc := service.New(repo, uow, &stubMatcher{id: &driverID}, clock)
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+		Pickup: domain.GeoPoint{Lat: 52.50, Lng: 13.40}, Dropoff: domain.GeoPoint{Lat: 52.52, Lng: 13.40}, VehicleType: catalog.Comfort,
+	})
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip} {
+		_, err = step(driver, resp.TripID)
+		require.NoError(t, err)
+	}
+
+	// Comfort is withdrawn while the ride is under way.
+	var products []catalog.Product
+	for _, product := range catalog.DefaultProducts() {
+		if product.Code != catalog.Comfort {
+			products = append(products, product)
+		}
+	}
+	withdrawn, err := catalog.New(products)
+	require.NoError(t, err)
+	cards := pricing.DefaultRateCards()
+	comfort := cards[catalog.Comfort]
+	delete(cards, catalog.Comfort)
+	svc = service.New(repo, uow, &stubMatcher{id: &driverID}, clock,
+		service.WithCatalog(withdrawn), service.WithPricing(pricing.NewEngine(cards)))
+
+	clock.t = clock.t.Add(10 * time.Minute)
+	trip, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	require.Contains(t, trip.FareBreakdown, domain.FareLine{Code: pricing.LineBase, AmountCents: comfort.BaseFareCents})
+	require.Contains(t, trip.FareBreakdown, domain.FareLine{Code: pricing.LineTime, AmountCents: 10 * comfort.PerMinuteCents})
+	require.NoError(t, svc.VerifyEventLog(ctx, trip.ID))
+}
+
+func TestRidersAndDriversRateEachOtherAfterCompletion(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithRatings(repo), service.WithConfig(service.Config{RatingWindow: ptr(time.Hour)}))
+
+	ride := func(riderID uuid.UUID) uuid.UUID {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{
+			Pickup:      domain.GeoPoint{Lat: 52.52, Lng: 13.40},
+			Dropoff:     domain.GeoPoint{Lat: 52.50, Lng: 13.45},
+			VehicleType: "economy",
+		})
+		require.NoError(t, err)
+		for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){
+			svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip, svc.CompleteTrip,
+		} {
+			_, err := step(actingAs(ctx, auth.RoleDriver, driverID), resp.TripID)
+			require.NoError(t, err)
+		}
+		return resp.TripID
+	}
+
+	alice, bob := uuid.New(), uuid.New()
+	first := ride(alice)
+	_, err := svc.RateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), first, service.RateTripRequest{Stars: 5})
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+	_, err = svc.RateTrip(ctx, first, service.RateTripRequest{Stars: 5})
+	require.ErrorIs(t, err, domain.ErrUnauthenticated)
+	_, err = svc.RateTrip(actingAs(ctx, auth.RoleRider, alice), first, service.RateTripRequest{Stars: 6})
+	require.ErrorIs(t, err, domain.ErrInvalidRating)
+
+	rating, err := svc.RateTrip(actingAs(ctx, auth.RoleRider, alice), first, service.RateTripRequest{Stars: 5, Tags: []string{"clean_car"}, Comment: "great"})
+	require.NoError(t, err)
+	require.Equal(t, driverID, rating.RateeID)
+	require.Equal(t, domain.PartyDriver, rating.RateeRole)
+	_, err = svc.RateTrip(actingAs(ctx, auth.RoleRider, alice), first, service.RateTripRequest{Stars: 1})
+	require.ErrorIs(t, err, domain.ErrAlreadyRated)
+	_, err = svc.RateTrip(actingAs(ctx, auth.RoleDriver, driverID), first, service.RateTripRequest{Stars: 4})
+	require.NoError(t, err)
+
+	last := publisher.events[len(publisher.events)-1]
+	require.Equal(t, domain.EventTripRated, last.Type)
+	require.Equal(t, domain.PartyRider, last.Payload.(domain.TripRatedPayload).RateeRole)
+	raw, err := json.Marshal(publisher.events[len(publisher.events)-2].Payload)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "comment")
+	require.NoError(t, svc.VerifyEventLog(ctx, first))
+
+	ratings, err := svc.ListTripRatings(actingAs(ctx, auth.RoleRider, alice), first)
+	require.NoError(t, err)
+	require.Len(t, ratings, 2)
+	_, err = svc.ListTripRatings(actingAs(ctx, auth.RoleRider, bob), first)
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+
+	second := ride(bob)
+	_, err = svc.RateTrip(actingAs(ctx, auth.RoleRider, bob), second, service.RateTripRequest{Stars: 2})
+	require.NoError(t, err)
+	_, err = svc.RatingSummaries(actingAs(ctx, auth.RoleRider, bob), driverID)
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+	summaries, err := svc.RatingSummaries(actingAs(ctx, auth.RoleDriver, driverID), driverID)
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	require.Equal(t, domain.PartyDriver, summaries[0].Role)
+	require.EqualValues(t, 2, summaries[0].Count)
+	require.InDelta(t, 3.5, summaries[0].Average, 1e-9)
+	require.InDelta(t, 3.5, summaries[0].RollingAverage, 1e-9)
+
+	// The driver waited too long to rate Bob.
+	clock.t = clock.t.Add(2 * time.Hour)
+	_, err = svc.RateTrip(actingAs(ctx, auth.RoleDriver, driverID), second, service.RateTripRequest{Stars: 5})
+	require.ErrorIs(t, err, domain.ErrRatingWindowClosed)
+	summaries, err = svc.RatingSummaries(actingAs(ctx, auth.RoleAdmin, uuid.New()), bob)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+}
+
+func TestTipsAndRefundsAdjustCompletedFare(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	driverID := uuid.New()
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithFareAdjustments(repo), service.WithConfig(service.Config{TipWindow: ptr(time.Hour)}))
+
+	riderID, agentID := uuid.New(), uuid.New()
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, riderID), service.CreateTripRequest{
+		Pickup:      domain.GeoPoint{Lat: 52.52, Lng: 13.40},
+		Dropoff:     domain.GeoPoint{Lat: 52.50, Lng: 13.45},
+		VehicleType: "economy",
+	})
+	require.NoError(t, err)
+	id := resp.TripID
+	rider, agent := actingAs(ctx, auth.RoleRider, riderID), actingAs(ctx, auth.RoleAdmin, agentID)
+	_, err = svc.AdjustFare(rider, id, service.AdjustFareRequest{Kind: domain.AdjustmentTip, AmountCents: 100})
+	require.ErrorIs(t, err, domain.ErrInvalidTransition)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){
+		svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip, svc.CompleteTrip,
+	} {
+		_, err := step(actingAs(ctx, auth.RoleDriver, driverID), id)
+		require.NoError(t, err)
+	}
+	completed, err := svc.GetTrip(ctx, id)
+	require.NoError(t, err)
+	fare := completed.PriceCents
+
+	_, err = svc.AdjustFare(agent, id, service.AdjustFareRequest{Kind: domain.AdjustmentTip, AmountCents: 100})
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+	_, err = svc.AdjustFare(rider, id, service.AdjustFareRequest{Kind: domain.AdjustmentTip, AmountCents: -100})
+	require.ErrorIs(t, err, domain.ErrInvalidAdjustment)
+	_, err = svc.AdjustFare(rider, id, service.AdjustFareRequest{Kind: domain.AdjustmentTip, AmountCents: 300})
+	require.NoError(t, err)
+
+	_, err = svc.AdjustFare(rider, id, service.AdjustFareRequest{Kind: domain.AdjustmentRefund, AmountCents: -200, Reason: "detour"})
+	require.ErrorIs(t, err, domain.ErrSupportOnly)
+	_, err = svc.AdjustFare(ctx, id, service.AdjustFareRequest{Kind: domain.AdjustmentRefund, AmountCents: -200, Reason: "detour"})
+	require.ErrorIs(t, err, domain.ErrUnauthenticated)
+	_, err = svc.AdjustFare(agent, id, service.AdjustFareRequest{Kind: domain.AdjustmentRefund, AmountCents: -200})
+	require.ErrorIs(t, err, domain.ErrInvalidAdjustment, "refunds need a reason")
+	_, err = svc.AdjustFare(agent, id, service.AdjustFareRequest{Kind: domain.AdjustmentRefund, AmountCents: -(fare + 301), Reason: "too much"})
+	require.ErrorIs(t, err, domain.ErrInvalidAdjustment)
+	refund, err := svc.AdjustFare(agent, id, service.AdjustFareRequest{Kind: domain.AdjustmentRefund, AmountCents: -200, Reason: "detour"})
+	require.NoError(t, err)
+
+	last := publisher.events[len(publisher.events)-1]
+	require.Equal(t, domain.EventFareAdjusted, last.Type)
+	payload := last.Payload.(domain.FareAdjustedPayload)
+	require.Equal(t, refund.ID, payload.AdjustmentID)
+	require.Equal(t, fare+100, payload.TotalCents)
+
+	statement, err := svc.FareStatement(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, fare, statement.FareCents)
+	require.Len(t, statement.Adjustments, 2)
+	require.Equal(t, fare+100, statement.TotalCents)
+	adjusted, err := svc.GetTrip(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, fare, adjusted.PriceCents)
+	require.Equal(t, statement.TotalCents, adjusted.TotalCents())
+	require.NoError(t, svc.VerifyEventLog(ctx, id))
+
+	clock.t = clock.t.Add(2 * time.Hour)
+	_, err = svc.AdjustFare(rider, id, service.AdjustFareRequest{Kind: domain.AdjustmentTip, AmountCents: 100})
+	require.ErrorIs(t, err, domain.ErrTipWindowClosed)
+	_, err = svc.AdjustFare(agent, id, service.AdjustFareRequest{Kind: domain.AdjustmentCorrection, AmountCents: 50, Reason: "toll"})
+	require.NoError(t, err)
+}
+
+// straightLineETA drives every leg in a straight line at 10 m/s.
+type straightLineETA struct{}
+
+func (straightLineETA) EstimateTripETA(_ context.Context, pickup, dropoff domain.GeoPoint, _ ...domain.GeoPoint) time.Duration {
+	return time.Duration(domain.HaversineMeters(pickup, dropoff)/10) * time.Second
+}
+
+func TestPoolRidersJoinDriverOnTheWay(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	source := matching.NewMemorySource()
+	driverID := uuid.New()
+	source.UpsertDriver(ctx, driverID, catalog.Pool)
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3, matching.WithActiveTrips(repo))
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), matcher, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithPooling(straightLineETA{}, repo))
+
+	book := func(pickup, dropoff domain.GeoPoint, seats int) domain.Trip {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+			Pickup: pickup, Dropoff: dropoff, VehicleType: catalog.Pool, Seats: seats,
+		})
+		require.NoError(t, err)
+		trip, err := svc.GetTrip(ctx, resp.TripID)
+		require.NoError(t, err)
+		return trip
+	}
+
+	anchor := book(domain.GeoPoint{Lat: 35.70, Lng: 51.40}, domain.GeoPoint{Lat: 35.80, Lng: 51.40}, 1)
+	require.Equal(t, driverID, *anchor.DriverID)
+	require.Nil(t, anchor.PoolID)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	_, err := svc.AcceptTrip(driver, anchor.ID)
+	require.NoError(t, err)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip} {
+		_, err = step(driver, anchor.ID)
+		require.NoError(t, err)
+	}
+
+	// A rider further along the same road joins the driver's route.
+	joined := book(domain.GeoPoint{Lat: 35.72, Lng: 51.40}, domain.GeoPoint{Lat: 35.78, Lng: 51.40}, 1)
+	require.Equal(t, driverID, *joined.DriverID)
+	require.Equal(t, anchor.ID, *joined.PoolID)
+	_, err = svc.AcceptTrip(driver, joined.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.VerifyEventLog(ctx, joined.ID))
+
+	route, err := svc.PoolRoute(ctx, anchor.ID)
+	require.NoError(t, err)
+	require.Equal(t, driverID, route.DriverID)
+	require.Equal(t, []domain.Waypoint{{TripID: anchor.ID, Kind: domain.WaypointPickup, Point: anchor.Pickup}}, route.Visited)
+	require.Equal(t, []domain.Waypoint{
+		{TripID: joined.ID, Kind: domain.WaypointPickup, Point: joined.Pickup},
+		{TripID: joined.ID, Kind: domain.WaypointDropoff, Point: joined.Dropoff},
+		{TripID: anchor.ID, Kind: domain.WaypointDropoff, Point: anchor.Dropoff},
+	}, route.Remaining)
+
+	// Too far off the route, or more seats than are left: nobody else drives
+	// pool, so the trips wait for a driver.
+	far := book(domain.GeoPoint{Lat: 36.50, Lng: 52.50}, domain.GeoPoint{Lat: 36.60, Lng: 52.50}, 1)
+	require.Nil(t, far.DriverID)
+	crowded := book(domain.GeoPoint{Lat: 35.73, Lng: 51.40}, domain.GeoPoint{Lat: 35.77, Lng: 51.40}, 2)
+	require.Nil(t, crowded.DriverID)
+
+	_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{VehicleType: catalog.Pool, Seats: 4})
+	require.ErrorIs(t, err, domain.ErrInvalidSeats)
+	_, err = svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+		VehicleType: catalog.Pool, Stops: []domain.GeoPoint{{Lat: 35.75, Lng: 51.40}},
+	})
+	require.ErrorIs(t, err, domain.ErrTooManyStops)
+
+	_, err = svc.PoolRoute(ctx, uuid.New())
+	require.ErrorIs(t, err, domain.ErrPoolNotFound)
+}
+
+func TestPoolRidersAreNotPickedUpBehindTheDriver(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	source := matching.NewMemorySource()
+	driverID := uuid.New()
+	source.UpsertDriver(ctx, driverID, catalog.Pool)
+	matcher := matching.NewSimpleMatcher(source, matching.NewMemoryReservationStore(), 3, matching.WithActiveTrips(repo))
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, &stubPublisher{}), matcher, stubClock{t: time.Unix(0, 0).UTC()},
+		service.WithPooling(straightLineETA{}, repo), service.WithBreadcrumbs(repo))
+
+	book := func(pickup, dropoff domain.GeoPoint) domain.Trip {
+		resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+			Pickup: pickup, Dropoff: dropoff, VehicleType: catalog.Pool,
+		})
+		require.NoError(t, err)
+		trip, err := svc.GetTrip(ctx, resp.TripID)
+		require.NoError(t, err)
+		return trip
+	}
+	anchor := book(domain.GeoPoint{Lat: 35.70, Lng: 51.40}, domain.GeoPoint{Lat: 35.80, Lng: 51.40})
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip} {
+		_, err := step(driver, anchor.ID)
+		require.NoError(t, err)
+	}
+	// The driver is almost at the anchor's dropoff, well past the pickup of
+	// a rider who would have joined at the start of the ride.
+	require.NoError(t, svc.RecordLocation(ctx, domain.LocationSnapshot{DriverID: driverID, Point: domain.GeoPoint{Lat: 35.79, Lng: 51.40}, Accuracy: 5}))
+
+	behind := book(domain.GeoPoint{Lat: 35.72, Lng: 51.40}, domain.GeoPoint{Lat: 35.78, Lng: 51.40})
+	require.Nil(t, behind.DriverID)
+}
+
+func TestBreadcrumbsPriceTripOnDistanceDriven(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	driverID := uuid.New()
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithBreadcrumbs(repo))
+
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+		Pickup:      domain.GeoPoint{Lat: 35.70, Lng: 51.40},
+		Dropoff:     domain.GeoPoint{Lat: 35.71, Lng: 51.40},
+		VehicleType: catalog.Economy,
+	})
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	_, err = svc.AcceptTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	// Positions before the trip starts are not part of its route.
+	at := func(driverID uuid.UUID, point domain.GeoPoint, speed, accuracy float64, after time.Duration) domain.LocationSnapshot {
+		return domain.LocationSnapshot{DriverID: driverID, Point: point, Speed: speed, Accuracy: accuracy, Updated: clock.Now().Add(after)}
+	}
+	require.NoError(t, svc.RecordLocation(ctx, at(driverID, domain.GeoPoint{Lat: 35.60, Lng: 51.40}, 10, 5, 0)))
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip} {
+		_, err = step(driver, resp.TripID)
+		require.NoError(t, err)
+	}
+
+	// The driver takes a detour east before reaching the dropoff. Positions
+	// are stamped when reported, however late they arrive.
+	driven := []domain.GeoPoint{
+		{Lat: 35.70, Lng: 51.40},
+		{Lat: 35.70, Lng: 51.41},
+		{Lat: 35.71, Lng: 51.41},
+		{Lat: 35.71, Lng: 51.40},
+	}
+	for i, point := range driven {
+		reported := time.Duration(i+1) * time.Minute
+		require.NoError(t, svc.RecordLocation(ctx, at(driverID, point, 10, 5, reported)))
+		if i == 1 {
+			// GPS noise while stopped and a wild fix are not counted.
+			require.NoError(t, svc.RecordLocation(ctx, at(driverID, domain.GeoPoint{Lat: 35.70002, Lng: 51.41}, 0, 5, reported)))
+			require.NoError(t, svc.RecordLocation(ctx, at(driverID, domain.GeoPoint{Lat: 36, Lng: 52}, 10, 500, reported)))
+		}
+	}
+	clock.t = clock.t.Add(10 * time.Minute)
+	require.NoError(t, svc.RecordLocation(ctx, at(uuid.New(), driven[0], 10, 5, 0)))
+
+	want := domain.RouteMeters(driven...)
+	trip, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	require.EqualValues(t, int64(want+0.5), trip.DrivenMeters)
+	finished := publisher.events[len(publisher.events)-1].Payload.(domain.TripFinishedPayload)
+	require.Equal(t, trip.DrivenMeters, finished.DrivenMeters)
+	require.InDelta(t, want/1000, finished.DistanceKM, 1e-9)
+	require.NoError(t, svc.VerifyEventLog(ctx, trip.ID))
+
+	_, err = svc.TripRoute(actingAs(ctx, auth.RoleRider, uuid.New()), trip.ID)
+	require.ErrorIs(t, err, domain.ErrNotTripParty)
+	_, err = svc.TripRoute(actingAs(ctx, auth.RoleRider, trip.RiderID), trip.ID)
+	require.NoError(t, err)
+	route, err := svc.TripRoute(driver, trip.ID)
+	require.NoError(t, err)
+	require.InDelta(t, want, route.DistanceMeters, 1e-6)
+	require.EqualValues(t, 180, route.DurationSeconds)
+	require.Equal(t, domain.EncodePolyline(driven), route.Polyline)
+	require.Equal(t, "LineString", route.GeoJSON.Geometry.Type)
+	require.Equal(t, [2]float64{51.41, 35.70}, route.GeoJSON.Geometry.Coordinates[1])
+	require.Len(t, route.GeoJSON.Geometry.Coordinates, len(driven))
+
+	_, err = svc.TripRoute(driver, uuid.New())
+	require.ErrorIs(t, err, domain.ErrTripNotFound)
+}
+
+func TestBreadcrumbsMissingTheDropoffPriceThePlannedRoute(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	publisher := &stubPublisher{}
+	clock := &mutableClock{t: time.Unix(0, 0).UTC()}
+	driverID := uuid.New()
+	svc := service.New(repo, repository.NewMemoryUnitOfWork(repo, publisher), &stubMatcher{id: &driverID}, clock,
+		service.WithBreadcrumbs(repo))
+
+	pickup, dropoff := domain.GeoPoint{Lat: 35.70, Lng: 51.40}, domain.GeoPoint{Lat: 35.75, Lng: 51.40}
+	resp, err := svc.CreateTrip(actingAs(ctx, auth.RoleRider, uuid.New()), service.CreateTripRequest{
+		Pickup: pickup, Dropoff: dropoff, VehicleType: catalog.Economy,
+	})
+	require.NoError(t, err)
+	driver := actingAs(ctx, auth.RoleDriver, driverID)
+	for _, step := range []func(context.Context, uuid.UUID) (domain.Trip, error){svc.AcceptTrip, svc.DriverEnRoute, svc.DriverArrived, svc.StartTrip} {
+		_, err = step(driver, resp.TripID)
+		require.NoError(t, err)
+	}
+	// The driver's phone goes offline a kilometre into the ride.
+	for i, point := range []domain.GeoPoint{pickup, {Lat: 35.71, Lng: 51.40}} {
+		require.NoError(t, svc.RecordLocation(ctx, domain.LocationSnapshot{
+			DriverID: driverID, Point: point, Accuracy: 5, Updated: clock.Now().Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	clock.t = clock.t.Add(10 * time.Minute)
+	trip, err := svc.CompleteTrip(driver, resp.TripID)
+	require.NoError(t, err)
+	require.EqualValues(t, int64(domain.HaversineMeters(pickup, domain.GeoPoint{Lat: 35.71, Lng: 51.40})+0.5), trip.DrivenMeters)
+	finished := publisher.events[len(publisher.events)-1].Payload.(domain.TripFinishedPayload)
+	require.InDelta(t, domain.RouteMeters(pickup, dropoff)/1000, finished.DistanceKM, 1e-9)
+}
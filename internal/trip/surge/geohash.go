@@ -0,0 +1,36 @@
+package surge
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash encodes point as a geohash of the given length.
+func Geohash(lat, lng float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	even := true
+	for len(hash) < precision {
+		if even {
+			ch = ch<<1 | bisect(&lngRange, lng)
+		} else {
+			ch = ch<<1 | bisect(&latRange, lat)
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// bisect halves r towards v and returns 1 when v fell into the upper half.
+func bisect(r *[2]float64, v float64) int {
+	mid := (r[0] + r[1]) / 2
+	if v >= mid {
+		r[0] = mid
+		return 1
+	}
+	r[1] = mid
+	return 0
+}
@@ -0,0 +1,11 @@
+package surge
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var multiplierGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "surge_multiplier",
+	Help: "Current smoothed surge multiplier per geohash cell.",
+}, []string{"cell"})
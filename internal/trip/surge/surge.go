@@ -0,0 +1,201 @@
+package surge
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/ridellite/internal/trip/domain"
+)
+
+// SupplySource lists the latest known driver positions. It is satisfied by
+// location.StreamObserver.
+type SupplySource interface {
+	All() []domain.LocationSnapshot
+}
+
+// DemandSource lists trips by status. It is satisfied by domain.Repository.
+type DemandSource interface {
+	ListTripsByStatus(ctx context.Context, status domain.TripStatus, limit int) ([]domain.Trip, error)
+}
+
+// Config tunes how multipliers are derived.
+type Config struct {
+	// Precision is the geohash length of a cell; 6 is roughly 1.2km x 0.6km.
+	Precision int
+	// Sensitivity scales how far the multiplier rises per open trip in excess
+	// of available drivers, relative to supply.
+	Sensitivity float64
+	// Smoothing is the weight of the newest target in the exponential moving
+	// average, in (0, 1].
+	Smoothing float64
+	// MaxMultiplier caps the multiplier.
+	MaxMultiplier float64
+	// SupplyTTL drops drivers whose last position is older than this.
+	SupplyTTL time.Duration
+	// DemandLimit bounds how many open trips are read per recomputation.
+	DemandLimit int
+}
+
+// Cell is the surge state of a single geohash cell.
+type Cell struct {
+	Geohash    string  `json:"geohash"`
+	Multiplier float64 `json:"multiplier"`
+	Supply     int     `json:"supply"`
+	Demand     int     `json:"demand"`
+}
+
+// Engine derives per cell surge multipliers from driver supply and open
+// trip demand. Recompute refreshes them; readers see the last result.
+type Engine struct {
+	supply SupplySource
+	demand DemandSource
+	clock  domain.Clock
+	cfg    Config
+
+	mu    sync.RWMutex
+	cells map[string]Cell
+}
+
+// NewEngine constructs an engine, applying defaults to unset config values.
+func NewEngine(supply SupplySource, demand DemandSource, clock domain.Clock, cfg Config) *Engine {
+	if cfg.Precision <= 0 {
+		cfg.Precision = 6
+	}
+	if cfg.Sensitivity <= 0 {
+		cfg.Sensitivity = 0.5
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 0.3
+	}
+	if cfg.MaxMultiplier < 1 {
+		cfg.MaxMultiplier = 3
+	}
+	if cfg.SupplyTTL <= 0 {
+		cfg.SupplyTTL = 2 * time.Minute
+	}
+	if cfg.DemandLimit <= 0 {
+		cfg.DemandLimit = 10000
+	}
+	return &Engine{supply: supply, demand: demand, clock: clock, cfg: cfg, cells: make(map[string]Cell)}
+}
+
+// Recompute buckets current supply and demand into cells and moves each
+// cell's multiplier towards its new target.
+func (e *Engine) Recompute(ctx context.Context) error {
+	trips, err := e.demand.ListTripsByStatus(ctx, domain.StatusRequested, e.cfg.DemandLimit)
+	if err != nil {
+		return fmt.Errorf("load demand: %w", err)
+	}
+	counts := make(map[string]Cell)
+	for _, trip := range trips {
+		hash := e.cellOf(trip.Pickup)
+		c := counts[hash]
+		c.Demand++
+		counts[hash] = c
+	}
+	cutoff := e.clock.Now().Add(-e.cfg.SupplyTTL)
+	for _, snap := range e.supply.All() {
+		if snap.Updated.Before(cutoff) {
+			continue
+		}
+		hash := e.cellOf(snap.Point)
+		c := counts[hash]
+		c.Supply++
+		counts[hash] = c
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	next := make(map[string]Cell, len(counts))
+	for hash, c := range counts {
+		previous := 1.0
+		if old, ok := e.cells[hash]; ok {
+			previous = old.Multiplier
+		}
+		c.Geohash = hash
+		c.Multiplier = e.smooth(previous, e.target(c))
+		next[hash] = c
+	}
+	// Cells without supply or demand decay back towards 1 and are dropped
+	// once they get there.
+	for hash, old := range e.cells {
+		if _, ok := next[hash]; ok {
+			continue
+		}
+		if m := e.smooth(old.Multiplier, 1); m > 1 {
+			next[hash] = Cell{Geohash: hash, Multiplier: m}
+			continue
+		}
+		multiplierGauge.DeleteLabelValues(hash)
+	}
+	for hash, c := range next {
+		multiplierGauge.WithLabelValues(hash).Set(c.Multiplier)
+	}
+	e.cells = next
+	return nil
+}
+
+// At returns the cell containing point. Unknown cells have no surge.
+func (e *Engine) At(point domain.GeoPoint) Cell {
+	hash := e.cellOf(point)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if c, ok := e.cells[hash]; ok {
+		return c
+	}
+	return Cell{Geohash: hash, Multiplier: 1}
+}
+
+// Multiplier returns the surge multiplier at point.
+func (e *Engine) Multiplier(point domain.GeoPoint) float64 {
+	return e.At(point).Multiplier
+}
+
+// Cells returns every tracked cell ordered by descending multiplier.
+func (e *Engine) Cells() []Cell {
+	e.mu.RLock()
+	cells := make([]Cell, 0, len(e.cells))
+	for _, c := range e.cells {
+		cells = append(cells, c)
+	}
+	e.mu.RUnlock()
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Multiplier != cells[j].Multiplier {
+			return cells[i].Multiplier > cells[j].Multiplier
+		}
+		return cells[i].Geohash < cells[j].Geohash
+	})
+	return cells
+}
+
+func (e *Engine) cellOf(point domain.GeoPoint) string {
+	return Geohash(point.Lat, point.Lng, e.cfg.Precision)
+}
+
+// target is the multiplier a cell would have if its current supply and
+// demand persisted: 1 while drivers cover demand, rising linearly with the
+// shortfall relative to supply.
+func (e *Engine) target(c Cell) float64 {
+	shortfall := float64(c.Demand - c.Supply)
+	if shortfall <= 0 {
+		return 1
+	}
+	return e.clamp(1 + e.cfg.Sensitivity*shortfall/math.Max(float64(c.Supply), 1))
+}
+
+func (e *Engine) smooth(previous, target float64) float64 {
+	m := previous + e.cfg.Smoothing*(target-previous)
+	// Snap once close so decaying cells actually reach their target.
+	if math.Abs(target-m) < 0.01 {
+		m = target
+	}
+	return e.clamp(m)
+}
+
+func (e *Engine) clamp(m float64) float64 {
+	return math.Min(math.Max(m, 1), e.cfg.MaxMultiplier)
+}
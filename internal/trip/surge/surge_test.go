@@ -0,0 +1,74 @@
+package surge_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/internal/trip/domain"
+	"github.com/example/ridellite/internal/trip/surge"
+)
+
+type staticSupply []domain.LocationSnapshot
+
+func (s staticSupply) All() []domain.LocationSnapshot { return s }
+
+type staticDemand []domain.Trip
+
+func (d *staticDemand) ListTripsByStatus(context.Context, domain.TripStatus, int) ([]domain.Trip, error) {
+	return *d, nil
+}
+
+type fixedClock struct{ t time.Time }
+
+func (c fixedClock) Now() time.Time { return c.t }
+
+func TestGeohash(t *testing.T) {
+	require.Equal(t, "u4pruydqqvj", surge.Geohash(57.64911, 10.40744, 11))
+	require.Equal(t, "u33db", surge.Geohash(52.52, 13.40, 5))
+}
+
+func TestEngineSmoothsAndCapsMultiplier(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	busy := domain.GeoPoint{Lat: 52.5200, Lng: 13.4050}
+	quiet := domain.GeoPoint{Lat: 48.8566, Lng: 2.3522}
+	supply := staticSupply{
+		{DriverID: uuid.New(), Point: busy, Updated: now},
+		{DriverID: uuid.New(), Point: quiet, Updated: now},
+		// Stale positions are not counted as supply.
+		{DriverID: uuid.New(), Point: busy, Updated: now.Add(-time.Hour)},
+	}
+	demand := &staticDemand{}
+	for i := 0; i < 4; i++ {
+		*demand = append(*demand, domain.Trip{ID: uuid.New(), Pickup: busy, Status: domain.StatusRequested})
+	}
+	engine := surge.NewEngine(supply, demand, fixedClock{t: now}, surge.Config{
+		Sensitivity:   0.5,
+		Smoothing:     0.5,
+		MaxMultiplier: 2,
+	})
+	ctx := context.Background()
+
+	// Target is 1 + 0.5*(4-1)/1 = 2.5, capped at 2; smoothing halves the step.
+	require.NoError(t, engine.Recompute(ctx))
+	require.InDelta(t, 1.5, engine.Multiplier(busy), 1e-9)
+	require.Equal(t, 1.0, engine.Multiplier(quiet))
+
+	require.NoError(t, engine.Recompute(ctx))
+	require.InDelta(t, 1.75, engine.Multiplier(busy), 1e-9)
+
+	cell := engine.At(busy)
+	require.Equal(t, 1, cell.Supply)
+	require.Equal(t, 4, cell.Demand)
+	require.Equal(t, cell, engine.Cells()[0])
+
+	// Once demand is served the cell decays back to no surge.
+	*demand = nil
+	for i := 0; i < 10; i++ {
+		require.NoError(t, engine.Recompute(ctx))
+	}
+	require.Equal(t, 1.0, engine.Multiplier(busy))
+}
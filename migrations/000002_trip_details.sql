@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN vehicle_type TEXT,
+    ADD COLUMN cancelled_by TEXT;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS cancelled_by,
+    DROP COLUMN IF EXISTS vehicle_type;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE outbox ADD COLUMN headers JSONB;
+
+-- +migrate Down
+ALTER TABLE outbox DROP COLUMN IF EXISTS headers;
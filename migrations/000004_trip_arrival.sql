@@ -0,0 +1,11 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN arrived_at TIMESTAMPTZ,
+    ADD COLUMN cancel_reason TEXT,
+    ADD COLUMN cancellation_fee_cents BIGINT NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS cancellation_fee_cents,
+    DROP COLUMN IF EXISTS cancel_reason,
+    DROP COLUMN IF EXISTS arrived_at;
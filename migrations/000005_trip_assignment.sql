@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN accept_deadline TIMESTAMPTZ,
+    ADD COLUMN declined_drivers JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+CREATE INDEX trips_status_requested_at_idx ON trips (status, requested_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS trips_status_requested_at_idx;
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS declined_drivers,
+    DROP COLUMN IF EXISTS accept_deadline;
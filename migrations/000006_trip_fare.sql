@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN fare_breakdown JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS fare_breakdown;
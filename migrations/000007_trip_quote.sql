@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN quote_id UUID,
+    ADD COLUMN upfront_price_cents BIGINT NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS upfront_price_cents,
+    DROP COLUMN IF EXISTS quote_id;
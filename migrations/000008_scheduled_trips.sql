@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN pickup_at TIMESTAMPTZ,
+    ADD COLUMN reminders_sent INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX trips_scheduled_pickup_at_idx ON trips (pickup_at) WHERE status = 'SCHEDULED';
+
+-- +migrate Down
+DROP INDEX IF EXISTS trips_scheduled_pickup_at_idx;
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS reminders_sent,
+    DROP COLUMN IF EXISTS pickup_at;
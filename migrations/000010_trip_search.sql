@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE INDEX trips_rider_requested_at_idx ON trips (rider_id, requested_at DESC, id DESC);
+CREATE INDEX trips_driver_requested_at_idx ON trips (driver_id, requested_at DESC, id DESC);
+CREATE INDEX trips_requested_at_idx ON trips (requested_at DESC, id DESC);
+
+-- +migrate Down
+DROP INDEX IF EXISTS trips_requested_at_idx;
+DROP INDEX IF EXISTS trips_driver_requested_at_idx;
+DROP INDEX IF EXISTS trips_rider_requested_at_idx;
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- A rider and a driver can each be on at most one active trip. The status
+-- lists mirror domain.ActiveStatuses.
+CREATE UNIQUE INDEX trips_one_active_per_rider_idx ON trips (rider_id)
+    WHERE status IN ('REQUESTED', 'DRIVER_ASSIGNED', 'DRIVER_ACCEPTED', 'PICKUP_EN_ROUTE', 'ARRIVED', 'IN_PROGRESS');
+CREATE UNIQUE INDEX trips_one_active_per_driver_idx ON trips (driver_id)
+    WHERE status IN ('DRIVER_ASSIGNED', 'DRIVER_ACCEPTED', 'PICKUP_EN_ROUTE', 'ARRIVED', 'IN_PROGRESS');
+
+-- +migrate Down
+DROP INDEX IF EXISTS trips_one_active_per_driver_idx;
+DROP INDEX IF EXISTS trips_one_active_per_rider_idx;
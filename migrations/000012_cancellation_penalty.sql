@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN driver_penalty_cents BIGINT NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS driver_penalty_cents;
@@ -0,0 +1,26 @@
+-- +migrate Up
+CREATE TABLE trip_ratings (
+    trip_id UUID NOT NULL REFERENCES trips(id),
+    rater_id UUID NOT NULL,
+    ratee_id UUID NOT NULL,
+    ratee_role TEXT NOT NULL,
+    stars SMALLINT NOT NULL CHECK (stars BETWEEN 1 AND 5),
+    tags JSONB NOT NULL DEFAULT '[]'::jsonb,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (trip_id, rater_id)
+);
+
+CREATE TABLE user_ratings (
+    user_id UUID NOT NULL,
+    role TEXT NOT NULL,
+    rating_count BIGINT NOT NULL,
+    stars_total BIGINT NOT NULL,
+    rolling_average DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, role)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_ratings;
+DROP TABLE IF EXISTS trip_ratings;
@@ -0,0 +1,35 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN adjustment_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE fare_adjustments (
+    id UUID PRIMARY KEY,
+    trip_id UUID NOT NULL REFERENCES trips(id),
+    kind TEXT NOT NULL CHECK (kind IN ('tip', 'refund', 'adjustment')),
+    amount_cents BIGINT NOT NULL CHECK (amount_cents <> 0),
+    reason TEXT NOT NULL DEFAULT '',
+    actor_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX fare_adjustments_trip_idx ON fare_adjustments (trip_id, created_at);
+
+-- Adjustments are an audit trail: corrections are new rows, never edits.
+-- +migrate StatementBegin
+CREATE FUNCTION fare_adjustments_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'fare_adjustments rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER fare_adjustments_immutable
+    BEFORE UPDATE OR DELETE ON fare_adjustments
+    FOR EACH ROW EXECUTE FUNCTION fare_adjustments_immutable();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS fare_adjustments_immutable ON fare_adjustments;
+DROP FUNCTION IF EXISTS fare_adjustments_immutable();
+DROP TABLE IF EXISTS fare_adjustments;
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS adjustment_cents;
@@ -0,0 +1,36 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN seats INTEGER NOT NULL DEFAULT 1 CHECK (seats > 0),
+    ADD COLUMN pool_id UUID;
+
+CREATE INDEX trips_pool_idx ON trips (pool_id) WHERE pool_id IS NOT NULL;
+
+-- A pool is named after its first trip, whose own pool_id stays NULL, so
+-- COALESCE(pool_id, id) identifies the pool of every trip. Drivers may hold
+-- several active trips only when they all ride the same pool.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+DROP INDEX IF EXISTS trips_one_active_per_driver_idx;
+ALTER TABLE trips
+    ADD CONSTRAINT trips_one_active_pool_per_driver
+    EXCLUDE USING gist (driver_id WITH =, (COALESCE(pool_id, id)) WITH <>)
+    WHERE (status IN ('DRIVER_ASSIGNED', 'DRIVER_ACCEPTED', 'PICKUP_EN_ROUTE', 'ARRIVED', 'IN_PROGRESS'));
+
+CREATE TABLE trip_pools (
+    id UUID PRIMARY KEY REFERENCES trips(id),
+    driver_id UUID NOT NULL,
+    vehicle_type TEXT NOT NULL,
+    waypoints JSONB NOT NULL,
+    version BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS trip_pools;
+ALTER TABLE trips
+    DROP CONSTRAINT IF EXISTS trips_one_active_pool_per_driver;
+CREATE UNIQUE INDEX trips_one_active_per_driver_idx ON trips (driver_id)
+    WHERE status IN ('DRIVER_ASSIGNED', 'DRIVER_ACCEPTED', 'PICKUP_EN_ROUTE', 'ARRIVED', 'IN_PROGRESS');
+DROP INDEX IF EXISTS trips_pool_idx;
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS pool_id,
+    DROP COLUMN IF EXISTS seats;
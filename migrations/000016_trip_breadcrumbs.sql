@@ -0,0 +1,19 @@
+-- +migrate Up
+ALTER TABLE trips
+    ADD COLUMN driven_meters BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE trip_breadcrumbs (
+    id BIGSERIAL PRIMARY KEY,
+    trip_id UUID NOT NULL REFERENCES trips(id),
+    location GEOMETRY(POINT, 4326) NOT NULL,
+    speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    accuracy DOUBLE PRECISION NOT NULL DEFAULT 0,
+    recorded_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX trip_breadcrumbs_trip_idx ON trip_breadcrumbs (trip_id, recorded_at, id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS trip_breadcrumbs;
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS driven_meters;
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- Existing rows predate claims and expire at once.
+ALTER TABLE idempotency_keys
+    ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX idempotency_keys_expires_idx ON idempotency_keys (expires_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idempotency_keys_expires_idx;
+ALTER TABLE idempotency_keys
+    DROP COLUMN IF EXISTS expires_at;
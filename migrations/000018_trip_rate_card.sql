@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Trips requested before this migration have no rate card and are priced
+-- with the product's current tariff.
+ALTER TABLE trips
+    ADD COLUMN rate_card JSONB;
+
+-- +migrate Down
+ALTER TABLE trips
+    DROP COLUMN IF EXISTS rate_card;
@@ -0,0 +1,278 @@
+// Package idempotency makes mutating HTTP endpoints safe to retry. A client
+// sends an Idempotency-Key header; the first response for the key is stored
+// and replayed verbatim for every retry of the same request by the same
+// caller.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Header is the request header carrying the idempotency key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses served from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// Defaults used for zero Config fields.
+const (
+	DefaultTTL   = 24 * time.Hour
+	DefaultLease = 30 * time.Second
+	// DefaultMaxBody bounds the request bodies read for fingerprinting.
+	DefaultMaxBody = 1 << 20
+	defaultPoll    = 50 * time.Millisecond
+)
+
+// Response is a stored HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Record is what a store keeps per key.
+type Record struct {
+	// RequestHash fingerprints the request holding the key; a key may only be
+	// reused for the same request.
+	RequestHash string `json:"request_hash"`
+	// Response is nil while the request is still in progress.
+	Response *Response `json:"response,omitempty"`
+}
+
+// Store persists records by key. Implementations must make Claim atomic so
+// that exactly one of several concurrent requests with a key runs.
+type Store interface {
+	// Claim reserves key for the request fingerprinted by hash until lease
+	// elapses and reports true. When the key is held, by a finished request
+	// or one still in progress, Claim returns its record and false. Expired
+	// records and claims count as free.
+	Claim(ctx context.Context, key, hash string, lease time.Duration) (Record, bool, error)
+	// Complete stores resp for the claim of key by hash and keeps it for ttl.
+	Complete(ctx context.Context, key, hash string, resp Response, ttl time.Duration) error
+	// Release drops the unfinished claim of key by hash so the request can be
+	// retried.
+	Release(ctx context.Context, key, hash string) error
+}
+
+// Config tunes the middleware.
+type Config struct {
+	// TTL is how long responses are remembered. Defaults to DefaultTTL.
+	TTL time.Duration
+	// Lease bounds how long a claim blocks its key; claims of crashed requests
+	// expire after it. It must exceed the slowest handler. Defaults to
+	// DefaultLease.
+	Lease time.Duration
+	// Wait is how long a duplicate of a request still in progress waits for
+	// its response before being answered with 409. Zero answers at once.
+	Wait time.Duration
+	// Poll is how often a waiting duplicate checks the store. Defaults to 50ms.
+	Poll time.Duration
+	// MaxBody bounds request bodies in bytes; larger ones are answered with
+	// 413. Defaults to DefaultMaxBody.
+	MaxBody int64
+	// Scope names the caller of a request, typically its authenticated
+	// subject. Keys are kept per scope, so a stored response only replays to
+	// the caller it was served to. Nil puts every request in one scope.
+	Scope func(*http.Request) string
+}
+
+func (c Config) withDefaults() Config {
+	if c.TTL <= 0 {
+		c.TTL = DefaultTTL
+	}
+	if c.Lease <= 0 {
+		c.Lease = DefaultLease
+	}
+	if c.Poll <= 0 {
+		c.Poll = defaultPoll
+	}
+	if c.MaxBody <= 0 {
+		c.MaxBody = DefaultMaxBody
+	}
+	return c
+}
+
+// Middleware replays stored responses for requests carrying a key it has
+// seen. Keys are scoped by Config.Scope, so a key only ever replays to the
+// caller that first used it; mount the middleware where Scope can tell
+// callers apart, such as after authentication. Reusing a key for a different
+// request is answered with 422, and a duplicate of a request still in
+// progress with 409 once Config.Wait has passed. Safe methods and requests
+// without a key pass through, and 5xx responses are not stored so the client
+// can retry them.
+func Middleware(store Store, cfg Config) func(http.Handler) http.Handler {
+	cfg = cfg.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || safeMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = scopedKey(r, key, cfg.Scope)
+			body, err := readBody(w, r, cfg.MaxBody)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "read request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			hash := RequestHash(r.Method, r.URL.RequestURI(), body)
+
+			rec, claimed, err := claim(r.Context(), store, key, hash, cfg)
+			switch {
+			case err != nil:
+				http.Error(w, "idempotency store unavailable", http.StatusServiceUnavailable)
+				return
+			case claimed:
+			case rec.RequestHash != hash:
+				http.Error(w, "idempotency key reused with a different request", http.StatusUnprocessableEntity)
+				return
+			case rec.Response == nil:
+				http.Error(w, "request in progress", http.StatusConflict)
+				return
+			default:
+				replay(w, *rec.Response)
+				return
+			}
+
+			// Detached from the request so a client that goes away still
+			// releases or completes its claim.
+			ctx := context.WithoutCancel(r.Context())
+			defer func() {
+				if p := recover(); p != nil {
+					_ = store.Release(ctx, key, hash)
+					panic(p)
+				}
+			}()
+			recorder := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status >= http.StatusInternalServerError {
+				_ = store.Release(ctx, key, hash)
+				return
+			}
+			// The response has been sent; a failed Complete only costs the
+			// replay.
+			_ = store.Complete(ctx, key, hash, recorder.response(), cfg.TTL)
+		})
+	}
+}
+
+// claim claims key, waiting up to cfg.Wait while the same request holds it.
+func claim(ctx context.Context, store Store, key, hash string, cfg Config) (Record, bool, error) {
+	deadline := time.Now().Add(cfg.Wait)
+	for {
+		rec, claimed, err := store.Claim(ctx, key, hash, cfg.Lease)
+		if err != nil || claimed || rec.RequestHash != hash || rec.Response != nil || !time.Now().Before(deadline) {
+			return rec, claimed, err
+		}
+		select {
+		case <-ctx.Done():
+			return Record{}, false, ctx.Err()
+		case <-time.After(cfg.Poll):
+		}
+	}
+}
+
+// RequestHash fingerprints a request by method, URI and body.
+func RequestHash(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StoreKey is the store key of the records for key sent by subject. The
+// subject is length prefixed so that no two subject and key pairs collide.
+func StoreKey(subject, key string) string {
+	return fmt.Sprintf("%d:%s:%s", len(subject), subject, key)
+}
+
+// scopedKey is the store key of key sent with r, in the scope named by
+// scope, or the empty scope when scope is nil.
+func scopedKey(r *http.Request, key string, scope func(*http.Request) string) string {
+	var subject string
+	if scope != nil {
+		subject = scope(r)
+	}
+	return StoreKey(subject, key)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func replay(w http.ResponseWriter, resp Response) {
+	for name, values := range resp.Header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(resp.Body)
+}
+
+// recorder passes the response through while keeping a copy.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+	r.header = r.ResponseWriter.Header().Clone()
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) response() Response {
+	header := r.header
+	if !r.wroteHeader {
+		header = r.ResponseWriter.Header().Clone()
+	}
+	return Response{StatusCode: r.status, Header: header, Body: r.body.Bytes()}
+}
@@ -0,0 +1,198 @@
+package idempotency_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/pkg/idempotency"
+)
+
+func TestMiddlewareReplaysStoredResponses(t *testing.T) {
+	now := time.Unix(0, 0).UTC()
+	clock := func() time.Time { return now }
+	calls := 0
+	handler := idempotency.Middleware(idempotency.NewMemoryStore(clock), idempotency.Config{TTL: time.Hour})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Location", fmt.Sprintf("/things/%d", calls))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, "call %d", calls)
+		}))
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotency.Header, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do(http.MethodPost, "/things", "k1", `{"a":1}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Equal(t, "call 1", first.Body.String())
+
+	retry := do(http.MethodPost, "/things", "k1", `{"a":1}`)
+	require.Equal(t, 1, calls, "a retry must not run the handler again")
+	require.Equal(t, http.StatusCreated, retry.Code)
+	require.Equal(t, "/things/1", retry.Header().Get("Location"))
+	require.Equal(t, "true", retry.Header().Get(idempotency.ReplayedHeader))
+	require.Equal(t, "call 1", retry.Body.String())
+
+	require.Equal(t, http.StatusUnprocessableEntity, do(http.MethodPost, "/things", "k1", `{"a":2}`).Code)
+	require.Equal(t, http.StatusUnprocessableEntity, do(http.MethodPost, "/other", "k1", `{"a":1}`).Code)
+
+	do(http.MethodPost, "/things", "", `{"a":1}`)
+	do(http.MethodGet, "/things", "k1", "")
+	require.Equal(t, 3, calls, "requests without a key and safe methods pass through")
+
+	now = now.Add(time.Hour)
+	expired := do(http.MethodPost, "/things", "k1", `{"a":2}`)
+	require.Equal(t, http.StatusCreated, expired.Code, "expired keys can be reused")
+	require.Equal(t, 4, calls)
+}
+
+func TestMiddlewareScopesKeysToTheCaller(t *testing.T) {
+	calls := 0
+	caller := func(r *http.Request) string { return r.Header.Get("X-Caller") }
+	handler := idempotency.Middleware(idempotency.NewMemoryStore(nil), idempotency.Config{Scope: caller})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			_, _ = fmt.Fprintf(w, "%s call %d", caller(r), calls)
+		}))
+	post := func(subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/things/1/cancel", strings.NewReader(`{}`))
+		req.Header.Set(idempotency.Header, "k1")
+		req.Header.Set("X-Caller", subject)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, "alice call 1", post("alice").Body.String())
+	bob := post("bob")
+	require.Equal(t, "bob call 2", bob.Body.String(), "another caller's key never replays")
+	require.Empty(t, bob.Header().Get(idempotency.ReplayedHeader))
+	require.Equal(t, "alice call 1", post("alice").Body.String())
+	require.Equal(t, 2, calls)
+}
+
+func TestMiddlewareRejectsOversizedBodies(t *testing.T) {
+	handler := idempotency.Middleware(idempotency.NewMemoryStore(nil), idempotency.Config{MaxBody: 4})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("the handler must not run")
+		}))
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(`{"a":1}`))
+	req.Header.Set(idempotency.Header, "k1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestMiddlewareDoesNotStoreServerErrors(t *testing.T) {
+	calls := 0
+	handler := idempotency.Middleware(idempotency.NewMemoryStore(nil), idempotency.Config{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				http.Error(w, "boom", http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/things", nil)
+		req.Header.Set(idempotency.Header, "k1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Equal(t, 2, calls)
+}
+
+func TestMiddlewareRunsConcurrentDuplicatesOnce(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wait time.Duration
+		code int
+		body string
+	}{
+		{name: "rejected while in progress", code: http.StatusConflict, body: "request in progress\n"},
+		{name: "waits for the response", wait: 5 * time.Second, code: http.StatusCreated, body: "done"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			started, finish := make(chan struct{}), make(chan struct{})
+			calls := 0
+			handler := idempotency.Middleware(idempotency.NewMemoryStore(nil), idempotency.Config{Wait: tc.wait, Poll: time.Millisecond})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls++
+					close(started)
+					<-finish
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte("done"))
+				}))
+			post := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(`{}`))
+				req.Header.Set(idempotency.Header, "k1")
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec
+			}
+
+			first := make(chan *httptest.ResponseRecorder)
+			go func() { first <- post() }()
+			<-started
+			duplicate := make(chan *httptest.ResponseRecorder)
+			go func() { duplicate <- post() }()
+			var rec *httptest.ResponseRecorder
+			if tc.wait > 0 {
+				// Let the duplicate start waiting before the first finishes.
+				time.Sleep(10 * time.Millisecond)
+				close(finish)
+				rec = <-duplicate
+			} else {
+				rec = <-duplicate
+				close(finish)
+			}
+			require.Equal(t, tc.code, rec.Code)
+			require.Equal(t, tc.body, rec.Body.String())
+			require.Equal(t, http.StatusCreated, (<-first).Code)
+			require.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestMiddlewareReclaimsAbandonedKeys(t *testing.T) {
+	now := time.Unix(0, 0).UTC()
+	store := idempotency.NewMemoryStore(func() time.Time { return now })
+	calls := 0
+	handler := idempotency.Middleware(store, idempotency.Config{Lease: time.Minute})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+		}))
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/things", nil)
+		req.Header.Set(idempotency.Header, "k1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A request that crashed after claiming the key never completes it.
+	_, claimed, err := store.Claim(context.Background(), idempotency.StoreKey("", "k1"), idempotency.RequestHash(http.MethodPost, "/things", nil), time.Minute)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.Equal(t, http.StatusConflict, post())
+
+	now = now.Add(time.Minute)
+	require.Equal(t, http.StatusCreated, post())
+	require.Equal(t, 1, calls)
+}
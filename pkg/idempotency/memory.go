@@ -0,0 +1,89 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory. It suits tests and single
+// instance deployments.
+type MemoryStore struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// NewMemoryStore constructs a store. A nil now defaults to time.Now.
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStore{now: now, entries: make(map[string]memoryEntry)}
+}
+
+// Claim implements Store.
+func (m *MemoryStore) Claim(_ context.Context, key, hash string, lease time.Duration) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expiresAt) {
+		return clone(entry.record), false, nil
+	}
+	m.entries[key] = memoryEntry{record: Record{RequestHash: hash}, expiresAt: now.Add(lease)}
+	return Record{}, true, nil
+}
+
+// Complete implements Store. It does nothing when key has meanwhile been
+// claimed by another request.
+func (m *MemoryStore) Complete(_ context.Context, key, hash string, resp Response, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expiresAt) && entry.record.RequestHash != hash {
+		return nil
+	}
+	m.entries[key] = memoryEntry{record: clone(Record{RequestHash: hash, Response: &resp}), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Release implements Store.
+func (m *MemoryStore) Release(_ context.Context, key, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.entries[key]; ok && entry.record.RequestHash == hash && entry.record.Response == nil {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func clone(rec Record) Record {
+	if rec.Response != nil {
+		resp := *rec.Response
+		resp.Header = resp.Header.Clone()
+		resp.Body = bytes.Clone(resp.Body)
+		rec.Response = &resp
+	}
+	return rec
+}
+
+// DeleteExpired removes expired records and returns how many it removed.
+func (m *MemoryStore) DeleteExpired(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var removed int64
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,123 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The statements below mirror internal/db/queries/idempotency.sql and must be
+// kept in sync with it.
+const (
+	claimKeyQuery = `INSERT INTO idempotency_keys (key, request_hash, response, created_at, expires_at)
+VALUES ($1, $2, NULL, now(), now() + $3::bigint * interval '1 millisecond')
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    response = NULL,
+    created_at = EXCLUDED.created_at,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now()
+RETURNING key`
+
+	getKeyQuery = `SELECT request_hash, response
+FROM idempotency_keys
+WHERE key = $1 AND expires_at > now()`
+
+	completeKeyQuery = `INSERT INTO idempotency_keys (key, request_hash, response, created_at, expires_at)
+VALUES ($1, $2, $3, now(), now() + $4::bigint * interval '1 millisecond')
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    response = EXCLUDED.response,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.request_hash = EXCLUDED.request_hash
+   OR idempotency_keys.expires_at <= now()`
+
+	releaseKeyQuery = `DELETE FROM idempotency_keys
+WHERE key = $1 AND request_hash = $2 AND response IS NULL`
+
+	deleteExpiredKeysQuery = `DELETE FROM idempotency_keys
+WHERE expires_at <= now()`
+)
+
+// claimAttempts bounds retries when a record expires between a failed claim
+// and reading it.
+const claimAttempts = 3
+
+// PostgresStore keeps records in the idempotency_keys table, so every
+// instance of a service sees the same keys. Expiry uses the database clock.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore constructs a store on db.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Claim implements Store. The claim is a single upsert that only replaces
+// expired rows, so concurrent claims of a key serialise on its row.
+func (p *PostgresStore) Claim(ctx context.Context, key, hash string, lease time.Duration) (Record, bool, error) {
+	for range claimAttempts {
+		var claimed string
+		err := p.db.QueryRowContext(ctx, claimKeyQuery, key, hash, lease.Milliseconds()).Scan(&claimed)
+		if err == nil {
+			return Record{}, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Record{}, false, fmt.Errorf("claim idempotency key: %w", err)
+		}
+
+		var (
+			rec      Record
+			response []byte
+		)
+		err = p.db.QueryRowContext(ctx, getKeyQuery, key).Scan(&rec.RequestHash, &response)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return Record{}, false, fmt.Errorf("get idempotency key: %w", err)
+		}
+		if response != nil {
+			rec.Response = &Response{}
+			if err := json.Unmarshal(response, rec.Response); err != nil {
+				return Record{}, false, fmt.Errorf("decode idempotent response: %w", err)
+			}
+		}
+		return rec, false, nil
+	}
+	return Record{}, false, fmt.Errorf("claim idempotency key %q: expired repeatedly while claiming", key)
+}
+
+// Complete implements Store.
+func (p *PostgresStore) Complete(ctx context.Context, key, hash string, resp Response, ttl time.Duration) error {
+	response, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("encode idempotent response: %w", err)
+	}
+	if _, err := p.db.ExecContext(ctx, completeKeyQuery, key, hash, response, ttl.Milliseconds()); err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release implements Store.
+func (p *PostgresStore) Release(ctx context.Context, key, hash string) error {
+	if _, err := p.db.ExecContext(ctx, releaseKeyQuery, key, hash); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired records and returns how many it removed.
+// Claim replaces expired rows itself; this only reclaims space.
+func (p *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := p.db.ExecContext(ctx, deleteExpiredKeysQuery)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,108 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	postgrescontainer "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestPostgresStoreClaimsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := NewPostgresStore(startPostgres(t, ctx))
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, claimed, err := store.Claim(ctx, "k1", "h1", time.Minute)
+			require.NoError(t, err)
+			if claimed {
+				claims.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, claims.Load())
+
+	rec, claimed, err := store.Claim(ctx, "k1", "h2", time.Minute)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	require.Equal(t, Record{RequestHash: "h1"}, rec, "in progress")
+
+	resp := Response{StatusCode: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"ok":true}`)}
+	require.NoError(t, store.Release(ctx, "k1", "h2"), "only the holder releases")
+	require.NoError(t, store.Complete(ctx, "k1", "h1", resp, time.Hour))
+	rec, claimed, err = store.Claim(ctx, "k1", "h1", time.Minute)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	require.Equal(t, &resp, rec.Response)
+}
+
+func TestPostgresStoreExpiresAbandonedClaims(t *testing.T) {
+	ctx := context.Background()
+	store := NewPostgresStore(startPostgres(t, ctx))
+
+	_, claimed, err := store.Claim(ctx, "k1", "h1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	require.Eventually(t, func() bool {
+		_, claimed, err := store.Claim(ctx, "k1", "h1", time.Minute)
+		return err == nil && claimed
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, store.Release(ctx, "k1", "h1"))
+	_, claimed, err = store.Claim(ctx, "k1", "h1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, claimed, "a released claim is free again")
+
+	require.Eventually(t, func() bool {
+		deleted, err := store.DeleteExpired(ctx)
+		return err == nil && deleted == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+// idempotencySchema is the idempotency_keys table as the migrations leave it.
+const idempotencySchema = `
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT,
+    response JSONB,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idempotency_keys_expires_idx ON idempotency_keys (expires_at);`
+
+// startPostgres runs a database holding only the idempotency_keys table.
+func startPostgres(t *testing.T, ctx context.Context) *sql.DB {
+	pg, err := postgrescontainer.Run(ctx, "postgres:16",
+		postgrescontainer.WithDatabase("ridellite"), postgrescontainer.WithUsername("postgres"), postgrescontainer.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").WithOccurrence(2)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, pg.Terminate(ctx))
+	})
+	dsn, err := pg.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	require.NoError(t, db.PingContext(ctx))
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.ExecContext(ctx, idempotencySchema)
+	require.NoError(t, err)
+	return db
+}
@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultRedisPrefix = "idempotency:"
+
+// claimScript claims a key stored as a hash of the request hash and, once
+// complete, the response. It returns 1 after claiming and the held hash and
+// response otherwise.
+//
+// KEYS[1] record hash
+// ARGV[1] request hash, ARGV[2] lease in ms
+var claimScript = redis.NewScript(`
+local held = redis.call('HMGET', KEYS[1], 'hash', 'response')
+if held[1] then
+  return held
+end
+redis.call('HSET', KEYS[1], 'hash', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// completeScript stores the response unless another request holds the key.
+//
+// KEYS[1] record hash
+// ARGV[1] request hash, ARGV[2] response, ARGV[3] TTL in ms
+var completeScript = redis.NewScript(`
+local held = redis.call('HGET', KEYS[1], 'hash')
+if held and held ~= ARGV[1] then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'hash', ARGV[1], 'response', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// releaseScript drops a claim still held by the request and not completed.
+//
+// KEYS[1] record hash
+// ARGV[1] request hash
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'hash') == ARGV[1] and redis.call('HEXISTS', KEYS[1], 'response') == 0 then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps records in Redis hashes that expire with their lease or
+// TTL, updated atomically by scripts.
+type RedisStore struct {
+	client    redis.Scripter
+	keyPrefix string
+}
+
+// NewRedisStore constructs a store. An empty prefix defaults to
+// "idempotency:".
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisStore{client: client, keyPrefix: prefix}
+}
+
+// Claim implements Store.
+func (r *RedisStore) Claim(ctx context.Context, key, hash string, lease time.Duration) (Record, bool, error) {
+	res, err := claimScript.Run(ctx, r.client, []string{r.keyPrefix + key}, hash, lease.Milliseconds()).Result()
+	if err != nil {
+		return Record{}, false, fmt.Errorf("redis claim idempotency key: %w", err)
+	}
+	held, ok := res.([]any)
+	if !ok {
+		return Record{}, true, nil
+	}
+	var rec Record
+	if len(held) > 0 {
+		rec.RequestHash, _ = held[0].(string)
+	}
+	if len(held) > 1 {
+		if response, ok := held[1].(string); ok {
+			rec.Response = &Response{}
+			if err := json.Unmarshal([]byte(response), rec.Response); err != nil {
+				return Record{}, false, fmt.Errorf("decode idempotent response: %w", err)
+			}
+		}
+	}
+	return rec, false, nil
+}
+
+// Complete implements Store.
+func (r *RedisStore) Complete(ctx context.Context, key, hash string, resp Response, ttl time.Duration) error {
+	response, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("encode idempotent response: %w", err)
+	}
+	if err := completeScript.Run(ctx, r.client, []string{r.keyPrefix + key}, hash, response, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("redis complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release implements Store.
+func (r *RedisStore) Release(ctx context.Context, key, hash string) error {
+	if err := releaseScript.Run(ctx, r.client, []string{r.keyPrefix + key}, hash).Err(); err != nil {
+		return fmt.Errorf("redis release idempotency key: %w", err)
+	}
+	return nil
+}
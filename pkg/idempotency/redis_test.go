@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	rediscontainer "github.com/testcontainers/testcontainers-go/modules/redis"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestRedisStoreClaimsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(startRedis(t, ctx), "")
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, claimed, err := store.Claim(ctx, "k1", "h1", time.Minute)
+			require.NoError(t, err)
+			if claimed {
+				claims.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, claims.Load())
+
+	rec, claimed, err := store.Claim(ctx, "k1", "h2", time.Minute)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	require.Equal(t, Record{RequestHash: "h1"}, rec, "in progress")
+
+	resp := Response{StatusCode: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"ok":true}`)}
+	require.NoError(t, store.Release(ctx, "k1", "h2"), "only the holder releases")
+	require.NoError(t, store.Complete(ctx, "k1", "h1", resp, time.Hour))
+	rec, claimed, err = store.Claim(ctx, "k1", "h1", time.Minute)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	require.Equal(t, &resp, rec.Response)
+}
+
+func TestRedisStoreExpiresAbandonedClaims(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(startRedis(t, ctx), "")
+
+	_, claimed, err := store.Claim(ctx, "k1", "h1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	require.Eventually(t, func() bool {
+		_, claimed, err := store.Claim(ctx, "k1", "h1", time.Minute)
+		return err == nil && claimed
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, store.Release(ctx, "k1", "h1"))
+	_, claimed, err = store.Claim(ctx, "k1", "h1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, claimed, "a released claim is free again")
+}
+
+func startRedis(t *testing.T, ctx context.Context) *redis.Client {
+	container, err := rediscontainer.Run(ctx, "redis:7", testcontainers.WithWaitStrategy(wait.ForLog("Ready to accept connections")))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, container.Terminate(ctx))
+	})
+	endpoint, err := container.ConnectionString(ctx)
+	require.NoError(t, err)
+	client := redis.NewClient(&redis.Options{Addr: strings.TrimPrefix(endpoint, "redis://")})
+	require.NoError(t, client.Ping(ctx).Err())
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
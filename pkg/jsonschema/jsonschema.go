@@ -0,0 +1,197 @@
+// Package jsonschema derives JSON Schemas from Go types as encoding/json
+// marshals them, and checks whether a schema change keeps documents readable
+// by consumers written against the previous schema.
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Draft is the JSON Schema dialect of generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Types is the set of JSON types a value may have. It marshals as a single
+// string when it holds one type.
+type Types []string
+
+// MarshalJSON implements json.Marshaler.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// Schema is the subset of JSON Schema needed to describe Go values.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Generate returns the schema of the JSON encoding of v's type, titled title.
+func Generate(title string, v any) *Schema {
+	s := generate(reflect.TypeOf(v))
+	s.Schema = Draft
+	s.Title = title
+	return s
+}
+
+func generate(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return nullable(generate(t.Elem()))
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case t == uuidType:
+		return &Schema{Type: Types{"string"}, Format: "uuid"}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: Types{"string"}}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nullable(&Schema{Type: Types{"string"}, Format: "byte"})
+		}
+		return nullable(&Schema{Type: Types{"array"}, Items: generate(t.Elem())})
+	case reflect.Array:
+		return &Schema{Type: Types{"array"}, Items: generate(t.Elem())}
+	case reflect.Map:
+		return nullable(&Schema{Type: Types{"object"}, AdditionalProperties: generate(t.Elem())})
+	case reflect.Struct:
+		s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+		addFields(s, t)
+		sort.Strings(s.Required)
+		if len(s.Properties) == 0 {
+			s.Properties = nil
+		}
+		return s
+	}
+	// Interfaces and other dynamic values accept anything.
+	return &Schema{}
+}
+
+// addFields adds the exported fields of struct type t to s, flattening
+// embedded structs the way encoding/json does.
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(s, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = generate(field.Type)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func nullable(s *Schema) *Schema {
+	if !slices.Contains(s.Type, "null") {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+// Compatible lists the ways documents valid against next can fail to be
+// valid against prev, that is how next breaks consumers written against
+// prev. Adding properties or making them required is compatible; removing a
+// required property, widening a type or changing a format is not.
+func Compatible(prev, next *Schema) []string {
+	var problems []string
+	compare("$", prev, next, &problems)
+	return problems
+}
+
+func compare(path string, prev, next *Schema, problems *[]string) {
+	if prev == nil || next == nil {
+		return
+	}
+	if len(prev.Type) > 0 {
+		for _, typ := range next.Type {
+			if !slices.Contains(prev.Type, typ) {
+				*problems = append(*problems, fmt.Sprintf("%s: type %s was not allowed before (%s)", path, typ, strings.Join(prev.Type, ", ")))
+			}
+		}
+		if len(next.Type) == 0 {
+			*problems = append(*problems, fmt.Sprintf("%s: type is no longer restricted to %s", path, strings.Join(prev.Type, ", ")))
+		}
+	}
+	if prev.Format != "" && prev.Format != next.Format {
+		*problems = append(*problems, fmt.Sprintf("%s: format changed from %q to %q", path, prev.Format, next.Format))
+	}
+	for _, name := range prev.Required {
+		if !slices.Contains(next.Required, name) {
+			*problems = append(*problems, fmt.Sprintf("%s.%s: no longer required", path, name))
+		}
+	}
+	names := make([]string, 0, len(prev.Properties))
+	for name := range prev.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := next.Properties[name]; ok {
+			compare(path+"."+name, prev.Properties[name], property, problems)
+		}
+	}
+	compare(path+"[]", prev.Items, next.Items, problems)
+	compare(path+"{}", prev.AdditionalProperties, next.AdditionalProperties, problems)
+}
@@ -0,0 +1,66 @@
+package jsonschema_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/ridellite/pkg/jsonschema"
+)
+
+type point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type base struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type v1 struct {
+	base
+	At     time.Time `json:"at"`
+	Points []point   `json:"points"`
+	Note   string    `json:"note,omitempty"`
+	Hidden string    `json:"-"`
+}
+
+func TestGenerateFollowsEncodingJSON(t *testing.T) {
+	s := jsonschema.Generate("v1", v1{})
+
+	require.Equal(t, jsonschema.Draft, s.Schema)
+	require.Equal(t, []string{"at", "id", "points"}, s.Required)
+	require.Equal(t, "uuid", s.Properties["id"].Format)
+	require.Equal(t, "date-time", s.Properties["at"].Format)
+	require.Equal(t, jsonschema.Types{"array", "null"}, s.Properties["points"].Type)
+	require.Equal(t, []string{"lat", "lng"}, s.Properties["points"].Items.Required)
+	require.Contains(t, s.Properties, "note")
+	require.NotContains(t, s.Properties, "Hidden")
+}
+
+func TestCompatibleFlagsChangesThatBreakConsumers(t *testing.T) {
+	prev := jsonschema.Generate("v1", v1{})
+
+	type grown struct {
+		v1
+		Extra int `json:"extra"`
+	}
+	require.Empty(t, jsonschema.Compatible(prev, jsonschema.Generate("v1", grown{})))
+
+	type retyped struct {
+		base
+		At     string  `json:"at"`
+		Points []point `json:"points"`
+	}
+	require.Equal(t, []string{`$.at: format changed from "date-time" to ""`},
+		jsonschema.Compatible(prev, jsonschema.Generate("v1", retyped{})))
+
+	type dropped struct {
+		base
+		At time.Time `json:"at"`
+	}
+	require.Equal(t, []string{"$.points: no longer required"},
+		jsonschema.Compatible(prev, jsonschema.Generate("v1", dropped{})))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/nats-io/nats.go"
 	"go.opentelemetry.io/otel/trace"
@@ -28,15 +29,28 @@ func (p *Publisher) Publish(ctx context.Context, event domain.TripEvent) error {
 		return nil
 	}
 
-	payload, err := json.Marshal(event)
+	payload, header, err := Envelope(ctx, event)
 	if err != nil {
-		return fmt.Errorf("marshal event: %w", err)
+		return err
 	}
 
-	return p.conn.PublishMsg(&nats.Msg{Subject: p.subject, Data: payload, Header: map[string][]string{
-		"x-trace-id":   {traceIDFromContext(ctx)},
-		"x-event-type": {string(event.Type)},
-	}})
+	return p.conn.PublishMsg(&nats.Msg{Subject: p.subject, Data: payload, Header: header})
+}
+
+// Envelope encodes an event into the message body and headers published on
+// NATS. It is shared by the direct publisher and the transactional outbox so
+// consumers see identical messages from both paths. x-schema-version is the
+// version of the payload schema of x-event-type, see domain.EventSchemaVersion.
+func Envelope(ctx context.Context, event domain.TripEvent) ([]byte, nats.Header, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal event: %w", err)
+	}
+	return payload, nats.Header{
+		"x-trace-id":       {traceIDFromContext(ctx)},
+		"x-event-type":     {string(event.Type)},
+		"x-schema-version": {strconv.Itoa(domain.EventSchemaVersion(event.Type))},
+	}, nil
 }
 
 func traceIDFromContext(ctx context.Context) string {